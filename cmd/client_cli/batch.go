@@ -0,0 +1,112 @@
+//go:build exclude_tests
+
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/thesimpledev/skvs/internal/client"
+	"github.com/thesimpledev/skvs/internal/protocol"
+)
+
+// batchResult is one JSON line of batch output. Status is the server's
+// status name, "invalid" for lines that could not be parsed or "error" for
+// requests that got no answer.
+type batchResult struct {
+	Line       int     `json:"line"`
+	Command    string  `json:"command"`
+	Key        string  `json:"key,omitempty"`
+	Status     string  `json:"status"`
+	Value      string  `json:"value,omitempty"`
+	Version    uint64  `json:"version,omitempty"`
+	DurationMS float64 `json:"duration_ms"`
+	Error      string  `json:"error,omitempty"`
+}
+
+// runBatch executes one command per line of r, skipping blank lines and
+// lines starting with #, and writes a JSON line per command to w. Unless
+// keepGoing is set it stops at the first failure. The exit code is
+// exitError if any command failed, otherwise exitNotFound if any key was
+// missing.
+func runBatch(c *client.Client, r io.Reader, w io.Writer, timeout time.Duration, keepGoing, overwrite, old bool) int {
+	enc := json.NewEncoder(w)
+	scanner := bufio.NewScanner(r)
+	code := exitOK
+
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		result := batchResult{Line: n}
+		args, err := splitArgs(line)
+		if err == nil {
+			result.Command = args[0]
+			var dto protocol.FrameDTO
+			dto, err = parseCommand(args, overwrite, old)
+			if err == nil {
+				result.Key = dto.Key
+				err = send(c, dto, timeout, &result)
+			} else {
+				result.Status = "invalid"
+			}
+		} else {
+			result.Status = "invalid"
+		}
+
+		if err != nil {
+			result.Error = err.Error()
+		}
+		_ = enc.Encode(result)
+
+		switch {
+		case errors.Is(err, client.ErrNotFound):
+			if code == exitOK {
+				code = exitNotFound
+			}
+		case err != nil:
+			code = exitError
+			if !keepGoing {
+				return code
+			}
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		_ = enc.Encode(batchResult{Status: "error", Error: fmt.Sprintf("read input: %v", err)})
+		return exitError
+	}
+	return code
+}
+
+func send(c *client.Client, dto protocol.FrameDTO, timeout time.Duration, result *batchResult) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	start := time.Now()
+	response, err := c.Send(ctx, dto)
+	result.DurationMS = float64(time.Since(start).Microseconds()) / 1000
+
+	var serverErr *client.ServerError
+	switch {
+	case err == nil:
+		result.Status = protocol.StatusName(protocol.STATUS_OK)
+		result.Value = response.Value
+		result.Version = response.Version
+	case errors.Is(err, client.ErrNotFound):
+		result.Status = protocol.StatusName(protocol.STATUS_NOT_FOUND)
+	case errors.As(err, &serverErr):
+		result.Status = protocol.StatusName(serverErr.Status)
+	default:
+		result.Status = "error"
+	}
+	return err
+}
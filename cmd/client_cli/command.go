@@ -0,0 +1,112 @@
+//go:build exclude_tests
+
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/thesimpledev/skvs/internal/client"
+	"github.com/thesimpledev/skvs/internal/protocol"
+)
+
+// Exit codes let scripts tell a missing key apart from a failed request.
+const (
+	exitOK       = 0
+	exitError    = 1
+	exitNotFound = 2
+)
+
+var commandNames = []string{"set", "get", "delete", "exists", "info", "ping"}
+
+// parseCommand turns "set --overwrite key value" style arguments into a
+// request. Flags may appear anywhere after the command name; overwrite and
+// old are the defaults given on the command line.
+func parseCommand(args []string, overwrite, old bool) (protocol.FrameDTO, error) {
+	if len(args) == 0 {
+		return protocol.FrameDTO{}, fmt.Errorf("missing command")
+	}
+	if !slices.Contains(commandNames, args[0]) {
+		return protocol.FrameDTO{}, fmt.Errorf("unknown command %q", args[0])
+	}
+
+	fs := flag.NewFlagSet(args[0], flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	fs.BoolVar(&overwrite, "overwrite", overwrite, "")
+	fs.BoolVar(&old, "old", old, "")
+
+	var positional []string
+	rest := args[1:]
+	for len(rest) > 0 {
+		if err := fs.Parse(rest); err != nil {
+			return protocol.FrameDTO{}, err
+		}
+		rest = fs.Args()
+		if len(rest) > 0 {
+			positional = append(positional, rest[0])
+			rest = rest[1:]
+		}
+	}
+
+	var key, value string
+	switch args[0] {
+	case "info", "ping":
+		if len(positional) != 0 {
+			return protocol.FrameDTO{}, fmt.Errorf("%s takes no arguments", args[0])
+		}
+	case "set":
+		if len(positional) != 2 {
+			return protocol.FrameDTO{}, fmt.Errorf("usage: set <key> <value> [--overwrite] [--old]")
+		}
+		key, value = positional[0], positional[1]
+	default:
+		if len(positional) != 1 {
+			return protocol.FrameDTO{}, fmt.Errorf("usage: %s <key>", args[0])
+		}
+		key = positional[0]
+	}
+
+	return protocol.NewFrameDTO(args[0], key, value, overwrite, old)
+}
+
+// execute sends dto, prints the outcome to w and returns the exit code.
+func execute(ctx context.Context, c *client.Client, dto protocol.FrameDTO, w io.Writer) int {
+	result, err := c.Send(ctx, dto)
+	if errors.Is(err, client.ErrNotFound) {
+		fmt.Fprintln(w, "Not found:", dto.Key)
+		return exitNotFound
+	}
+	if err != nil {
+		fmt.Fprintln(w, "Error:", err)
+		return exitError
+	}
+
+	if dto.Cmd == protocol.CMD_INFO {
+		printInfo(w, result.Value)
+		return exitOK
+	}
+
+	fmt.Fprintln(w, "Response:", result.Value)
+	if result.Version != 0 {
+		fmt.Fprintln(w, "Version:", result.Version)
+	}
+	return exitOK
+}
+
+func printInfo(w io.Writer, info string) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	for line := range strings.Lines(info) {
+		name, value, ok := strings.Cut(strings.TrimSpace(line), ":")
+		if !ok {
+			continue
+		}
+		fmt.Fprintf(tw, "%s\t%s\n", name, value)
+	}
+	_ = tw.Flush()
+}
@@ -0,0 +1,195 @@
+//go:build exclude_tests
+
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/thesimpledev/skvs/internal/client"
+	"github.com/thesimpledev/skvs/internal/dump"
+	"github.com/thesimpledev/skvs/internal/protocol"
+)
+
+const defaultLoadBatch = 512
+
+// pipelineRetry resends requests that got no answer, which matters when
+// thousands are in flight and the odd datagram is dropped.
+var pipelineRetry = client.RetryPolicy{MaxAttempts: 5, AttemptTimeout: 500 * time.Millisecond}
+
+// runDump streams every key in key order to the chosen format. Keys are
+// listed with SCAN and their values fetched with pipelined GETs; keys deleted
+// in between are skipped.
+func runDump(c *client.Client, addr string, key []byte, opts []client.Option, timeout time.Duration, args []string) error {
+	fs := flag.NewFlagSet("dump", flag.ContinueOnError)
+	format := fs.String("format", string(dump.JSONL), "Output format: jsonl, csv or binary")
+	output := fs.String("o", "-", "Output file, - for stdout")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	f, err := dump.ParseFormat(*format)
+	if err != nil {
+		return err
+	}
+
+	w := io.Writer(os.Stdout)
+	if *output != "-" {
+		file, err := os.Create(*output)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		w = file
+	}
+
+	enc, err := dump.NewEncoder(w, f)
+	if err != nil {
+		return err
+	}
+
+	p, err := client.NewPipeline(addr, key, 0, append([]client.Option{client.WithRetryPolicy(pipelineRetry)}, opts...)...)
+	if err != nil {
+		return err
+	}
+	defer p.Close()
+
+	count := 0
+	cursor := ""
+	for {
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		keys, err := c.Scan(ctx, cursor)
+		if err != nil {
+			cancel()
+			return fmt.Errorf("scan after %q: %w", cursor, err)
+		}
+		if len(keys) == 0 {
+			cancel()
+			break
+		}
+
+		futures := make([]*client.Future, len(keys))
+		for i, k := range keys {
+			futures[i], err = p.Go(ctx, protocol.FrameDTO{Cmd: protocol.CMD_GET, Key: k})
+			if err != nil {
+				cancel()
+				return fmt.Errorf("get %q: %w", k, err)
+			}
+		}
+		for i, future := range futures {
+			result, err := future.Wait(ctx)
+			if errors.Is(err, client.ErrNotFound) {
+				continue
+			}
+			if err != nil {
+				cancel()
+				return fmt.Errorf("get %q: %w", keys[i], err)
+			}
+			if err := enc.Encode(dump.Record{Key: keys[i], Value: []byte(result.Value)}); err != nil {
+				cancel()
+				return err
+			}
+			count++
+		}
+		cancel()
+		cursor = keys[len(keys)-1]
+	}
+
+	if err := enc.Flush(); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "dumped %d keys\n", count)
+	return nil
+}
+
+// runLoad sets every record from the input, sending them in pipelined
+// batches and waiting for each batch before reading on.
+func runLoad(addr string, key []byte, opts []client.Option, timeout time.Duration, overwrite bool, args []string) error {
+	fs := flag.NewFlagSet("load", flag.ContinueOnError)
+	format := fs.String("format", string(dump.JSONL), "Input format: jsonl, csv or binary")
+	input := fs.String("i", "-", "Input file, - for stdin")
+	batch := fs.Int("batch", defaultLoadBatch, "Sets per batch; each batch is confirmed before the next is read")
+	fs.BoolVar(&overwrite, "overwrite", overwrite, "Replace keys that already exist")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	*batch = max(*batch, 1)
+
+	f, err := dump.ParseFormat(*format)
+	if err != nil {
+		return err
+	}
+
+	r := io.Reader(os.Stdin)
+	if *input != "-" {
+		file, err := os.Open(*input)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		r = file
+	}
+
+	dec, err := dump.NewDecoder(r, f)
+	if err != nil {
+		return err
+	}
+
+	p, err := client.NewPipeline(addr, key, 0, append([]client.Option{client.WithRetryPolicy(pipelineRetry)}, opts...)...)
+	if err != nil {
+		return err
+	}
+	defer p.Close()
+
+	// Each batch shares one deadline, which also bounds the Flush that
+	// closes it.
+	count := 0
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer func() { cancel() }()
+	flush := func() error {
+		err := p.Flush(ctx)
+		cancel()
+		ctx, cancel = context.WithTimeout(context.Background(), timeout)
+		if err != nil {
+			return fmt.Errorf("load failed after %d records: %w", count, err)
+		}
+		return nil
+	}
+
+	for {
+		record, err := dec.Decode()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("record %d: %w", count+1, err)
+		}
+
+		dto, err := protocol.NewFrameDTO("set", record.Key, string(record.Value), overwrite, false)
+		if err != nil {
+			return fmt.Errorf("record %d (%q): %w", count+1, record.Key, err)
+		}
+
+		if _, err := p.Go(ctx, dto); err != nil {
+			return fmt.Errorf("record %d (%q): %w", count+1, record.Key, err)
+		}
+		count++
+
+		if count%*batch == 0 {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := flush(); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "loaded %d keys\n", count)
+	return nil
+}
@@ -0,0 +1,61 @@
+//go:build exclude_tests
+
+package main
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/thesimpledev/skvs/internal/encryption"
+)
+
+// runKeygen prints a new random key, or with --kdf new passphrase
+// parameters with a fresh salt. It needs no server.
+func runKeygen(args []string, out io.Writer) error {
+	fs := flag.NewFlagSet("keygen", flag.ContinueOnError)
+	format := fs.String("format", "hex", "Key encoding: hex or base64")
+	kdf := fs.String("kdf", "", "Print argon2id or scrypt parameters for a passphrase instead of a key")
+	output := fs.String("o", "-", "Write to this file, created with mode 0600, instead of stdout")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	var text string
+	if *kdf != "" {
+		params, err := encryption.NewKDFParams(*kdf)
+		if err != nil {
+			return err
+		}
+		text = params.String()
+	} else {
+		key := encryption.GenerateKey()
+		switch *format {
+		case "hex":
+			text = hex.EncodeToString(key)
+		case "base64":
+			text = base64.StdEncoding.EncodeToString(key)
+		default:
+			return fmt.Errorf("unknown key format %q, want hex or base64", *format)
+		}
+	}
+
+	if *output == "-" {
+		_, err := fmt.Fprintln(out, text)
+		return err
+	}
+
+	// Never overwrite: replacing a key file locks out every existing client.
+	f, err := os.OpenFile(*output, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintln(f, text); err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -8,48 +8,147 @@ import (
 	"fmt"
 	"os"
 
+	"golang.org/x/term"
+
 	"github.com/thesimpledev/skvs/internal/client"
+	"github.com/thesimpledev/skvs/internal/encryption"
 	"github.com/thesimpledev/skvs/internal/protocol"
 )
 
 func main() {
+	addr := flag.String("addr", envOr("SKVS_ADDR", fmt.Sprintf("localhost:%d", protocol.Port)), "Server address (env SKVS_ADDR)")
+	var keySource encryption.KeySource
+	flag.StringVar(&keySource.Raw, "key", os.Getenv("SKVS_ENCRYPTION_KEY"), "32-byte encryption key (env SKVS_ENCRYPTION_KEY)")
+	flag.StringVar(&keySource.File, "key-file", os.Getenv("SKVS_KEY_FILE"), "File holding the key as hex or base64 (env SKVS_KEY_FILE)")
+	flag.StringVar(&keySource.Passphrase, "passphrase", os.Getenv("SKVS_PASSPHRASE"), "Passphrase to derive the key from (env SKVS_PASSPHRASE)")
+	flag.StringVar(&keySource.KDF, "kdf", os.Getenv("SKVS_KDF"), "KDF parameters for --passphrase, as printed by keygen --kdf (env SKVS_KDF)")
+	cipher := flag.String("cipher", envOr("SKVS_CIPHER_SUITE", "aes-256-gcm"), "Cipher suite: aes-256-gcm, chacha20-poly1305 or xchacha20-poly1305 (env SKVS_CIPHER_SUITE)")
+	session := flag.Bool("session", false, "Handshake and seal requests with a forward-secret session key")
+	timeout := flag.Duration("timeout", protocol.Timeout, "Per-command timeout")
+	file := flag.String("f", "", "Run commands from a file, one per line (- for stdin)")
+	keepGoing := flag.Bool("keep-going", false, "In batch mode, continue after a failed command")
 	overwrite := flag.Bool("overwrite", false, "Allow overwriting existing values")
 	old := flag.Bool("old", false, "Return the previous value if available")
+	flag.Usage = usage
 	flag.Parse()
 
 	args := flag.Args()
-	if len(args) < 2 {
-		fmt.Println("Usage: cli <set|get|delete|exists> <key> [value] [--overwrite] [--old]")
-		os.Exit(1)
+	if len(args) > 0 && args[0] == "keygen" {
+		if err := runKeygen(args[1:], os.Stdout); err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			os.Exit(exitError)
+		}
+		return
+	}
+
+	shell := *file == "" && (len(args) == 0 || args[0] == "shell")
+
+	// Piped input without a command is a batch, not a shell.
+	if shell && !term.IsTerminal(int(os.Stdin.Fd())) {
+		shell = false
+		*file = "-"
+	}
+
+	tool := len(args) > 0 && (args[0] == "dump" || args[0] == "load")
+
+	var dto protocol.FrameDTO
+	if !shell && !tool && *file == "" {
+		var err error
+		dto, err = parseCommand(args, *overwrite, *old)
+		if err != nil {
+			fmt.Println("Error:", err)
+			usage()
+			os.Exit(exitError)
+		}
 	}
 
-	commandStr := args[0]
-	key := args[1]
-	value := ""
-	if len(args) > 2 {
-		value = args[2]
+	suite, err := encryption.ParseSuite(*cipher)
+	if err != nil {
+		fmt.Println("Error:", err)
+		os.Exit(exitError)
 	}
 
-	dto, err := protocol.NewFrameDTO(commandStr, key, value, *overwrite, *old)
+	key, err := keySource.Load()
 	if err != nil {
-		fmt.Printf("error creating data transfer object: %v\n", err)
+		fmt.Println("Error:", err)
+		os.Exit(exitError)
+	}
+
+	opts := []client.Option{client.WithCipherSuite(suite)}
+	if *session {
+		opts = append(opts, client.WithSessions())
 	}
 
-	c, err := client.New(fmt.Sprintf("localhost:%d", protocol.Port), nil)
+	c, err := client.New(*addr, key, opts...)
 	if err != nil {
 		fmt.Println("Error creating client:", err)
-		os.Exit(1)
+		os.Exit(exitError)
 	}
 	defer c.Close()
 
-	ctx, cancel := context.WithTimeout(context.Background(), protocol.Timeout)
-	defer cancel()
+	if tool {
+		if args[0] == "dump" {
+			err = runDump(c, *addr, key, opts, *timeout, args[1:])
+		} else {
+			err = runLoad(*addr, key, opts, *timeout, *overwrite, args[1:])
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			c.Close()
+			os.Exit(exitError)
+		}
+		return
+	}
 
-	resp, err := c.Send(ctx, dto)
-	if err != nil {
-		fmt.Println("Error:", err)
-		os.Exit(1)
+	if *file != "" {
+		in := os.Stdin
+		if *file != "-" {
+			in, err = os.Open(*file)
+			if err != nil {
+				fmt.Println("Error:", err)
+				c.Close()
+				os.Exit(exitError)
+			}
+			defer in.Close()
+		}
+		if code := runBatch(c, in, os.Stdout, *timeout, *keepGoing, *overwrite, *old); code != exitOK {
+			c.Close()
+			os.Exit(code)
+		}
+		return
 	}
 
-	fmt.Println("Response:", resp)
+	if shell {
+		if err := repl(c, *timeout, *overwrite, *old); err != nil {
+			fmt.Println("Error:", err)
+			os.Exit(exitError)
+		}
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	code := execute(ctx, c, dto, os.Stdout)
+	cancel()
+	if code != exitOK {
+		c.Close()
+		os.Exit(code)
+	}
+}
+
+func usage() {
+	fmt.Println("Usage: cli [--addr host:port] [--key key] <set|get|delete|exists> <key> [value] [--overwrite] [--old]")
+	fmt.Println("       cli [--addr host:port] [--key key] <info|ping>")
+	fmt.Println("       cli [--addr host:port] [--key key] [shell]")
+	fmt.Println("       cli [--addr host:port] [--key key] -f <file|-> [--keep-going]")
+	fmt.Println("       cli [--addr host:port] [--key key] dump [--format jsonl|csv|binary] [-o file]")
+	fmt.Println("       cli [--addr host:port] [--key key] load [--format jsonl|csv|binary] [-i file] [--overwrite] [--batch n]")
+	fmt.Println("       cli keygen [--format hex|base64] [--kdf argon2id|scrypt] [-o file]")
+	fmt.Println("Instead of --key, give --key-file, or --passphrase with --kdf. Add --session for a forward-secret session.")
+}
+
+func envOr(name, fallback string) string {
+	if v := os.Getenv(name); v != "" {
+		return v
+	}
+	return fallback
 }
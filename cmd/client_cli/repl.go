@@ -0,0 +1,136 @@
+//go:build exclude_tests
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"golang.org/x/term"
+
+	"github.com/thesimpledev/skvs/internal/client"
+)
+
+const prompt = "skvs> "
+
+// repl runs an interactive shell over one connection, with line editing,
+// history (up/down) and tab completion of command names. Stdin must be a
+// terminal; piped input goes through runBatch instead.
+func repl(c *client.Client, timeout time.Duration, overwrite, old bool) error {
+	fd := int(os.Stdin.Fd())
+	state, err := term.MakeRaw(fd)
+	if err != nil {
+		return fmt.Errorf("raw terminal: %w", err)
+	}
+	defer func() { _ = term.Restore(fd, state) }()
+
+	t := term.NewTerminal(struct {
+		io.Reader
+		io.Writer
+	}{os.Stdin, os.Stdout}, prompt)
+	t.AutoCompleteCallback = complete
+	fmt.Fprintln(t, "Connected. Type help for commands, exit to quit.")
+
+	for {
+		line, err := t.ReadLine()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		args, err := splitArgs(line)
+		if err != nil {
+			fmt.Fprintln(t, "Error:", err)
+			continue
+		}
+		if len(args) == 0 {
+			continue
+		}
+
+		switch args[0] {
+		case "exit", "quit":
+			return nil
+		case "help":
+			printHelp(t)
+			continue
+		}
+
+		dto, err := parseCommand(args, overwrite, old)
+		if err != nil {
+			fmt.Fprintln(t, "Error:", err)
+			continue
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		execute(ctx, c, dto, t)
+		cancel()
+	}
+}
+
+// complete fills in the command name at the start of the line on tab.
+func complete(line string, pos int, key rune) (string, int, bool) {
+	if key != '\t' || strings.ContainsRune(line[:pos], ' ') {
+		return "", 0, false
+	}
+
+	var matches []string
+	for _, name := range append(commandNames, "help", "exit") {
+		if strings.HasPrefix(name, line[:pos]) {
+			matches = append(matches, name)
+		}
+	}
+	if len(matches) != 1 {
+		return "", 0, false
+	}
+
+	completed := matches[0] + " "
+	return completed + line[pos:], len(completed), true
+}
+
+// splitArgs splits a line on spaces, keeping double-quoted values together.
+func splitArgs(line string) ([]string, error) {
+	var args []string
+	var current strings.Builder
+	inQuotes, started := false, false
+
+	for _, r := range line {
+		switch {
+		case r == '"':
+			inQuotes = !inQuotes
+			started = true
+		case r == ' ' && !inQuotes:
+			if started {
+				args = append(args, current.String())
+				current.Reset()
+				started = false
+			}
+		default:
+			current.WriteRune(r)
+			started = true
+		}
+	}
+	if inQuotes {
+		return nil, fmt.Errorf("unterminated quote")
+	}
+	if started {
+		args = append(args, current.String())
+	}
+	return args, nil
+}
+
+func printHelp(w io.Writer) {
+	fmt.Fprintln(w, "  set <key> <value> [--overwrite] [--old]")
+	fmt.Fprintln(w, "  get <key>")
+	fmt.Fprintln(w, "  delete <key>")
+	fmt.Fprintln(w, "  exists <key>")
+	fmt.Fprintln(w, "  info")
+	fmt.Fprintln(w, "  ping")
+	fmt.Fprintln(w, "  exit")
+}
@@ -4,59 +4,66 @@ package main
 
 import (
 	"context"
-	"log/slog"
-	"net"
+	"errors"
+	"flag"
+	"fmt"
 	"os"
-	"time"
+	"os/signal"
+	"syscall"
 
-	"github.com/thesimpledev/skvs/internal/encryption"
-	"github.com/thesimpledev/skvs/internal/skvs"
+	"github.com/thesimpledev/skvs/internal/config"
+	"github.com/thesimpledev/skvs/internal/server"
 )
 
-type Encryptor interface {
-	Encrypt([]byte) ([]byte, error)
-	Decrypt([]byte) ([]byte, error)
-}
-
-type server struct {
-	log         *slog.Logger
-	encryptor   Encryptor
-	conn        *net.UDPConn
-	port        string
-	app         *skvs.App
-	semaphore   chan struct{}
-	readTimeout time.Duration
-}
-
 func main() {
-	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel()
-	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
-
-	e, err := encryption.New([]byte(os.Getenv("SKVS_ENCRYPTION_KEY")))
+	cfg, err := config.Load(os.Args[1:], os.Getenv)
+	if errors.Is(err, flag.ErrHelp) {
+		config.Usage(os.Stdout)
+		return
+	}
 	if err != nil {
-		logger.Error("Unable to create Encryptor: ", "err", err)
+		fmt.Fprintln(os.Stderr, "invalid configuration:", err)
 		os.Exit(1)
 	}
 
-	server := &server{
-		log:         logger,
-		encryptor:   e,
-		readTimeout: 100 * time.Millisecond,
+	srv, err := server.New(cfg)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
 	}
-	server.port = os.Getenv("PORT")
-	server.app = skvs.New(logger)
-	server.semaphore = make(chan struct{}, 1000)
 
-	udpConn, err := server.startUDPServer()
-	if err != nil {
-		logger.Error("unable to start UDP Server", "err", err)
+	// The first SIGINT or SIGTERM starts a graceful shutdown; stop restores
+	// the default handling so a second one kills the process.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	context.AfterFunc(ctx, stop)
+
+	go watchReload(ctx, srv)
+
+	if err := srv.ListenAndServe(ctx); err != nil {
+		fmt.Fprintln(os.Stderr, "server:", err)
 		os.Exit(1)
 	}
-	server.conn = udpConn
-	defer func() {
-		_ = udpConn.Close()
-	}()
+}
+
+// watchReload re-reads the configuration on SIGHUP. An invalid configuration
+// is rejected as a whole.
+func watchReload(ctx context.Context, srv *server.Server) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
 
-	server.serverListen(ctx)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+			next, err := config.Load(os.Args[1:], os.Getenv)
+			if err != nil {
+				srv.Logger().Error("configuration reload rejected", "err", err)
+				continue
+			}
+			_ = srv.Reload(next)
+		}
+	}
 }
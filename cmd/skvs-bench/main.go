@@ -0,0 +1,282 @@
+//go:build exclude_tests
+
+// Command skvs-bench drives a server with a configurable mix of gets and sets
+// through the real client and encryption path and reports throughput,
+// latency percentiles and loss.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"math/rand/v2"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/thesimpledev/skvs/internal/client"
+	"github.com/thesimpledev/skvs/internal/encryption"
+	"github.com/thesimpledev/skvs/internal/protocol"
+)
+
+type config struct {
+	addr           string
+	key            []byte
+	suite          encryption.Suite
+	session        bool
+	concurrency    int
+	duration       time.Duration
+	keys           int
+	valueMin       int
+	valueMax       int
+	readRatio      float64
+	rate           float64
+	preload        bool
+	attemptTimeout time.Duration
+	maxAttempts    int
+}
+
+// counters are shared by every worker and fed by the client's OnAttempt hook.
+type counters struct {
+	attempts atomic.Uint64
+	lost     atomic.Uint64
+	busy     atomic.Uint64
+	retried  atomic.Uint64
+}
+
+func main() {
+	var cfg config
+	var cipher, valueSize string
+	var keySource encryption.KeySource
+	flag.StringVar(&cfg.addr, "addr", fmt.Sprintf("localhost:%d", protocol.Port), "Server address")
+	flag.StringVar(&keySource.Raw, "key", os.Getenv("SKVS_ENCRYPTION_KEY"), "32-byte encryption key (env SKVS_ENCRYPTION_KEY)")
+	flag.StringVar(&keySource.File, "key-file", os.Getenv("SKVS_KEY_FILE"), "File holding the key as hex or base64 (env SKVS_KEY_FILE)")
+	flag.StringVar(&keySource.Passphrase, "passphrase", os.Getenv("SKVS_PASSPHRASE"), "Passphrase to derive the key from (env SKVS_PASSPHRASE)")
+	flag.StringVar(&keySource.KDF, "kdf", os.Getenv("SKVS_KDF"), "KDF parameters for -passphrase (env SKVS_KDF)")
+	flag.BoolVar(&cfg.session, "session", false, "Handshake and seal requests with a forward-secret session key")
+	flag.StringVar(&cipher, "cipher", "aes-256-gcm", "Cipher suite: aes-256-gcm, chacha20-poly1305 or xchacha20-poly1305")
+	flag.IntVar(&cfg.concurrency, "concurrency", 16, "Workers, each with its own socket and one request in flight")
+	flag.DurationVar(&cfg.duration, "duration", 10*time.Second, "How long to run")
+	flag.IntVar(&cfg.keys, "keys", 10000, "Size of the key space")
+	flag.StringVar(&valueSize, "value-size", "100", "Value size in bytes: N, or MIN-MAX for a uniform distribution")
+	flag.Float64Var(&cfg.readRatio, "read-ratio", 0.9, "Fraction of requests that are gets; the rest are overwriting sets")
+	flag.Float64Var(&cfg.rate, "rate", 0, "Target requests per second across all workers; 0 is as fast as possible")
+	flag.BoolVar(&cfg.preload, "preload", true, "Set every key once before measuring so gets hit")
+	flag.DurationVar(&cfg.attemptTimeout, "attempt-timeout", 200*time.Millisecond, "Time to wait for a response before resending")
+	flag.IntVar(&cfg.maxAttempts, "max-attempts", 3, "Sends per request before counting it as failed")
+	flag.Parse()
+
+	var err error
+	cfg.key, err = keySource.Load()
+	if err == nil {
+		cfg.valueMin, cfg.valueMax, err = parseValueSize(valueSize)
+	}
+	if err == nil {
+		cfg.suite, err = encryption.ParseSuite(cipher)
+	}
+	if err == nil {
+		err = cfg.validate()
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(1)
+	}
+
+	if err := run(cfg); err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(1)
+	}
+}
+
+func parseValueSize(s string) (int, int, error) {
+	lo, hi, ranged := strings.Cut(s, "-")
+	minSize, err := strconv.Atoi(lo)
+	if err != nil {
+		return 0, 0, fmt.Errorf("value size %q: %w", s, err)
+	}
+	maxSize := minSize
+	if ranged {
+		if maxSize, err = strconv.Atoi(hi); err != nil {
+			return 0, 0, fmt.Errorf("value size %q: %w", s, err)
+		}
+	}
+	return minSize, maxSize, nil
+}
+
+func (c config) validate() error {
+	switch {
+	case c.concurrency < 1:
+		return fmt.Errorf("concurrency must be at least 1")
+	case c.keys < 1:
+		return fmt.Errorf("keys must be at least 1")
+	case c.valueMin < 1 || c.valueMax < c.valueMin || c.valueMax > protocol.ValueSize:
+		return fmt.Errorf("value size must be between 1 and %d bytes", protocol.ValueSize)
+	case c.readRatio < 0 || c.readRatio > 1:
+		return fmt.Errorf("read ratio must be between 0 and 1")
+	case c.rate < 0:
+		return fmt.Errorf("rate cannot be negative")
+	}
+	return nil
+}
+
+func run(cfg config) error {
+	var ctr counters
+	policy := client.RetryPolicy{
+		MaxAttempts:    cfg.maxAttempts,
+		AttemptTimeout: cfg.attemptTimeout,
+		OnAttempt: func(a client.Attempt) {
+			ctr.attempts.Add(1)
+			if a.Number > 1 {
+				ctr.retried.Add(1)
+			}
+			switch {
+			case errors.Is(a.Err, client.ErrBusy):
+				ctr.busy.Add(1)
+			case a.Err != nil:
+				ctr.lost.Add(1)
+			}
+		},
+	}
+
+	opts := []client.Option{client.WithRetryPolicy(policy), client.WithCipherSuite(cfg.suite)}
+	if cfg.session {
+		opts = append(opts, client.WithSessions())
+	}
+	clients := make([]*client.Client, cfg.concurrency)
+	for i := range clients {
+		c, err := client.New(cfg.addr, cfg.key, opts...)
+		if err != nil {
+			return err
+		}
+		defer c.Close()
+		clients[i] = c
+	}
+
+	if cfg.preload {
+		start := time.Now()
+		if err := preload(cfg, clients); err != nil {
+			return err
+		}
+		fmt.Printf("preloaded %d keys in %v\n", cfg.keys, time.Since(start).Round(time.Millisecond))
+		ctr.attempts.Store(0)
+		ctr.lost.Store(0)
+		ctr.busy.Store(0)
+		ctr.retried.Store(0)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.duration)
+	defer cancel()
+
+	results := make([]*workerStats, cfg.concurrency)
+	var wg sync.WaitGroup
+	start := time.Now()
+	for i, c := range clients {
+		results[i] = &workerStats{}
+		wg.Go(func() { work(ctx, cfg, i, c, results[i]) })
+	}
+	wg.Wait()
+
+	report(cfg, merge(results), time.Since(start), &ctr, clients)
+	return nil
+}
+
+// preload sets every key in the key space, split across the workers.
+func preload(cfg config, clients []*client.Client) error {
+	errs := make(chan error, len(clients))
+	var wg sync.WaitGroup
+	for w, c := range clients {
+		wg.Go(func() {
+			for k := w; k < cfg.keys; k += len(clients) {
+				ctx, cancel := context.WithTimeout(context.Background(), protocol.Timeout)
+				_, err := c.Send(ctx, setRequest(cfg, k))
+				cancel()
+				if err != nil {
+					errs <- fmt.Errorf("preload key %d: %w", k, err)
+					return
+				}
+			}
+		})
+	}
+	wg.Wait()
+	close(errs)
+	return <-errs
+}
+
+// work sends requests until ctx is done. With a target rate each worker
+// sends on its own fixed schedule and latency is measured from the
+// scheduled time, so a slow server is not hidden by requests queueing up
+// behind it.
+func work(ctx context.Context, cfg config, id int, c *client.Client, stats *workerStats) {
+	var interval time.Duration
+	if cfg.rate > 0 {
+		interval = time.Duration(float64(time.Second) * float64(cfg.concurrency) / cfg.rate)
+	}
+	next := time.Now().Add(time.Duration(id) * interval / time.Duration(cfg.concurrency))
+
+	for ctx.Err() == nil {
+		start := time.Now()
+		if interval > 0 {
+			if wait := time.Until(next); wait > 0 {
+				select {
+				case <-time.After(wait):
+				case <-ctx.Done():
+					return
+				}
+			}
+			start = next
+			next = next.Add(interval)
+		}
+
+		k := rand.IntN(cfg.keys)
+		dto := protocol.FrameDTO{Cmd: protocol.CMD_GET, Key: benchKey(k)}
+		if rand.Float64() >= cfg.readRatio {
+			dto = setRequest(cfg, k)
+		}
+
+		reqCtx, cancel := context.WithTimeout(context.Background(), protocol.Timeout)
+		_, err := c.Send(reqCtx, dto)
+		cancel()
+		stats.record(dto.Cmd, time.Since(start), err)
+	}
+}
+
+func benchKey(k int) string {
+	return "bench:" + strconv.Itoa(k)
+}
+
+func setRequest(cfg config, k int) protocol.FrameDTO {
+	size := cfg.valueMin
+	if cfg.valueMax > cfg.valueMin {
+		size += rand.IntN(cfg.valueMax - cfg.valueMin + 1)
+	}
+	value := make([]byte, size)
+	for i := range value {
+		value[i] = 'a' + byte(rand.IntN(26))
+	}
+	return protocol.FrameDTO{Cmd: protocol.CMD_SET, Key: benchKey(k), Value: value, Overwrite: true}
+}
+
+func report(cfg config, s *workerStats, elapsed time.Duration, ctr *counters, clients []*client.Client) {
+	var stale uint64
+	for _, c := range clients {
+		stale += c.Stale()
+	}
+
+	total := s.gets + s.sets + s.failed
+	fmt.Printf("target:       %s, %s, %d workers, %d keys, %d-%d byte values, %.0f%% reads\n",
+		cfg.addr, cfg.suite, cfg.concurrency, cfg.keys, cfg.valueMin, cfg.valueMax, cfg.readRatio*100)
+	fmt.Printf("duration:     %v\n", elapsed.Round(time.Millisecond))
+	fmt.Printf("requests:     %d (%d gets, %d sets, %d not found, %d failed)\n", total, s.gets, s.sets, s.notFound, s.failed)
+	fmt.Printf("throughput:   %.0f req/s\n", float64(s.gets+s.sets)/elapsed.Seconds())
+	fmt.Printf("latency:      p50 %v  p99 %v  p999 %v  max %v\n",
+		s.percentile(0.50), s.percentile(0.99), s.percentile(0.999), s.percentile(1))
+	fmt.Printf("attempts:     %d sent, %d lost, %d busy, %d retries, %d stale responses\n",
+		ctr.attempts.Load(), ctr.lost.Load(), ctr.busy.Load(), ctr.retried.Load(), stale)
+	if s.firstErr != nil {
+		fmt.Printf("first error:  %v\n", s.firstErr)
+	}
+}
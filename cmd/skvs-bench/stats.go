@@ -0,0 +1,65 @@
+//go:build exclude_tests
+
+package main
+
+import (
+	"errors"
+	"slices"
+	"time"
+
+	"github.com/thesimpledev/skvs/internal/client"
+	"github.com/thesimpledev/skvs/internal/protocol"
+)
+
+// workerStats is owned by one worker while it runs and merged afterwards, so
+// it needs no locking. Latencies are kept for successful requests only.
+type workerStats struct {
+	gets, sets, notFound, failed uint64
+	latencies                    []time.Duration
+	firstErr                     error
+}
+
+func (s *workerStats) record(cmd byte, latency time.Duration, err error) {
+	switch {
+	case errors.Is(err, client.ErrNotFound):
+		s.notFound++
+	case err != nil:
+		s.failed++
+		if s.firstErr == nil {
+			s.firstErr = err
+		}
+		return
+	}
+
+	if cmd == protocol.CMD_GET {
+		s.gets++
+	} else {
+		s.sets++
+	}
+	s.latencies = append(s.latencies, latency)
+}
+
+func merge(all []*workerStats) *workerStats {
+	merged := &workerStats{}
+	for _, s := range all {
+		merged.gets += s.gets
+		merged.sets += s.sets
+		merged.notFound += s.notFound
+		merged.failed += s.failed
+		merged.latencies = append(merged.latencies, s.latencies...)
+		if merged.firstErr == nil {
+			merged.firstErr = s.firstErr
+		}
+	}
+	slices.Sort(merged.latencies)
+	return merged
+}
+
+// percentile expects latencies to be sorted, as merge leaves them.
+func (s *workerStats) percentile(p float64) time.Duration {
+	if len(s.latencies) == 0 {
+		return 0
+	}
+	i := min(int(p*float64(len(s.latencies))), len(s.latencies)-1)
+	return s.latencies[i].Round(time.Microsecond)
+}
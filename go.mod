@@ -1,3 +1,11 @@
 module github.com/thesimpledev/skvs
 
 go 1.25.0
+
+require (
+	golang.org/x/net v0.58.0
+	golang.org/x/sys v0.47.0
+	golang.org/x/term v0.45.0
+)
+
+require golang.org/x/crypto v0.55.0
@@ -0,0 +1,104 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/thesimpledev/skvs/internal/protocol"
+)
+
+// busyFirst is a hook that answers the first busy datagrams with STATUS_BUSY
+// and the given retry-after hint, and lets the rest through.
+func busyFirst(busy int64, retryAfter time.Duration) func(n int64) reply {
+	response := protocol.NewBusyResponseDTO(retryAfter)
+	return func(n int64) reply {
+		if n <= busy {
+			return reply{replace: &response}
+		}
+		return reply{}
+	}
+}
+
+func TestSendHonoursBusy(t *testing.T) {
+	addr, received := startHookServer(t, busyFirst(2, 30*time.Millisecond))
+
+	var backoffs []time.Duration
+	c, err := New(addr, testKey, WithRetryPolicy(RetryPolicy{
+		MaxAttempts:    5,
+		BaseDelay:      time.Millisecond,
+		AttemptTimeout: time.Second,
+		OnAttempt:      func(a Attempt) { backoffs = append(backoffs, a.Backoff) },
+	}))
+	if err != nil {
+		t.Fatalf("new: %v", err)
+	}
+	defer c.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	// SET with Old is not idempotent, but a busy server never ran it.
+	result, err := c.Send(ctx, protocol.FrameDTO{Cmd: protocol.CMD_SET, Key: "cat", Value: []byte("jack"), Old: true})
+	if err != nil {
+		t.Fatalf("send: %v", err)
+	}
+	if !result.Found || result.Version != 1 {
+		t.Errorf("unexpected result %+v", result)
+	}
+	if got := received.Load(); got != 3 {
+		t.Errorf("want 3 datagrams, server saw %d", got)
+	}
+	for i, b := range backoffs[1:] {
+		if b < 30*time.Millisecond || b > 45*time.Millisecond {
+			t.Errorf("retry %d: want the 30ms hint plus at most half as jitter, waited %v", i+1, b)
+		}
+	}
+}
+
+func TestSendBusyExhausted(t *testing.T) {
+	addr, received := startHookServer(t, busyFirst(100, time.Millisecond))
+
+	c, err := New(addr, testKey, WithRetryPolicy(RetryPolicy{MaxAttempts: 3, AttemptTimeout: time.Second}))
+	if err != nil {
+		t.Fatalf("new: %v", err)
+	}
+	defer c.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	_, err = c.Send(ctx, protocol.FrameDTO{Cmd: protocol.CMD_PING})
+	var serverErr *ServerError
+	if !errors.Is(err, ErrBusy) || !errors.As(err, &serverErr) || serverErr.RetryAfter != time.Millisecond {
+		t.Fatalf("want ErrBusy with a 1ms hint, got %v", err)
+	}
+	if got := received.Load(); got != 3 {
+		t.Errorf("want 3 datagrams, server saw %d", got)
+	}
+}
+
+func TestPipelineResendsBusy(t *testing.T) {
+	addr, received := startHookServer(t, busyFirst(1, 10*time.Millisecond))
+
+	p, err := NewPipeline(addr, testKey, 0, WithRetryPolicy(RetryPolicy{MaxAttempts: 3}))
+	if err != nil {
+		t.Fatalf("new pipeline: %v", err)
+	}
+	defer p.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	f, err := p.Go(ctx, protocol.FrameDTO{Cmd: protocol.CMD_DELETE, Key: "cat"})
+	if err != nil {
+		t.Fatalf("go: %v", err)
+	}
+	if _, err := f.Wait(ctx); !errors.Is(err, ErrNotFound) {
+		t.Errorf("want the resent delete answered with ErrNotFound, got %v", err)
+	}
+	if got := received.Load(); got != 2 {
+		t.Errorf("want 2 datagrams, server saw %d", got)
+	}
+}
@@ -2,9 +2,13 @@
 package client
 
 import (
+	"bytes"
 	"context"
 	"fmt"
+	"math/rand/v2"
 	"net"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/thesimpledev/skvs/internal/encryption"
@@ -12,101 +16,326 @@ import (
 )
 
 const (
-	maxAttempts = 10
-	baseDelay   = 100 * time.Millisecond
+	defaultMaxAttempts = 10
+	baseDelay          = 100 * time.Millisecond
 )
 
+// Result is the typed outcome of a request. Value is whatever the server
+// returned; Previous repeats it when that value is the one being replaced or
+// removed (SET with Old, DELETE). Found is false when the key was missing,
+// and Version is the key's version after the operation.
+type Result struct {
+	Value       string
+	Found       bool
+	Previous    string
+	Version     uint64
+	NotModified bool
+}
+
+// Client owns one UDP socket. Send is safe for concurrent use, but calls are
+// serialised so that only one request is in flight on the socket at a time;
+// use a Pool for parallelism.
 type Client struct {
 	addr      *net.UDPAddr
 	conn      *net.UDPConn
-	encryptor *encryption.Encryptor
+	suite     encryption.Suite
+	psk       []byte
+	encryptor encryption.Encryptor
+	sessions  *sessionState
+	retry     RetryPolicy
+
+	// refusals opens the server's answer to a suite it does not accept,
+	// which comes under AES-256-GCM. It is nil when that is the client's
+	// suite anyway.
+	refusals encryption.Encryptor
+
+	// mu serialises Send and guards the buffers it reuses across requests.
+	mu        sync.Mutex
+	frame     []byte
+	encrypted []byte
+	read      []byte
+	plain     []byte
+
+	nextID   atomic.Uint32
+	inFlight atomic.Uint32
+	stale    atomic.Uint64
+	invalid  atomic.Uint64
+}
+
+type Option func(*Client)
+
+// WithMaxAttempts sets how many times a request is sent before giving up.
+func WithMaxAttempts(n int) Option {
+	return func(c *Client) {
+		c.retry.MaxAttempts = max(n, 1)
+	}
 }
 
-func New(serverAddr string, encryptionKey []byte) (*Client, error) {
+// WithRetryPolicy replaces the default retry policy.
+func WithRetryPolicy(p RetryPolicy) Option {
+	return func(c *Client) {
+		c.retry = p
+	}
+}
+
+// WithCipherSuite picks the suite requests are sealed with. The default,
+// AES-256-GCM, is always accepted; a server that does not accept another
+// suite answers its requests with ErrSuiteRefused.
+func WithCipherSuite(suite encryption.Suite) Option {
+	return func(c *Client) {
+		c.suite = suite
+	}
+}
+
+func New(serverAddr string, encryptionKey []byte, opts ...Option) (*Client, error) {
 	udpAddr, err := net.ResolveUDPAddr("udp", serverAddr)
 	if err != nil {
 		return nil, fmt.Errorf("resolve addr: %w", err)
 	}
 
-	conn, err := net.DialUDP("udp", nil, udpAddr)
-	if err != nil {
-		return nil, fmt.Errorf("dial udp: %w", err)
+	c := &Client{
+		addr:      udpAddr,
+		suite:     encryption.AES256GCM,
+		psk:       bytes.Clone(encryptionKey),
+		retry:     DefaultRetryPolicy(),
+		frame:     make([]byte, 0, protocol.FrameSize),
+		encrypted: make([]byte, 0, protocol.EncryptedFrameSize),
+		read:      make([]byte, protocol.EncryptedFrameSize),
+		plain:     make([]byte, 0, protocol.FrameSize),
+	}
+	c.nextID.Store(rand.Uint32())
+	for _, opt := range opts {
+		opt(c)
 	}
 
-	e, err := encryption.New(encryptionKey)
+	c.encryptor, err = encryption.NewSuite(c.suite, encryptionKey)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create encryptor: %w", err)
 	}
+	if c.suite != encryption.AES256GCM {
+		c.refusals, err = encryption.NewSuite(encryption.AES256GCM, encryptionKey)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create encryptor: %w", err)
+		}
+	}
 
-	return &Client{addr: udpAddr, conn: conn, encryptor: e}, nil
+	c.conn, err = net.DialUDP("udp", nil, udpAddr)
+	if err != nil {
+		return nil, fmt.Errorf("dial udp: %w", err)
+	}
+	return c, nil
 }
 
 func (c *Client) Close() {
 	_ = c.conn.Close()
 }
 
-func (c *Client) Send(ctx context.Context, dto protocol.FrameDTO) (string, error) {
-	deadline, ok := ctx.Deadline()
-	if !ok {
-		return "", fmt.Errorf("Send requires a context with deadline")
+// InFlight returns the request ID currently awaiting a response, or 0.
+func (c *Client) InFlight() uint32 {
+	return c.inFlight.Load()
+}
+
+// Stale returns how many responses were discarded because they answered an
+// earlier request, typically one that had already timed out.
+func (c *Client) Stale() uint64 {
+	return c.stale.Load()
+}
+
+// Invalid returns how many datagrams were discarded because they could not
+// be decrypted or parsed, such as forged or corrupted ones.
+func (c *Client) Invalid() uint64 {
+	return c.invalid.Load()
+}
+
+// Ping checks that the server is answering.
+func (c *Client) Ping(ctx context.Context) error {
+	_, err := c.Send(ctx, protocol.FrameDTO{Cmd: protocol.CMD_PING})
+	return err
+}
+
+// Scan returns the keys after cursor, in key order. Pass "" to start and
+// the last key of each page to continue; an empty page ends the scan.
+func (c *Client) Scan(ctx context.Context, cursor string) ([]string, error) {
+	result, err := c.Send(ctx, protocol.FrameDTO{Cmd: protocol.CMD_SCAN, Key: cursor})
+	if err != nil {
+		return nil, err
+	}
+	return protocol.UnpackKeys([]byte(result.Value))
+}
+
+func (c *Client) Send(ctx context.Context, dto protocol.FrameDTO) (Result, error) {
+	if _, ok := ctx.Deadline(); !ok {
+		return Result{}, fmt.Errorf("Send requires a context with deadline")
 	}
 
-	frame := protocol.DtoToFrame(dto)
+	c.mu.Lock()
+	defer c.mu.Unlock()
 
-	encrypted, err := c.encryptor.Encrypt(frame)
+	if c.sessions != nil && dto.Cmd != protocol.CMD_HANDSHAKE {
+		return c.sendInSession(ctx, dto)
+	}
+	return c.send(ctx, dto)
+}
+
+// send runs the request and its retries. The caller holds c.mu.
+func (c *Client) send(ctx context.Context, dto protocol.FrameDTO) (Result, error) {
+	deadline, _ := ctx.Deadline()
+	dto.RequestID = c.newRequestID()
+	c.inFlight.Store(dto.RequestID)
+	defer c.inFlight.Store(0)
+
+	c.frame = protocol.AppendFrame(c.frame[:0], dto)
+	encrypted, err := c.sealer(dto.Cmd).EncryptTo(c.encrypted[:0], encryption.Request, c.frame)
 	if err != nil {
-		return "", fmt.Errorf("encryption failed: %w", err)
+		return Result{}, fmt.Errorf("encryption failed: %w", err)
 	}
+	c.encrypted = encrypted
+
+	policy := c.retry
+	attempts := policy.attempts(dto)
 
+	// A busy answer means the request was not run, so it may be resent even
+	// when a lost one could not, and the server's hint replaces the backoff.
 	var lastError error
-	for attempt := range maxAttempts {
+	var retryAfter time.Duration
+	sent := 0
+	for attempt := range max(policy.MaxAttempts, 1) {
 		if ctx.Err() != nil {
-			return "", ctx.Err()
+			return Result{}, ctx.Err()
 		}
+
+		var delay time.Duration
 		if attempt > 0 {
-			delay := min(baseDelay*(1<<(attempt-1)), time.Second)
+			if policy.Budget != nil && !policy.Budget.allow() {
+				return Result{}, fmt.Errorf("retry budget exhausted after %d attempts: %w", attempt, lastError)
+			}
+			delay = policy.delay(attempt, retryAfter)
 			select {
 			case <-time.After(delay):
 			case <-ctx.Done():
-				return "", ctx.Err()
+				return Result{}, ctx.Err()
 			}
 		}
 
-		_ = c.conn.SetWriteDeadline(deadline)
-		_ = c.conn.SetReadDeadline(deadline)
+		attemptDeadline := deadline
+		if policy.AttemptTimeout > 0 {
+			if d := time.Now().Add(policy.AttemptTimeout); d.Before(deadline) {
+				attemptDeadline = d
+			}
+		}
 
-		_, err = c.conn.Write(encrypted)
+		start := time.Now()
+		response, err := c.roundTrip(encrypted, dto.RequestID, attemptDeadline)
+		busy := err == nil && response.Status == protocol.STATUS_BUSY
+		if busy {
+			_, err = NewResult(dto, response)
+		}
+		policy.report(Attempt{
+			Number:   attempt + 1,
+			Cmd:      dto.Cmd,
+			Key:      dto.Key,
+			Backoff:  delay,
+			Duration: time.Since(start),
+			Err:      err,
+		})
+		sent++
 		if err != nil {
-			lastError = fmt.Errorf("send frame: %w", err)
+			if policy.Budget != nil {
+				policy.Budget.failure()
+			}
+			lastError = err
+			retryAfter = protocol.RetryAfter(response)
+			if !busy && sent >= attempts {
+				break
+			}
 			continue
 		}
 
-		buf := make([]byte, protocol.EncryptedFrameSize)
+		if policy.Budget != nil {
+			policy.Budget.success()
+		}
+		return NewResult(dto, response)
+	}
 
-		n, err := c.conn.Read(buf)
+	return Result{}, fmt.Errorf("failed after %d attempts: %w", sent, lastError)
+}
+
+// roundTrip sends one encrypted frame and waits until deadline for the
+// response carrying requestID. Responses to earlier requests and datagrams
+// that do not decrypt or parse are dropped, so a stray or forged datagram
+// cannot cut the attempt short. The response's value points into c.plain and
+// is only valid until the next call.
+func (c *Client) roundTrip(encrypted []byte, requestID uint32, deadline time.Time) (protocol.ResponseDTO, error) {
+	_ = c.conn.SetWriteDeadline(deadline)
+	_ = c.conn.SetReadDeadline(deadline)
+
+	if _, err := c.conn.Write(encrypted); err != nil {
+		return protocol.ResponseDTO{}, fmt.Errorf("send frame: %w", err)
+	}
+
+	for {
+		n, err := c.conn.Read(c.read)
 		if err != nil {
-			lastError = fmt.Errorf("read response: %w", err)
-			continue
+			return protocol.ResponseDTO{}, fmt.Errorf("read response: %w", err)
 		}
 
-		decrypted, err := c.encryptor.Decrypt(buf[:n])
+		decrypted, err := c.opener(c.read[:n]).DecryptInto(c.plain[:0], encryption.Response, c.read[:n])
 		if err != nil {
-			lastError = fmt.Errorf("decryption failed: %w", err)
+			c.invalid.Add(1)
 			continue
 		}
+		c.plain = decrypted
 
 		responseDTO, err := protocol.FrameToResponseDTO(decrypted)
 		if err != nil {
-			lastError = fmt.Errorf("parse response failed: %w", err)
+			c.invalid.Add(1)
 			continue
 		}
 
-		if responseDTO.Status == protocol.STATUS_ERROR {
-			return "", fmt.Errorf("server error: %s", string(responseDTO.Value))
+		if responseDTO.RequestID != requestID {
+			c.stale.Add(1)
+			continue
 		}
 
-		return string(responseDTO.Value), nil
+		return responseDTO, nil
 	}
+}
 
-	return "", fmt.Errorf("failed after %d attempts: %w", maxAttempts, lastError)
+// newRequestID returns the next non-zero request ID; zero means "none".
+func (c *Client) newRequestID() uint32 {
+	for {
+		if id := c.nextID.Add(1); id != 0 {
+			return id
+		}
+	}
+}
+
+// NewResult turns a decoded response into a Result, or into the error that
+// matches its status.
+func NewResult(dto protocol.FrameDTO, response protocol.ResponseDTO) (Result, error) {
+	if response.Status == protocol.STATUS_BUSY {
+		retryAfter := protocol.RetryAfter(response)
+		return Result{}, &ServerError{Status: response.Status, Message: fmt.Sprintf("retry after %v", retryAfter), RetryAfter: retryAfter}
+	}
+	if protocol.IsError(response.Status) {
+		return Result{}, &ServerError{Status: response.Status, Message: string(response.Value)}
+	}
+
+	if response.Status == protocol.STATUS_NOT_FOUND {
+		return Result{Found: false}, ErrNotFound
+	}
+
+	if response.Status == protocol.STATUS_NOT_MODIFIED {
+		return Result{Found: true, Version: response.Version, NotModified: true}, nil
+	}
+
+	result := Result{
+		Value:   string(response.Value),
+		Found:   true,
+		Version: response.Version,
+	}
+	if dto.Old || dto.Cmd == protocol.CMD_DELETE {
+		result.Previous = result.Value
+	}
+	return result, nil
 }
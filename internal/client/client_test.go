@@ -0,0 +1,127 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/thesimpledev/skvs/internal/protocol"
+)
+
+func TestNewResult(t *testing.T) {
+	tests := []struct {
+		name     string
+		dto      protocol.FrameDTO
+		response protocol.ResponseDTO
+		want     Result
+		wantErr  error
+	}{
+		{
+			name:     "get found",
+			dto:      protocol.FrameDTO{Cmd: protocol.CMD_GET, Key: "cat"},
+			response: protocol.NewVersionedResponseDTO(protocol.STATUS_OK, 4, []byte("jack")),
+			want:     Result{Value: "jack", Found: true, Version: 4},
+		},
+		{
+			name:     "get empty value is still found",
+			dto:      protocol.FrameDTO{Cmd: protocol.CMD_GET, Key: "cat"},
+			response: protocol.NewVersionedResponseDTO(protocol.STATUS_OK, 2, []byte{}),
+			want:     Result{Value: "", Found: true, Version: 2},
+		},
+		{
+			name:     "get missing",
+			dto:      protocol.FrameDTO{Cmd: protocol.CMD_GET, Key: "cat"},
+			response: protocol.NewResponseDTO(protocol.STATUS_NOT_FOUND, nil),
+			want:     Result{Found: false},
+			wantErr:  ErrNotFound,
+		},
+		{
+			name:     "conditional get not modified",
+			dto:      protocol.FrameDTO{Cmd: protocol.CMD_GET, Key: "cat", IfVersion: 4},
+			response: protocol.NewVersionedResponseDTO(protocol.STATUS_NOT_MODIFIED, 4, nil),
+			want:     Result{Found: true, Version: 4, NotModified: true},
+		},
+		{
+			name:     "set with old returns previous",
+			dto:      protocol.FrameDTO{Cmd: protocol.CMD_SET, Key: "cat", Value: []byte("new"), Overwrite: true, Old: true},
+			response: protocol.NewVersionedResponseDTO(protocol.STATUS_OK, 9, []byte("old")),
+			want:     Result{Value: "old", Found: true, Previous: "old", Version: 9},
+		},
+		{
+			name:     "set without old has no previous",
+			dto:      protocol.FrameDTO{Cmd: protocol.CMD_SET, Key: "cat", Value: []byte("new")},
+			response: protocol.NewVersionedResponseDTO(protocol.STATUS_OK, 1, []byte("new")),
+			want:     Result{Value: "new", Found: true, Version: 1},
+		},
+		{
+			name:     "delete returns removed value as previous",
+			dto:      protocol.FrameDTO{Cmd: protocol.CMD_DELETE, Key: "cat"},
+			response: protocol.NewVersionedResponseDTO(protocol.STATUS_OK, 3, []byte("jack")),
+			want:     Result{Value: "jack", Found: true, Previous: "jack", Version: 3},
+		},
+		{
+			name:     "server error",
+			dto:      protocol.FrameDTO{Cmd: protocol.CMD_GET, Key: "cat"},
+			response: protocol.NewResponseDTO(protocol.STATUS_RATE_LIMITED, []byte("slow down")),
+			wantErr:  ErrRateLimited,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := NewResult(tt.dto, tt.response)
+
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("error: want %v, got %v", tt.wantErr, err)
+			}
+
+			if got != tt.want {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestScan(t *testing.T) {
+	addr, _ := startTestServer(t, 0)
+
+	c, err := New(addr, testKey)
+	if err != nil {
+		t.Fatalf("new: %v", err)
+	}
+	defer c.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	var want []string
+	for i := range 50 {
+		key := fmt.Sprintf("%s-%02d", strings.Repeat("k", 40), i)
+		want = append(want, key)
+		if _, err := c.Send(ctx, protocol.FrameDTO{Cmd: protocol.CMD_SET, Key: key, Value: []byte("v")}); err != nil {
+			t.Fatalf("set: %v", err)
+		}
+	}
+
+	var got []string
+	cursor := ""
+	for {
+		keys, err := c.Scan(ctx, cursor)
+		if err != nil {
+			t.Fatalf("scan: %v", err)
+		}
+		if len(keys) == 0 {
+			break
+		}
+		got = append(got, keys...)
+		cursor = keys[len(keys)-1]
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("want %d keys in order, got %d", len(want), len(got))
+	}
+}
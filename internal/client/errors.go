@@ -0,0 +1,59 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/thesimpledev/skvs/internal/protocol"
+)
+
+var (
+	ErrNotFound = errors.New("key not found")
+
+	ErrServer          = errors.New("server error")
+	ErrWrongType       = errors.New("wrong type")
+	ErrValueTooLarge   = errors.New("value too large")
+	ErrKeyExists       = errors.New("key exists")
+	ErrAuthFailure     = errors.New("authentication failed")
+	ErrRateLimited     = errors.New("rate limited")
+	ErrOutOfMemory     = errors.New("server out of memory")
+	ErrVersionMismatch = errors.New("version mismatch")
+	ErrUnknownCommand  = errors.New("unknown command")
+	ErrInvalidRequest  = errors.New("invalid request")
+	ErrBusy            = errors.New("server busy")
+	ErrSessionExpired  = errors.New("session expired")
+	ErrSuiteRefused    = errors.New("cipher suite refused")
+)
+
+var statusErrors = map[byte]error{
+	protocol.STATUS_WRONG_TYPE:       ErrWrongType,
+	protocol.STATUS_VALUE_TOO_LARGE:  ErrValueTooLarge,
+	protocol.STATUS_KEY_EXISTS:       ErrKeyExists,
+	protocol.STATUS_AUTH_FAILURE:     ErrAuthFailure,
+	protocol.STATUS_RATE_LIMITED:     ErrRateLimited,
+	protocol.STATUS_OUT_OF_MEMORY:    ErrOutOfMemory,
+	protocol.STATUS_VERSION_MISMATCH: ErrVersionMismatch,
+	protocol.STATUS_UNKNOWN_COMMAND:  ErrUnknownCommand,
+	protocol.STATUS_INVALID_REQUEST:  ErrInvalidRequest,
+	protocol.STATUS_BUSY:             ErrBusy,
+	protocol.STATUS_SESSION_EXPIRED:  ErrSessionExpired,
+	protocol.STATUS_SUITE_REFUSED:    ErrSuiteRefused,
+}
+
+// ServerError is returned when the server answers with an error status.
+// It matches ErrServer and the sentinel for its status with errors.Is.
+// RetryAfter is the server's hint for STATUS_BUSY.
+type ServerError struct {
+	Status     byte
+	Message    string
+	RetryAfter time.Duration
+}
+
+func (e *ServerError) Error() string {
+	return fmt.Sprintf("server error: %s: %s", protocol.StatusName(e.Status), e.Message)
+}
+
+func (e *ServerError) Is(target error) bool {
+	return target == ErrServer || target == statusErrors[e.Status]
+}
@@ -0,0 +1,53 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/thesimpledev/skvs/internal/protocol"
+)
+
+func TestServerErrorIs(t *testing.T) {
+	tests := []struct {
+		name   string
+		status byte
+		want   error
+	}{
+		{name: "generic", status: protocol.STATUS_ERROR, want: ErrServer},
+		{name: "wrong type", status: protocol.STATUS_WRONG_TYPE, want: ErrWrongType},
+		{name: "value too large", status: protocol.STATUS_VALUE_TOO_LARGE, want: ErrValueTooLarge},
+		{name: "key exists", status: protocol.STATUS_KEY_EXISTS, want: ErrKeyExists},
+		{name: "auth failure", status: protocol.STATUS_AUTH_FAILURE, want: ErrAuthFailure},
+		{name: "rate limited", status: protocol.STATUS_RATE_LIMITED, want: ErrRateLimited},
+		{name: "busy", status: protocol.STATUS_BUSY, want: ErrBusy},
+		{name: "out of memory", status: protocol.STATUS_OUT_OF_MEMORY, want: ErrOutOfMemory},
+		{name: "version mismatch", status: protocol.STATUS_VERSION_MISMATCH, want: ErrVersionMismatch},
+		{name: "unknown command", status: protocol.STATUS_UNKNOWN_COMMAND, want: ErrUnknownCommand},
+		{name: "invalid request", status: protocol.STATUS_INVALID_REQUEST, want: ErrInvalidRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := fmt.Errorf("wrapped: %w", &ServerError{Status: tt.status, Message: "boom"})
+
+			if !errors.Is(err, tt.want) {
+				t.Errorf("errors.Is(%v, %v) = false, want true", err, tt.want)
+			}
+			if !errors.Is(err, ErrServer) {
+				t.Errorf("errors.Is(%v, ErrServer) = false, want true", err)
+			}
+			if tt.want != ErrKeyExists && errors.Is(err, ErrKeyExists) {
+				t.Errorf("errors.Is(%v, ErrKeyExists) = true, want false", err)
+			}
+		})
+	}
+}
+
+func TestServerErrorMessage(t *testing.T) {
+	err := &ServerError{Status: protocol.STATUS_RATE_LIMITED, Message: "slow down"}
+
+	if got, want := err.Error(), "server error: rate_limited: slow down"; got != want {
+		t.Errorf("want %q, got %q", want, got)
+	}
+}
@@ -0,0 +1,453 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/thesimpledev/skvs/internal/encryption"
+	"github.com/thesimpledev/skvs/internal/protocol"
+)
+
+var ErrPipelineClosed = errors.New("pipeline closed")
+
+// defaultWindow keeps bursts well inside a default 208 KiB socket receive
+// buffer; much larger windows overflow it and stall on retransmits.
+const defaultWindow = 64
+
+// Pipeline sends requests back to back on one socket without waiting for
+// each answer, and matches responses to requests by request ID as they
+// arrive. Window bounds how many requests may be outstanding at once, so a
+// fast producer cannot overrun the server's receive buffer.
+//
+// When the retry policy has an AttemptTimeout, idempotent requests that have
+// not been answered within it are sent again, up to MaxAttempts. Requests
+// answered with STATUS_BUSY are sent again after the server's hint. Backoff
+// and retry budgets do not apply; the window already limits the load.
+//
+// With WithSessions, handshakes go through the pipeline like any request.
+// Rekeying happens in the background; requests the server answers with
+// STATUS_SESSION_EXPIRED are sent once more after a new handshake.
+type Pipeline struct {
+	c      *Client
+	window chan struct{}
+
+	// handshakeMu lets one caller at a time open a session; rekeying marks a
+	// background rekey in progress.
+	handshakeMu sync.Mutex
+	rekeying    atomic.Bool
+
+	mu       sync.Mutex
+	pending  map[uint32]*Future
+	closed   bool
+	firstErr error
+
+	outstanding sync.WaitGroup
+	stale       atomic.Uint64
+	invalid     atomic.Uint64
+	readerDone  chan struct{}
+}
+
+// Future is the eventual result of a pipelined request.
+type Future struct {
+	dto       protocol.FrameDTO
+	encrypted []byte
+	keyID     uint32
+	renewed   bool
+	attempts  int
+	sent      int
+	retry     *time.Timer
+	stopCtx   func() bool
+
+	done   chan struct{}
+	result Result
+	err    error
+}
+
+// NewPipeline dials serverAddr on a socket of its own. A window of zero or
+// less uses the default of 64 outstanding requests.
+func NewPipeline(serverAddr string, encryptionKey []byte, window int, opts ...Option) (*Pipeline, error) {
+	c, err := New(serverAddr, encryptionKey, opts...)
+	if err != nil {
+		return nil, err
+	}
+	if window <= 0 {
+		window = defaultWindow
+	}
+
+	p := &Pipeline{
+		c:          c,
+		window:     make(chan struct{}, window),
+		pending:    make(map[uint32]*Future),
+		readerDone: make(chan struct{}),
+	}
+	go p.readLoop()
+	return p, nil
+}
+
+// Go sends dto and returns at once with a Future for its result. It only
+// blocks while the window is full. ctx bounds the whole request: when it is
+// done the Future fails with ctx.Err(). As with Send, ctx must have a
+// deadline, since a request whose every datagram is lost would otherwise
+// hold its place in the window for good.
+func (p *Pipeline) Go(ctx context.Context, dto protocol.FrameDTO) (*Future, error) {
+	if _, ok := ctx.Deadline(); !ok {
+		return nil, fmt.Errorf("Go requires a context with deadline")
+	}
+	// Handshakes take no place in the window: requests waiting for a new
+	// session hold theirs, and the handshake must still get through.
+	if dto.Cmd != protocol.CMD_HANDSHAKE {
+		if p.c.sessions != nil {
+			if err := p.ensureSession(ctx); err != nil {
+				return nil, err
+			}
+		}
+		select {
+		case p.window <- struct{}{}:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	dto.RequestID = p.c.newRequestID()
+	encrypted, keyID, err := p.seal(dto)
+	if err != nil {
+		p.release(dto)
+		return nil, err
+	}
+
+	f := &Future{
+		dto:       dto,
+		encrypted: encrypted,
+		keyID:     keyID,
+		attempts:  p.c.retry.attempts(dto),
+		done:      make(chan struct{}),
+	}
+
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		p.release(dto)
+		return nil, ErrPipelineClosed
+	}
+	p.pending[dto.RequestID] = f
+	p.outstanding.Add(1)
+	f.stopCtx = context.AfterFunc(ctx, func() {
+		p.complete(dto.RequestID, protocol.ResponseDTO{}, ctx.Err())
+	})
+	p.mu.Unlock()
+
+	p.transmit(f)
+	return f, nil
+}
+
+// seal encrypts dto with the current session or the pre-shared key and
+// returns the message and the key ID it was sealed under.
+func (p *Pipeline) seal(dto protocol.FrameDTO) ([]byte, uint32, error) {
+	e := p.c.sealer(dto.Cmd)
+	frame := protocol.GetBuffer()
+	*frame = protocol.AppendFrame(*frame, dto)
+	encrypted, err := e.EncryptTo(make([]byte, 0, protocol.EncryptedFrameSize), encryption.Request, *frame)
+	protocol.PutBuffer(frame)
+	if err != nil {
+		return nil, 0, fmt.Errorf("encryption failed: %w", err)
+	}
+	return encrypted, e.KeyID(), nil
+}
+
+// Flush waits until every request sent so far has completed and returns the
+// first error any of them hit since the previous Flush. ErrNotFound is an
+// answer, not a failure, and is not reported.
+func (p *Pipeline) Flush(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		p.outstanding.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+		return fmt.Errorf("flush with %d requests outstanding: %w", p.Outstanding(), ctx.Err())
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	err := p.firstErr
+	p.firstErr = nil
+	return err
+}
+
+// Outstanding returns how many requests are waiting for a response.
+func (p *Pipeline) Outstanding() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.pending)
+}
+
+// Stale returns how many responses arrived for requests that had already
+// completed, such as duplicates of a retransmitted request.
+func (p *Pipeline) Stale() uint64 {
+	return p.stale.Load()
+}
+
+// Invalid returns how many datagrams were discarded because they could not
+// be decrypted or parsed.
+func (p *Pipeline) Invalid() uint64 {
+	return p.invalid.Load()
+}
+
+// Close fails every outstanding request with ErrPipelineClosed and closes
+// the socket. Call Flush first to let them finish.
+func (p *Pipeline) Close() {
+	p.mu.Lock()
+	p.closed = true
+	ids := make([]uint32, 0, len(p.pending))
+	for id := range p.pending {
+		ids = append(ids, id)
+	}
+	p.mu.Unlock()
+
+	for _, id := range ids {
+		p.complete(id, protocol.ResponseDTO{}, ErrPipelineClosed)
+	}
+	p.c.Close()
+	<-p.readerDone
+}
+
+// transmit writes the request and, if it may be retried, arms the timer for
+// the next attempt.
+func (p *Pipeline) transmit(f *Future) {
+	p.mu.Lock()
+	f.sent++
+	sent, encrypted := f.sent, f.encrypted
+	p.mu.Unlock()
+
+	if _, err := p.c.conn.Write(encrypted); err != nil {
+		p.complete(f.dto.RequestID, protocol.ResponseDTO{}, fmt.Errorf("send frame: %w", err))
+		return
+	}
+
+	timeout := p.c.retry.AttemptTimeout
+	if timeout <= 0 || sent >= f.attempts {
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if _, ok := p.pending[f.dto.RequestID]; ok {
+		f.retry = time.AfterFunc(timeout, func() { p.transmit(f) })
+	}
+}
+
+func (p *Pipeline) readLoop() {
+	defer close(p.readerDone)
+
+	buf := make([]byte, protocol.EncryptedFrameSize)
+	plain := make([]byte, 0, protocol.FrameSize)
+	for {
+		n, err := p.c.conn.Read(buf)
+		if err != nil {
+			p.mu.Lock()
+			closed := p.closed
+			p.mu.Unlock()
+			if closed || errors.Is(err, net.ErrClosed) {
+				return
+			}
+			continue
+		}
+
+		decrypted, err := p.c.opener(buf[:n]).DecryptInto(plain[:0], encryption.Response, buf[:n])
+		if err != nil {
+			p.invalid.Add(1)
+			continue
+		}
+		plain = decrypted
+
+		response, err := protocol.FrameToResponseDTO(decrypted)
+		if err != nil {
+			p.invalid.Add(1)
+			continue
+		}
+
+		if response.Status == protocol.STATUS_BUSY && p.resendLater(response) {
+			continue
+		}
+		if response.Status == protocol.STATUS_SESSION_EXPIRED && p.renew(response) {
+			continue
+		}
+		p.complete(response.RequestID, response, nil)
+	}
+}
+
+// resendLater schedules a request the server was too busy to run for
+// another send after the server's retry-after hint, if it has attempts left.
+// Any request may be resent this way, since the busy server did not run it.
+func (p *Pipeline) resendLater(response protocol.ResponseDTO) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	f, ok := p.pending[response.RequestID]
+	if !ok || f.sent >= max(p.c.retry.MaxAttempts, 1) {
+		return false
+	}
+	if f.retry != nil {
+		f.retry.Stop()
+	}
+	f.retry = time.AfterFunc(p.c.retry.delay(f.sent, protocol.RetryAfter(response)), func() { p.transmit(f) })
+	return true
+}
+
+// ensureSession opens a session when there is none, waiting for the
+// handshake, and starts a rekey in the background when one is due.
+func (p *Pipeline) ensureSession(ctx context.Context) error {
+	required, due := p.c.sessions.due(time.Now())
+	if !required {
+		if due && p.rekeying.CompareAndSwap(false, true) {
+			go func() {
+				defer p.rekeying.Store(false)
+				ctx, cancel := context.WithTimeout(context.Background(), protocol.Timeout)
+				defer cancel()
+				_ = p.handshake(ctx)
+			}()
+		}
+		return nil
+	}
+
+	p.handshakeMu.Lock()
+	defer p.handshakeMu.Unlock()
+	if required, _ := p.c.sessions.due(time.Now()); !required {
+		return nil
+	}
+	if err := p.handshake(ctx); err != nil {
+		return fmt.Errorf("handshake: %w", err)
+	}
+	return nil
+}
+
+func (p *Pipeline) handshake(ctx context.Context) error {
+	h, dto, err := newHandshakeRequest()
+	if err != nil {
+		return err
+	}
+	f, err := p.Go(ctx, dto)
+	if err != nil {
+		return err
+	}
+	result, err := f.Wait(ctx)
+	if err != nil {
+		return err
+	}
+	return p.c.finishHandshake(h, []byte(result.Value))
+}
+
+// renew sends a request again under a new session after the server said
+// it has lost the one the request was sealed with. Each request is renewed
+// once, and only if the retry policy would resend it, as the answer is not
+// authenticated against the request. The session is dropped either way. The
+// handshake runs off the read loop, which must deliver its answer.
+func (p *Pipeline) renew(response protocol.ResponseDTO) bool {
+	if p.c.sessions == nil {
+		return false
+	}
+	p.mu.Lock()
+	f, ok := p.pending[response.RequestID]
+	if !ok || f.renewed || f.dto.Cmd == protocol.CMD_HANDSHAKE {
+		p.mu.Unlock()
+		return false
+	}
+	keyID := f.keyID
+	if !p.c.retry.resends(f.dto) {
+		p.mu.Unlock()
+		p.c.sessions.drop(keyID)
+		return false
+	}
+	f.renewed = true
+	if f.retry != nil {
+		f.retry.Stop()
+	}
+	p.mu.Unlock()
+
+	p.c.sessions.drop(keyID)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), protocol.Timeout)
+		defer cancel()
+		if err := p.ensureSession(ctx); err != nil {
+			p.complete(f.dto.RequestID, protocol.ResponseDTO{}, err)
+			return
+		}
+		encrypted, keyID, err := p.seal(f.dto)
+		if err != nil {
+			p.complete(f.dto.RequestID, protocol.ResponseDTO{}, err)
+			return
+		}
+		p.mu.Lock()
+		f.encrypted, f.keyID = encrypted, keyID
+		p.mu.Unlock()
+		p.transmit(f)
+	}()
+	return true
+}
+
+// complete settles the Future for id once; later calls for the same id are
+// counted as stale.
+func (p *Pipeline) complete(id uint32, response protocol.ResponseDTO, err error) {
+	p.mu.Lock()
+	f, ok := p.pending[id]
+	if !ok {
+		p.mu.Unlock()
+		if err == nil {
+			p.stale.Add(1)
+		}
+		return
+	}
+	delete(p.pending, id)
+	if f.retry != nil {
+		f.retry.Stop()
+	}
+	f.stopCtx()
+	p.mu.Unlock()
+
+	if err == nil {
+		f.result, f.err = NewResult(f.dto, response)
+	} else {
+		f.err = fmt.Errorf("request %d: %w", id, err)
+	}
+	close(f.done)
+
+	if f.err != nil && !errors.Is(f.err, ErrNotFound) {
+		p.mu.Lock()
+		if p.firstErr == nil {
+			p.firstErr = f.err
+		}
+		p.mu.Unlock()
+	}
+
+	p.release(f.dto)
+	p.outstanding.Done()
+}
+
+func (p *Pipeline) release(dto protocol.FrameDTO) {
+	if dto.Cmd != protocol.CMD_HANDSHAKE {
+		<-p.window
+	}
+}
+
+// Done is closed once the result is available.
+func (f *Future) Done() <-chan struct{} {
+	return f.done
+}
+
+// Wait blocks until the result is available or ctx is done. Giving up on
+// the wait does not cancel the request.
+func (f *Future) Wait(ctx context.Context) (Result, error) {
+	select {
+	case <-f.done:
+		return f.result, f.err
+	case <-ctx.Done():
+		return Result{}, ctx.Err()
+	}
+}
@@ -0,0 +1,137 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/thesimpledev/skvs/internal/protocol"
+)
+
+func TestPipelineMatchesResponses(t *testing.T) {
+	addr, received := startTestServer(t, 0)
+
+	p, err := NewPipeline(addr, testKey, 32)
+	if err != nil {
+		t.Fatalf("new pipeline: %v", err)
+	}
+	defer p.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	const n = 500
+	for i := range n {
+		key := fmt.Sprintf("key-%d", i)
+		if _, err := p.Go(ctx, protocol.FrameDTO{Cmd: protocol.CMD_SET, Key: key, Value: []byte(key)}); err != nil {
+			t.Fatalf("go set %d: %v", i, err)
+		}
+	}
+	if err := p.Flush(ctx); err != nil {
+		t.Fatalf("flush: %v", err)
+	}
+
+	futures := make([]*Future, n)
+	for i := range n {
+		futures[i], err = p.Go(ctx, protocol.FrameDTO{Cmd: protocol.CMD_GET, Key: fmt.Sprintf("key-%d", i)})
+		if err != nil {
+			t.Fatalf("go get %d: %v", i, err)
+		}
+	}
+	for i, f := range futures {
+		result, err := f.Wait(ctx)
+		if want := fmt.Sprintf("key-%d", i); err != nil || result.Value != want {
+			t.Errorf("get %d: want %q, got %+v, %v", i, want, result, err)
+		}
+	}
+
+	if got := received.Load(); got != 2*n {
+		t.Errorf("want %d datagrams, server saw %d", 2*n, got)
+	}
+	if got := p.Outstanding(); got != 0 {
+		t.Errorf("want nothing outstanding, got %d", got)
+	}
+}
+
+func TestPipelineRetransmitsIdempotent(t *testing.T) {
+	addr, received := startTestServer(t, 1)
+
+	p, err := NewPipeline(addr, testKey, 0, WithRetryPolicy(RetryPolicy{
+		MaxAttempts:    3,
+		AttemptTimeout: 50 * time.Millisecond,
+	}))
+	if err != nil {
+		t.Fatalf("new pipeline: %v", err)
+	}
+	defer p.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	f, err := p.Go(ctx, protocol.FrameDTO{Cmd: protocol.CMD_SET, Key: "cat", Value: []byte("jack")})
+	if err != nil {
+		t.Fatalf("go: %v", err)
+	}
+	if result, err := f.Wait(ctx); err != nil || result.Value != "jack" {
+		t.Fatalf("want jack after retransmit, got %+v, %v", result, err)
+	}
+	if got := received.Load(); got != 2 {
+		t.Errorf("want 2 datagrams, server saw %d", got)
+	}
+}
+
+func TestPipelineFailures(t *testing.T) {
+	addr, _ := startTestServer(t, 1)
+
+	p, err := NewPipeline(addr, testKey, 0, WithRetryPolicy(RetryPolicy{
+		MaxAttempts:    3,
+		AttemptTimeout: 50 * time.Millisecond,
+	}))
+	if err != nil {
+		t.Fatalf("new pipeline: %v", err)
+	}
+
+	// Without a deadline a lost request would hold its window slot forever.
+	if _, err := p.Go(context.Background(), protocol.FrameDTO{Cmd: protocol.CMD_PING}); err == nil {
+		t.Error("go without a deadline: want an error")
+	}
+	if got := p.Outstanding(); got != 0 {
+		t.Errorf("want nothing outstanding after a refused request, got %d", got)
+	}
+
+	// The delete is dropped and, not being idempotent, never retransmitted,
+	// so only its own deadline ends it.
+	short, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	deleted, err := p.Go(short, protocol.FrameDTO{Cmd: protocol.CMD_DELETE, Key: "cat"})
+	if err != nil {
+		t.Fatalf("go delete: %v", err)
+	}
+
+	ctx, cancelAll := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancelAll()
+	missing, err := p.Go(ctx, protocol.FrameDTO{Cmd: protocol.CMD_GET, Key: "dog"})
+	if err != nil {
+		t.Fatalf("go get: %v", err)
+	}
+
+	if err := p.Flush(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("flush: want the delete's deadline error, got %v", err)
+	}
+	if _, err := deleted.Wait(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("delete: want deadline exceeded, got %v", err)
+	}
+	if _, err := missing.Wait(ctx); !errors.Is(err, ErrNotFound) {
+		t.Errorf("get: want ErrNotFound, got %v", err)
+	}
+	if err := p.Flush(ctx); err != nil {
+		t.Errorf("second flush should start clean, got %v", err)
+	}
+
+	p.Close()
+	if _, err := p.Go(ctx, protocol.FrameDTO{Cmd: protocol.CMD_GET, Key: "cat"}); !errors.Is(err, ErrPipelineClosed) {
+		t.Errorf("go after close: want ErrPipelineClosed, got %v", err)
+	}
+}
@@ -0,0 +1,267 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/thesimpledev/skvs/internal/protocol"
+)
+
+var ErrPoolClosed = errors.New("client pool closed")
+
+const (
+	defaultHealthInterval = 10 * time.Second
+	defaultHealthTimeout  = time.Second
+)
+
+type PoolOptions struct {
+	// Size is the number of sockets, and so the number of requests that can
+	// be in flight at once. Callers beyond that wait for a free socket.
+	Size int
+	// HealthInterval is how often idle sockets are pinged. Sockets that fail
+	// are replaced with a freshly dialled one. Zero uses the default; a
+	// negative value disables health checks.
+	HealthInterval time.Duration
+	// HealthTimeout bounds each ping. Zero uses the default.
+	HealthTimeout time.Duration
+}
+
+type PoolStats struct {
+	Size      int
+	Idle      int
+	InFlight  int
+	Replaced  uint64
+	Stale     uint64
+	Invalid   uint64
+	Unhealthy bool
+}
+
+// Pool spreads requests over several Clients, each with its own socket and
+// its own in-flight request.
+type Pool struct {
+	addr string
+	key  []byte
+	opts []Option
+	size int
+
+	healthTimeout time.Duration
+
+	idle      chan *Client
+	mu        sync.Mutex
+	clients   []*Client
+	inFlight  sync.WaitGroup
+	active    atomic.Int64
+	replaced  atomic.Uint64
+	unhealthy atomic.Bool
+	closed    chan struct{}
+	closeOnce sync.Once
+	stopped   chan struct{}
+}
+
+func NewPool(serverAddr string, encryptionKey []byte, po PoolOptions, opts ...Option) (*Pool, error) {
+	size := max(po.Size, 1)
+	p := &Pool{
+		addr:    serverAddr,
+		key:     encryptionKey,
+		opts:    opts,
+		size:    size,
+		idle:    make(chan *Client, size),
+		closed:  make(chan struct{}),
+		stopped: make(chan struct{}),
+
+		healthTimeout: po.HealthTimeout,
+	}
+	if p.healthTimeout <= 0 {
+		p.healthTimeout = defaultHealthTimeout
+	}
+
+	for range size {
+		c, err := New(serverAddr, encryptionKey, opts...)
+		if err != nil {
+			p.closeClients()
+			return nil, err
+		}
+		p.clients = append(p.clients, c)
+		p.idle <- c
+	}
+
+	interval := po.HealthInterval
+	if interval == 0 {
+		interval = defaultHealthInterval
+	}
+	if interval > 0 {
+		go p.healthLoop(interval)
+	} else {
+		close(p.stopped)
+	}
+
+	return p, nil
+}
+
+// Send checks out a socket, waiting for one if they are all busy, and sends
+// dto on it.
+func (p *Pool) Send(ctx context.Context, dto protocol.FrameDTO) (Result, error) {
+	c, err := p.acquire(ctx)
+	if err != nil {
+		return Result{}, err
+	}
+	defer p.release(c)
+
+	return c.Send(ctx, dto)
+}
+
+// Close stops new requests, waits for outstanding ones until ctx is done and
+// then closes every socket.
+func (p *Pool) Close(ctx context.Context) error {
+	p.closeOnce.Do(func() {
+		p.mu.Lock()
+		close(p.closed)
+		p.mu.Unlock()
+	})
+	<-p.stopped
+
+	done := make(chan struct{})
+	go func() {
+		p.inFlight.Wait()
+		close(done)
+	}()
+
+	var err error
+	select {
+	case <-done:
+	case <-ctx.Done():
+		err = fmt.Errorf("close pool with %d requests in flight: %w", p.active.Load(), ctx.Err())
+	}
+
+	p.closeClients()
+	return err
+}
+
+func (p *Pool) Stats() PoolStats {
+	p.mu.Lock()
+	var stale, invalid uint64
+	for _, c := range p.clients {
+		stale += c.Stale()
+		invalid += c.Invalid()
+	}
+	p.mu.Unlock()
+
+	return PoolStats{
+		Size:      p.size,
+		Idle:      len(p.idle),
+		InFlight:  int(p.active.Load()),
+		Replaced:  p.replaced.Load(),
+		Stale:     stale,
+		Invalid:   invalid,
+		Unhealthy: p.unhealthy.Load(),
+	}
+}
+
+func (p *Pool) acquire(ctx context.Context) (*Client, error) {
+	// Registering with the WaitGroup under the same lock Close uses to mark
+	// the pool closed means Close never misses a request that got through.
+	p.mu.Lock()
+	select {
+	case <-p.closed:
+		p.mu.Unlock()
+		return nil, ErrPoolClosed
+	default:
+	}
+	p.inFlight.Add(1)
+	p.mu.Unlock()
+
+	select {
+	case c := <-p.idle:
+		p.active.Add(1)
+		return c, nil
+	case <-p.closed:
+		p.inFlight.Done()
+		return nil, ErrPoolClosed
+	case <-ctx.Done():
+		p.inFlight.Done()
+		return nil, ctx.Err()
+	}
+}
+
+func (p *Pool) release(c *Client) {
+	p.active.Add(-1)
+	p.idle <- c
+	p.inFlight.Done()
+}
+
+func (p *Pool) healthLoop(interval time.Duration) {
+	defer close(p.stopped)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-p.closed:
+			return
+		case <-ticker.C:
+			p.checkHealth()
+		}
+	}
+}
+
+// checkHealth pings every socket that is idle right now, one at a time so
+// requests can keep flowing. Busy sockets are skipped; they are proving
+// themselves already.
+func (p *Pool) checkHealth() {
+	healthy := true
+	checked := make(map[*Client]bool, p.size)
+	for range p.size {
+		var c *Client
+		select {
+		case c = <-p.idle:
+		default:
+		}
+		if c == nil {
+			break
+		}
+		if checked[c] {
+			p.idle <- c
+			break
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), p.healthTimeout)
+		err := c.Ping(ctx)
+		cancel()
+
+		if err != nil {
+			healthy = false
+			if fresh, dialErr := New(p.addr, p.key, p.opts...); dialErr == nil {
+				p.replace(c, fresh)
+				c = fresh
+			}
+		}
+		checked[c] = true
+		p.idle <- c
+	}
+	p.unhealthy.Store(!healthy)
+}
+
+func (p *Pool) replace(old, fresh *Client) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for i, c := range p.clients {
+		if c == old {
+			p.clients[i] = fresh
+		}
+	}
+	old.Close()
+	p.replaced.Add(1)
+}
+
+func (p *Pool) closeClients() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, c := range p.clients {
+		c.Close()
+	}
+}
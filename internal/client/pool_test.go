@@ -0,0 +1,257 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/thesimpledev/skvs/internal/encryption"
+	"github.com/thesimpledev/skvs/internal/protocol"
+)
+
+func TestClientDiscardsStaleResponses(t *testing.T) {
+	addr, _ := startHookServer(t, func(n int64) reply {
+		if n == 1 {
+			return reply{delay: 250 * time.Millisecond}
+		}
+		return reply{delay: 100 * time.Millisecond}
+	})
+
+	c, err := New(addr, testKey, WithRetryPolicy(RetryPolicy{MaxAttempts: 1, AttemptTimeout: 200 * time.Millisecond}))
+	if err != nil {
+		t.Fatalf("new: %v", err)
+	}
+	defer c.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	// The first GET times out; its late answer arrives while the SET below is
+	// waiting and must not be taken for the SET's response.
+	_, _ = c.Send(ctx, protocol.FrameDTO{Cmd: protocol.CMD_GET, Key: "slow"})
+
+	result, err := c.Send(ctx, protocol.FrameDTO{Cmd: protocol.CMD_SET, Key: "cat", Value: []byte("jack"), Old: true})
+	if err != nil {
+		t.Fatalf("set: %v", err)
+	}
+	if result.Value != "" || !result.Found {
+		t.Errorf("set with old on a new key: want empty previous value, got %+v", result)
+	}
+	if c.Stale() == 0 {
+		t.Errorf("want the late GET response counted as stale")
+	}
+	if c.InFlight() != 0 {
+		t.Errorf("no request should be in flight, got %d", c.InFlight())
+	}
+}
+
+func TestClientDiscardsInvalidDatagrams(t *testing.T) {
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer conn.Close()
+	e, err := encryption.New(testKey)
+	if err != nil {
+		t.Fatalf("encryptor: %v", err)
+	}
+
+	// The server sends junk and a tampered copy of its answer ahead of the
+	// answer itself.
+	go func() {
+		buf := make([]byte, protocol.EncryptedFrameSize)
+		n, addr, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			return
+		}
+		payload, err := e.Decrypt(encryption.Request, buf[:n])
+		if err != nil {
+			return
+		}
+		request, err := protocol.FrameToDTO(payload)
+		if err != nil {
+			return
+		}
+		response := protocol.NewResponseDTO(protocol.STATUS_OK, []byte("PONG"))
+		response.RequestID = request.RequestID
+		encrypted, err := e.Encrypt(encryption.Response, protocol.ResponseDTOToFrame(response))
+		if err != nil {
+			return
+		}
+		tampered := bytes.Clone(encrypted)
+		tampered[len(tampered)-1] ^= 1
+		for _, datagram := range [][]byte{[]byte("junk"), tampered, encrypted} {
+			_, _ = conn.WriteToUDP(datagram, addr)
+		}
+	}()
+
+	c, err := New(conn.LocalAddr().String(), testKey, WithRetryPolicy(RetryPolicy{MaxAttempts: 1}))
+	if err != nil {
+		t.Fatalf("new: %v", err)
+	}
+	defer c.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	result, err := c.Send(ctx, protocol.FrameDTO{Cmd: protocol.CMD_PING})
+	if err != nil {
+		t.Fatalf("ping: %v", err)
+	}
+	if result.Value != "PONG" {
+		t.Errorf("want PONG, got %+v", result)
+	}
+	if got := c.Invalid(); got != 2 {
+		t.Errorf("want 2 invalid datagrams counted, got %d", got)
+	}
+}
+
+func TestPoolConcurrentSends(t *testing.T) {
+	addr, _ := startTestServer(t, 0)
+
+	p, err := NewPool(addr, testKey, PoolOptions{Size: 4, HealthInterval: -1})
+	if err != nil {
+		t.Fatalf("new pool: %v", err)
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 64)
+	for i := range 64 {
+		wg.Go(func() {
+			ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+			defer cancel()
+
+			key := fmt.Sprintf("key-%d", i)
+			if _, err := p.Send(ctx, protocol.FrameDTO{Cmd: protocol.CMD_SET, Key: key, Value: []byte(key)}); err != nil {
+				errs <- err
+				return
+			}
+			got, err := p.Send(ctx, protocol.FrameDTO{Cmd: protocol.CMD_GET, Key: key})
+			if err != nil {
+				errs <- err
+				return
+			}
+			if got.Value != key {
+				errs <- fmt.Errorf("get %s: got %q", key, got.Value)
+			}
+		})
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+
+	stats := p.Stats()
+	if stats.Size != 4 || stats.Idle != 4 || stats.InFlight != 0 {
+		t.Errorf("unexpected stats after all requests finished: %+v", stats)
+	}
+
+	if err := p.Close(context.Background()); err != nil {
+		t.Errorf("close: %v", err)
+	}
+	if _, err := p.Send(context.Background(), protocol.FrameDTO{Cmd: protocol.CMD_PING}); !errors.Is(err, ErrPoolClosed) {
+		t.Errorf("send after close: want ErrPoolClosed, got %v", err)
+	}
+}
+
+func TestPoolCloseWaitsForOutstanding(t *testing.T) {
+	addr, _ := startHookServer(t, func(int64) reply {
+		return reply{delay: 100 * time.Millisecond}
+	})
+
+	p, err := NewPool(addr, testKey, PoolOptions{Size: 1, HealthInterval: -1})
+	if err != nil {
+		t.Fatalf("new pool: %v", err)
+	}
+
+	sent := make(chan error, 1)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		_, err := p.Send(ctx, protocol.FrameDTO{Cmd: protocol.CMD_PING})
+		sent <- err
+	}()
+
+	for p.Stats().InFlight == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	if err := p.Close(context.Background()); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+	select {
+	case err := <-sent:
+		if err != nil {
+			t.Errorf("outstanding request should complete, got %v", err)
+		}
+	default:
+		t.Errorf("Close returned before the outstanding request finished")
+	}
+}
+
+func TestPoolCloseDeadline(t *testing.T) {
+	addr, _ := startTestServer(t, 1000)
+
+	p, err := NewPool(addr, testKey, PoolOptions{Size: 1, HealthInterval: -1})
+	if err != nil {
+		t.Fatalf("new pool: %v", err)
+	}
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+		defer cancel()
+		_, _ = p.Send(ctx, protocol.FrameDTO{Cmd: protocol.CMD_PING})
+	}()
+	for p.Stats().InFlight == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := p.Close(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("want deadline exceeded while a request is stuck, got %v", err)
+	}
+}
+
+func TestPoolHealthCheckReplacesDeadSockets(t *testing.T) {
+	addr, _ := startTestServer(t, 1000)
+
+	p, err := NewPool(addr, testKey, PoolOptions{Size: 2, HealthInterval: -1, HealthTimeout: 50 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("new pool: %v", err)
+	}
+	defer func() { _ = p.Close(context.Background()) }()
+
+	p.checkHealth()
+
+	stats := p.Stats()
+	if !stats.Unhealthy {
+		t.Errorf("pool should be unhealthy when pings go unanswered")
+	}
+	if stats.Replaced != 2 {
+		t.Errorf("want both sockets replaced, got %d", stats.Replaced)
+	}
+	if stats.Idle != 2 {
+		t.Errorf("replaced sockets should be back in the pool, got %d idle", stats.Idle)
+	}
+}
+
+func TestPoolHealthCheckHealthy(t *testing.T) {
+	addr, _ := startTestServer(t, 0)
+
+	p, err := NewPool(addr, testKey, PoolOptions{Size: 2, HealthInterval: -1})
+	if err != nil {
+		t.Fatalf("new pool: %v", err)
+	}
+	defer func() { _ = p.Close(context.Background()) }()
+
+	p.checkHealth()
+
+	if stats := p.Stats(); stats.Unhealthy || stats.Replaced != 0 {
+		t.Errorf("healthy pool reported %+v", stats)
+	}
+}
@@ -0,0 +1,146 @@
+package client
+
+import (
+	"math/rand/v2"
+	"sync"
+	"time"
+
+	"github.com/thesimpledev/skvs/internal/protocol"
+)
+
+// Attempt describes one send of a request and is passed to RetryPolicy.OnAttempt.
+type Attempt struct {
+	Number   int
+	Cmd      byte
+	Key      string
+	Backoff  time.Duration
+	Duration time.Duration
+	Err      error
+}
+
+// RetryPolicy controls how Send retries requests that got no usable answer.
+// Delays use exponential backoff with full jitter: the n-th retry sleeps a
+// random duration in [0, min(MaxDelay, BaseDelay*2^(n-1))].
+//
+// Requests that are not idempotent (see Idempotent) are sent once unless
+// RetryNonIdempotent is set, since a lost response does not mean the server
+// did not apply them. AttemptTimeout bounds each send separately from the
+// context deadline; zero means every attempt may use the whole deadline.
+type RetryPolicy struct {
+	MaxAttempts        int
+	BaseDelay          time.Duration
+	MaxDelay           time.Duration
+	AttemptTimeout     time.Duration
+	RetryNonIdempotent bool
+	Budget             *RetryBudget
+	OnAttempt          func(Attempt)
+}
+
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts: defaultMaxAttempts,
+		BaseDelay:   baseDelay,
+		MaxDelay:    time.Second,
+	}
+}
+
+func (p RetryPolicy) attempts(dto protocol.FrameDTO) int {
+	if !p.resends(dto) {
+		return 1
+	}
+	return max(p.MaxAttempts, 1)
+}
+
+// resends reports whether dto may be sent again when the server may already
+// have run it.
+func (p RetryPolicy) resends(dto protocol.FrameDTO) bool {
+	return p.RetryNonIdempotent || Idempotent(dto)
+}
+
+func (p RetryPolicy) backoff(retry int) time.Duration {
+	if retry <= 0 || p.BaseDelay <= 0 {
+		return 0
+	}
+
+	ceiling := p.MaxDelay
+	if shift := retry - 1; shift < 32 {
+		if d := p.BaseDelay << shift; d > 0 && (ceiling <= 0 || d < ceiling) {
+			ceiling = d
+		}
+	}
+	if ceiling <= 0 {
+		return 0
+	}
+	return rand.N(ceiling + 1)
+}
+
+// delay is the wait before the given retry. A retry-after hint from a busy
+// server is honoured with up to half of it again as jitter, so clients turned
+// away together do not all come back at once.
+func (p RetryPolicy) delay(retry int, retryAfter time.Duration) time.Duration {
+	if retryAfter > 0 {
+		return retryAfter + rand.N(retryAfter/2+1)
+	}
+	return p.backoff(retry)
+}
+
+func (p RetryPolicy) report(a Attempt) {
+	if p.OnAttempt != nil {
+		p.OnAttempt(a)
+	}
+}
+
+// Idempotent reports whether sending dto twice leaves the store in the same
+// state and yields the same response. DELETE and SET with Old are not: a
+// repeat would see the first attempt's effect.
+func Idempotent(dto protocol.FrameDTO) bool {
+	switch dto.Cmd {
+	case protocol.CMD_DELETE:
+		return false
+	case protocol.CMD_SET:
+		return !dto.Old
+	default:
+		return true
+	}
+}
+
+// RetryBudget caps retries across every request that shares it, using the
+// token scheme from gRPC retry throttling. Each failed attempt costs one
+// token and each success refunds Ratio tokens; retries are only allowed while
+// more than half of MaxTokens remain. This keeps a struggling server from
+// being hit by a retry storm.
+type RetryBudget struct {
+	mu        sync.Mutex
+	tokens    float64
+	maxTokens float64
+	ratio     float64
+}
+
+func NewRetryBudget(maxTokens, ratio float64) *RetryBudget {
+	return &RetryBudget{tokens: maxTokens, maxTokens: maxTokens, ratio: ratio}
+}
+
+func (b *RetryBudget) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.tokens > b.maxTokens/2
+}
+
+func (b *RetryBudget) success() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.tokens = min(b.tokens+b.ratio, b.maxTokens)
+}
+
+func (b *RetryBudget) failure() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.tokens = max(b.tokens-1, 0)
+}
+
+// Tokens returns the tokens currently left in the budget.
+func (b *RetryBudget) Tokens() float64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.tokens
+}
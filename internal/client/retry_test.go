@@ -0,0 +1,285 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/thesimpledev/skvs/internal/encryption"
+	"github.com/thesimpledev/skvs/internal/protocol"
+	"github.com/thesimpledev/skvs/internal/skvs"
+)
+
+var testKey = []byte("12345678901234567890123456789012")
+
+// startTestServer runs a loopback server on the real encryption and store
+// path. It silently drops the first drop datagrams it receives.
+func startTestServer(t *testing.T, drop int) (string, *atomic.Int64) {
+	t.Helper()
+	return startHookServer(t, func(n int64) reply {
+		return reply{drop: n <= int64(drop)}
+	})
+}
+
+// reply is what a hook server does with a datagram: drop it, or answer it
+// after delay, with replace instead of the store's answer if it is set.
+type reply struct {
+	drop    bool
+	delay   time.Duration
+	replace *protocol.ResponseDTO
+}
+
+// startHookServer is startTestServer with a hook that decides the reply to
+// the n-th datagram.
+func startHookServer(t *testing.T, hook func(n int64) reply) (string, *atomic.Int64) {
+	t.Helper()
+
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+
+	e, err := encryption.New(testKey)
+	if err != nil {
+		t.Fatalf("encryptor: %v", err)
+	}
+	app := skvs.New(slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	received := &atomic.Int64{}
+	go func() {
+		buf := make([]byte, protocol.EncryptedFrameSize)
+		for {
+			n, addr, err := conn.ReadFromUDP(buf)
+			if err != nil {
+				return
+			}
+			r := hook(received.Add(1))
+			if r.drop {
+				continue
+			}
+			payload, err := e.Decrypt(encryption.Request, buf[:n])
+			if err != nil {
+				continue
+			}
+			var response []byte
+			if r.replace != nil {
+				request, _ := protocol.FrameToDTO(payload)
+				dto := *r.replace
+				dto.RequestID = request.RequestID
+				response = protocol.ResponseDTOToFrame(dto)
+			} else if response, err = skvs.ProcessMessage(app, payload); err != nil {
+				continue
+			}
+			encrypted, err := e.Encrypt(encryption.Response, response)
+			if err != nil {
+				continue
+			}
+			time.AfterFunc(r.delay, func() {
+				_, _ = conn.WriteToUDP(encrypted, addr)
+			})
+		}
+	}()
+
+	return conn.LocalAddr().String(), received
+}
+
+func TestBackoffFullJitter(t *testing.T) {
+	p := RetryPolicy{BaseDelay: 10 * time.Millisecond, MaxDelay: 50 * time.Millisecond}
+
+	if got := p.backoff(0); got != 0 {
+		t.Errorf("first attempt should not wait, got %v", got)
+	}
+
+	for retry, ceiling := range map[int]time.Duration{
+		1:  10 * time.Millisecond,
+		2:  20 * time.Millisecond,
+		3:  40 * time.Millisecond,
+		4:  50 * time.Millisecond,
+		60: 50 * time.Millisecond,
+	} {
+		for range 100 {
+			if got := p.backoff(retry); got < 0 || got > ceiling {
+				t.Fatalf("retry %d: backoff %v outside [0, %v]", retry, got, ceiling)
+			}
+		}
+	}
+}
+
+func TestIdempotent(t *testing.T) {
+	tests := []struct {
+		name string
+		dto  protocol.FrameDTO
+		want bool
+	}{
+		{name: "get", dto: protocol.FrameDTO{Cmd: protocol.CMD_GET}, want: true},
+		{name: "exists", dto: protocol.FrameDTO{Cmd: protocol.CMD_EXISTS}, want: true},
+		{name: "info", dto: protocol.FrameDTO{Cmd: protocol.CMD_INFO}, want: true},
+		{name: "set", dto: protocol.FrameDTO{Cmd: protocol.CMD_SET}, want: true},
+		{name: "set overwrite", dto: protocol.FrameDTO{Cmd: protocol.CMD_SET, Overwrite: true}, want: true},
+		{name: "set old", dto: protocol.FrameDTO{Cmd: protocol.CMD_SET, Old: true}, want: false},
+		{name: "delete", dto: protocol.FrameDTO{Cmd: protocol.CMD_DELETE}, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Idempotent(tt.dto); got != tt.want {
+				t.Errorf("Idempotent() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRetryBudget(t *testing.T) {
+	b := NewRetryBudget(4, 0.5)
+
+	b.failure()
+	if !b.allow() {
+		t.Errorf("3 of 4 tokens left: retries should be allowed")
+	}
+
+	b.failure()
+	if b.allow() {
+		t.Errorf("2 of 4 tokens left: retries should be refused")
+	}
+
+	b.success()
+	if !b.allow() {
+		t.Errorf("2.5 of 4 tokens left: retries should be allowed")
+	}
+
+	for range 10 {
+		b.success()
+	}
+	if got := b.Tokens(); got != 4 {
+		t.Errorf("tokens should be capped at 4, got %v", got)
+	}
+}
+
+func TestSendRetriesDroppedPackets(t *testing.T) {
+	addr, received := startTestServer(t, 2)
+
+	var mu sync.Mutex
+	var attempts []Attempt
+	policy := RetryPolicy{
+		MaxAttempts:    5,
+		BaseDelay:      time.Millisecond,
+		MaxDelay:       5 * time.Millisecond,
+		AttemptTimeout: 50 * time.Millisecond,
+		OnAttempt: func(a Attempt) {
+			mu.Lock()
+			defer mu.Unlock()
+			attempts = append(attempts, a)
+		},
+	}
+
+	c, err := New(addr, testKey, WithRetryPolicy(policy))
+	if err != nil {
+		t.Fatalf("new: %v", err)
+	}
+	defer c.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	result, err := c.Send(ctx, protocol.FrameDTO{Cmd: protocol.CMD_SET, Key: "cat", Value: []byte("jack")})
+	if err != nil {
+		t.Fatalf("send: %v", err)
+	}
+	if result.Value != "jack" {
+		t.Errorf("want value jack, got %q", result.Value)
+	}
+	if got := received.Load(); got != 3 {
+		t.Errorf("server should have seen 3 datagrams, got %d", got)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(attempts) != 3 {
+		t.Fatalf("want 3 reported attempts, got %d", len(attempts))
+	}
+	for i, a := range attempts {
+		if a.Number != i+1 {
+			t.Errorf("attempt %d: number %d", i, a.Number)
+		}
+		if (a.Err == nil) != (i == 2) {
+			t.Errorf("attempt %d: unexpected err %v", i, a.Err)
+		}
+	}
+}
+
+func TestSendDoesNotRetryNonIdempotent(t *testing.T) {
+	addr, received := startTestServer(t, 1)
+
+	c, err := New(addr, testKey, WithRetryPolicy(RetryPolicy{
+		MaxAttempts:    5,
+		AttemptTimeout: 50 * time.Millisecond,
+	}))
+	if err != nil {
+		t.Fatalf("new: %v", err)
+	}
+	defer c.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	_, err = c.Send(ctx, protocol.FrameDTO{Cmd: protocol.CMD_DELETE, Key: "cat"})
+	if err == nil {
+		t.Fatalf("want error when the only attempt is dropped")
+	}
+	if got := received.Load(); got != 1 {
+		t.Errorf("delete should be sent once, server saw %d", got)
+	}
+}
+
+func TestSendNotFoundIsNotRetried(t *testing.T) {
+	addr, received := startTestServer(t, 0)
+
+	c, err := New(addr, testKey)
+	if err != nil {
+		t.Fatalf("new: %v", err)
+	}
+	defer c.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	_, err = c.Send(ctx, protocol.FrameDTO{Cmd: protocol.CMD_GET, Key: "missing"})
+	if !errors.Is(err, ErrNotFound) {
+		t.Fatalf("want ErrNotFound, got %v", err)
+	}
+	if got := received.Load(); got != 1 {
+		t.Errorf("not found is an answer, server saw %d datagrams", got)
+	}
+}
+
+func TestSendStopsWhenBudgetExhausted(t *testing.T) {
+	addr, received := startTestServer(t, 100)
+
+	c, err := New(addr, testKey, WithRetryPolicy(RetryPolicy{
+		MaxAttempts:    10,
+		AttemptTimeout: 20 * time.Millisecond,
+		Budget:         NewRetryBudget(2, 0.1),
+	}))
+	if err != nil {
+		t.Fatalf("new: %v", err)
+	}
+	defer c.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	_, err = c.Send(ctx, protocol.FrameDTO{Cmd: protocol.CMD_GET, Key: "cat"})
+	if err == nil {
+		t.Fatalf("want error")
+	}
+	if got := received.Load(); got != 1 {
+		t.Errorf("budget should allow no retries once half spent, server saw %d", got)
+	}
+}
@@ -0,0 +1,179 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/thesimpledev/skvs/internal/encryption"
+	"github.com/thesimpledev/skvs/internal/protocol"
+)
+
+// WithSessions makes the client run a handshake before its first request:
+// an X25519 exchange sealed with the pre-shared key, after which requests are
+// sealed with a session key that a later leak of the pre-shared key does not
+// reveal. The client rekeys at half of the lifetime the server grants, and
+// handshakes again if the server has lost the session, as after a restart.
+func WithSessions() Option {
+	return func(c *Client) {
+		c.sessions = &sessionState{}
+	}
+}
+
+// sessionState holds the current session and the one before it, which is
+// kept so that responses to requests sealed just before a rekey still open.
+type sessionState struct {
+	mu       sync.Mutex
+	current  *session
+	previous *session
+}
+
+type session struct {
+	encryptor encryption.Encryptor
+	rekeyAt   time.Time
+	expires   time.Time
+}
+
+// due reports whether a handshake is needed: required when there is no
+// usable session, due as well when the current one should be replaced but
+// may still be used meanwhile.
+func (s *sessionState) due(now time.Time) (required, due bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.current == nil || now.After(s.current.expires) {
+		return true, true
+	}
+	return false, now.After(s.current.rekeyAt)
+}
+
+// drop forgets session id once the server has said it no longer has it.
+func (s *sessionState) drop(id uint32) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.current != nil && s.current.encryptor.KeyID() == id {
+		s.current = nil
+	}
+	if s.previous != nil && s.previous.encryptor.KeyID() == id {
+		s.previous = nil
+	}
+}
+
+// sealer returns the encryptor for a request with command cmd: the current
+// session's, or the pre-shared key's for a handshake or without a session.
+func (c *Client) sealer(cmd byte) encryption.Encryptor {
+	if c.sessions == nil || cmd == protocol.CMD_HANDSHAKE {
+		return c.encryptor
+	}
+	c.sessions.mu.Lock()
+	defer c.sessions.mu.Unlock()
+	if c.sessions.current != nil {
+		return c.sessions.current.encryptor
+	}
+	return c.encryptor
+}
+
+// opener returns the encryptor for a response: the session named in its
+// header if the client still has it, otherwise the pre-shared key's under the
+// suite the header names.
+func (c *Client) opener(message []byte) encryption.Encryptor {
+	h, err := encryption.ParseHeader(message)
+	if err != nil {
+		return c.encryptor
+	}
+	if c.refusals != nil && h.Suite == encryption.AES256GCM {
+		return c.refusals
+	}
+	if c.sessions == nil {
+		return c.encryptor
+	}
+	c.sessions.mu.Lock()
+	defer c.sessions.mu.Unlock()
+	if s := c.sessions.current; s != nil && s.encryptor.KeyID() == h.KeyID {
+		return s.encryptor
+	}
+	if s := c.sessions.previous; s != nil && s.encryptor.KeyID() == h.KeyID {
+		return s.encryptor
+	}
+	return c.encryptor
+}
+
+func newHandshakeRequest() (*encryption.Handshake, protocol.FrameDTO, error) {
+	h, err := encryption.NewHandshake()
+	if err != nil {
+		return nil, protocol.FrameDTO{}, err
+	}
+	return h, protocol.FrameDTO{Cmd: protocol.CMD_HANDSHAKE, Value: h.PublicKey()}, nil
+}
+
+// finishHandshake derives the session from the server's answer and makes
+// it current.
+func (c *Client) finishHandshake(h *encryption.Handshake, value []byte) error {
+	serverPublic, id, lifetime, err := protocol.UnpackSession(value)
+	if err != nil {
+		return err
+	}
+	key, err := h.SessionKey(c.psk, h.PublicKey(), serverPublic, id)
+	if err != nil {
+		return err
+	}
+	e, err := encryption.NewSession(c.suite, key, id)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	c.sessions.mu.Lock()
+	defer c.sessions.mu.Unlock()
+	c.sessions.previous = c.sessions.current
+	c.sessions.current = &session{encryptor: e, rekeyAt: now.Add(lifetime / 2), expires: now.Add(lifetime)}
+	return nil
+}
+
+// ensureSession runs a handshake when the client has no session or the
+// current one is due for rekeying. A failed rekey is not an error while the
+// current session is still valid; the next request tries again. The caller
+// holds c.mu.
+func (c *Client) ensureSession(ctx context.Context) error {
+	required, due := c.sessions.due(time.Now())
+	if !due {
+		return nil
+	}
+	h, dto, err := newHandshakeRequest()
+	if err == nil {
+		var result Result
+		if result, err = c.send(ctx, dto); err == nil {
+			err = c.finishHandshake(h, []byte(result.Value))
+		}
+	}
+	if err != nil && required {
+		return fmt.Errorf("handshake: %w", err)
+	}
+	return nil
+}
+
+// sendInSession sends dto under the current session, handshaking first if
+// needed, and once more if the server answers that it has lost the session.
+// That answer is not authenticated against the request, so the server may
+// have run it after all: a request the retry policy would not resend is not
+// resent here either, and fails with ErrSessionExpired. The caller holds c.mu.
+func (c *Client) sendInSession(ctx context.Context, dto protocol.FrameDTO) (Result, error) {
+	if err := c.ensureSession(ctx); err != nil {
+		return Result{}, err
+	}
+	keyID := c.sealer(dto.Cmd).KeyID()
+	result, err := c.send(ctx, dto)
+	if !errors.Is(err, ErrSessionExpired) {
+		return result, err
+	}
+
+	c.sessions.drop(keyID)
+	if !c.retry.resends(dto) {
+		return result, err
+	}
+	if err := c.ensureSession(ctx); err != nil {
+		return Result{}, err
+	}
+	return c.send(ctx, dto)
+}
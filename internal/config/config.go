@@ -0,0 +1,419 @@
+// Package config loads the server configuration from defaults, an optional
+// JSON file, environment variables and command-line flags, in that order of
+// precedence.
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"os"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/thesimpledev/skvs/internal/encryption"
+	"github.com/thesimpledev/skvs/internal/protocol"
+)
+
+// Config is the complete server configuration. Fields marked hot in
+// settings are applied on reload; the rest need a restart.
+type Config struct {
+	Addr             string   `json:"addr"`
+	MetricsAddr      string   `json:"metrics_addr"`
+	EncryptionKey    string   `json:"encryption_key"`
+	KeyFile          string   `json:"key_file"`
+	Passphrase       string   `json:"passphrase"`
+	KDF              string   `json:"kdf"`
+	CipherSuites     string   `json:"cipher_suites"`
+	SessionTTL       Duration `json:"session_ttl"`
+	RequireSession   bool     `json:"require_session"`
+	MaxConcurrency   int      `json:"max_concurrency"`
+	Workers          int      `json:"workers"`
+	Readers          int      `json:"readers"`
+	ReadTimeout      Duration `json:"read_timeout"`
+	LogLevel         string   `json:"log_level"`
+	SnapshotPath     string   `json:"snapshot_path"`
+	SnapshotInterval Duration `json:"snapshot_interval"`
+	MaxKeys          int      `json:"max_keys"`
+	MaxMemoryBytes   int64    `json:"max_memory_bytes"`
+	ShutdownTimeout  Duration `json:"shutdown_timeout"`
+	BusyRetryAfter   Duration `json:"busy_retry_after"`
+	RateLimit        float64  `json:"rate_limit"`
+	RateBurst        int      `json:"rate_burst"`
+	TenantSeparator  string   `json:"tenant_separator"`
+	TenantMaxKeys    int      `json:"tenant_max_keys"`
+	TenantMaxBytes   int64    `json:"tenant_max_bytes"`
+}
+
+func Default() Config {
+	return Config{
+		Addr:             fmt.Sprintf(":%d", protocol.Port),
+		MetricsAddr:      ":9090",
+		CipherSuites:     "aes-256-gcm,chacha20-poly1305,xchacha20-poly1305",
+		SessionTTL:       Duration(time.Hour),
+		MaxConcurrency:   1000,
+		Readers:          1,
+		ReadTimeout:      Duration(100 * time.Millisecond),
+		LogLevel:         "info",
+		SnapshotInterval: Duration(time.Minute),
+		ShutdownTimeout:  Duration(10 * time.Second),
+		BusyRetryAfter:   Duration(10 * time.Millisecond),
+		RateBurst:        100,
+		TenantSeparator:  ":",
+	}
+}
+
+// Duration is a time.Duration that reads and writes as a string such as
+// "100ms" in JSON.
+type Duration time.Duration
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return fmt.Errorf("duration must be a string such as \"100ms\": %w", err)
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
+
+// setting ties one Config field to its flag and environment variable.
+type setting struct {
+	flag string
+	env  string
+	help string
+	hot  bool
+	set  func(c *Config, v string) error
+	get  func(c Config) any
+}
+
+var settings = []setting{
+	{flag: "addr", env: "SKVS_ADDR", help: "UDP address to listen on",
+		set: func(c *Config, v string) error { c.Addr = v; return nil },
+		get: func(c Config) any { return c.Addr }},
+	{flag: "metrics-addr", env: "METRICS_ADDR", help: "HTTP address for /metrics; empty disables it",
+		set: func(c *Config, v string) error { c.MetricsAddr = v; return nil },
+		get: func(c Config) any { return c.MetricsAddr }},
+	{flag: "encryption-key", env: "SKVS_ENCRYPTION_KEY", help: "32-byte encryption key; prefer the environment variable",
+		set: func(c *Config, v string) error { c.EncryptionKey = v; return nil },
+		get: func(c Config) any { return c.EncryptionKey }},
+	{flag: "key-file", env: "SKVS_KEY_FILE", help: "File holding the key as hex or base64, as written by keygen",
+		set: func(c *Config, v string) error { c.KeyFile = v; return nil },
+		get: func(c Config) any { return c.KeyFile }},
+	{flag: "passphrase", env: "SKVS_PASSPHRASE", help: "Passphrase to derive the key from with kdf; prefer the environment variable",
+		set: func(c *Config, v string) error { c.Passphrase = v; return nil },
+		get: func(c Config) any { return c.Passphrase }},
+	{flag: "kdf", env: "SKVS_KDF", help: "Argon2id or scrypt parameters and salt for passphrase, as printed by keygen",
+		set: func(c *Config, v string) error { c.KDF = v; return nil },
+		get: func(c Config) any { return c.KDF }},
+	{flag: "cipher-suites", env: "SKVS_CIPHER_SUITES", help: "Comma-separated cipher suites clients may use; must include aes-256-gcm",
+		set: func(c *Config, v string) error { c.CipherSuites = v; return nil },
+		get: func(c Config) any { return c.CipherSuites }},
+	{flag: "session-ttl", env: "SKVS_SESSION_TTL", help: "Lifetime of a session key; clients rekey at half of it", hot: true,
+		set: func(c *Config, v string) error { return setDuration(&c.SessionTTL, v) },
+		get: func(c Config) any { return c.SessionTTL }},
+	{flag: "require-session", env: "SKVS_REQUIRE_SESSION", help: "Refuse requests sealed with the pre-shared key instead of a session key", hot: true,
+		set: func(c *Config, v string) error { return setBool(&c.RequireSession, v) },
+		get: func(c Config) any { return c.RequireSession }},
+	{flag: "max-concurrency", env: "SKVS_MAX_CONCURRENCY", help: "Requests queued or being handled at once; more are answered BUSY",
+		set: func(c *Config, v string) error { return setInt(&c.MaxConcurrency, v) },
+		get: func(c Config) any { return c.MaxConcurrency }},
+	{flag: "workers", env: "SKVS_WORKERS", help: "Goroutines handling requests; 0 uses GOMAXPROCS",
+		set: func(c *Config, v string) error { return setInt(&c.Workers, v) },
+		get: func(c Config) any { return c.Workers }},
+	{flag: "readers", env: "SKVS_READERS", help: "Sockets reading requests; more than 1 uses SO_REUSEPORT",
+		set: func(c *Config, v string) error { return setInt(&c.Readers, v) },
+		get: func(c Config) any { return c.Readers }},
+	{flag: "read-timeout", env: "SKVS_READ_TIMEOUT", help: "How often the read loop wakes to check for shutdown", hot: true,
+		set: func(c *Config, v string) error { return setDuration(&c.ReadTimeout, v) },
+		get: func(c Config) any { return c.ReadTimeout }},
+	{flag: "log-level", env: "SKVS_LOG_LEVEL", help: "debug, info, warn or error", hot: true,
+		set: func(c *Config, v string) error { c.LogLevel = v; return nil },
+		get: func(c Config) any { return c.LogLevel }},
+	{flag: "snapshot-path", env: "SKVS_SNAPSHOT_PATH", help: "File to persist the store to; empty keeps data in memory only",
+		set: func(c *Config, v string) error { c.SnapshotPath = v; return nil },
+		get: func(c Config) any { return c.SnapshotPath }},
+	{flag: "snapshot-interval", env: "SKVS_SNAPSHOT_INTERVAL", help: "How often to write a snapshot when data changed", hot: true,
+		set: func(c *Config, v string) error { return setDuration(&c.SnapshotInterval, v) },
+		get: func(c Config) any { return c.SnapshotInterval }},
+	{flag: "max-keys", env: "SKVS_MAX_KEYS", help: "Most keys stored; 0 is unlimited", hot: true,
+		set: func(c *Config, v string) error { return setInt(&c.MaxKeys, v) },
+		get: func(c Config) any { return c.MaxKeys }},
+	{flag: "max-memory-bytes", env: "SKVS_MAX_MEMORY_BYTES", help: "Most key and value bytes stored; 0 is unlimited", hot: true,
+		set: func(c *Config, v string) error { return setInt64(&c.MaxMemoryBytes, v) },
+		get: func(c Config) any { return c.MaxMemoryBytes }},
+	{flag: "shutdown-timeout", env: "SKVS_SHUTDOWN_TIMEOUT", help: "How long to wait for in-flight requests when stopping", hot: true,
+		set: func(c *Config, v string) error { return setDuration(&c.ShutdownTimeout, v) },
+		get: func(c Config) any { return c.ShutdownTimeout }},
+	{flag: "busy-retry-after", env: "SKVS_BUSY_RETRY_AFTER", help: "Delay suggested to clients turned away because every handler is busy", hot: true,
+		set: func(c *Config, v string) error { return setDuration(&c.BusyRetryAfter, v) },
+		get: func(c Config) any { return c.BusyRetryAfter }},
+	{flag: "rate-limit", env: "SKVS_RATE_LIMIT", help: "Requests per second allowed from each source IP; 0 is unlimited", hot: true,
+		set: func(c *Config, v string) error { return setFloat(&c.RateLimit, v) },
+		get: func(c Config) any { return c.RateLimit }},
+	{flag: "rate-burst", env: "SKVS_RATE_BURST", help: "Requests a source IP may send at once before rate-limit applies", hot: true,
+		set: func(c *Config, v string) error { return setInt(&c.RateBurst, v) },
+		get: func(c Config) any { return c.RateBurst }},
+	{flag: "tenant-separator", env: "SKVS_TENANT_SEPARATOR", help: "A key's tenant is the part before this separator", hot: true,
+		set: func(c *Config, v string) error { c.TenantSeparator = v; return nil },
+		get: func(c Config) any { return c.TenantSeparator }},
+	{flag: "tenant-max-keys", env: "SKVS_TENANT_MAX_KEYS", help: "Most keys stored per tenant; 0 is unlimited", hot: true,
+		set: func(c *Config, v string) error { return setInt(&c.TenantMaxKeys, v) },
+		get: func(c Config) any { return c.TenantMaxKeys }},
+	{flag: "tenant-max-bytes", env: "SKVS_TENANT_MAX_BYTES", help: "Most key and value bytes stored per tenant; 0 is unlimited", hot: true,
+		set: func(c *Config, v string) error { return setInt64(&c.TenantMaxBytes, v) },
+		get: func(c Config) any { return c.TenantMaxBytes }},
+}
+
+// Load builds the configuration from args (without the program name) and
+// getenv. The file named by --config or SKVS_CONFIG is read first, then
+// environment variables and finally flags override it. PORT is still honoured
+// for compatibility and means listening on that port on all interfaces.
+func Load(args []string, getenv func(string) string) (Config, error) {
+	fs := flag.NewFlagSet("skvs", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	path := fs.String("config", getenv("SKVS_CONFIG"), "JSON configuration file (env SKVS_CONFIG)")
+
+	type flagValue struct {
+		s     setting
+		value string
+	}
+	var flagValues []flagValue
+	for _, s := range settings {
+		fs.Func(s.flag, fmt.Sprintf("%s (env %s)", s.help, s.env), func(v string) error {
+			flagValues = append(flagValues, flagValue{s: s, value: v})
+			return nil
+		})
+	}
+	if err := fs.Parse(args); err != nil {
+		return Config{}, err
+	}
+
+	cfg := Default()
+	if *path != "" {
+		if err := cfg.readFile(*path); err != nil {
+			return Config{}, err
+		}
+	}
+
+	if port := getenv("PORT"); port != "" {
+		cfg.Addr = ":" + port
+	}
+	for _, s := range settings {
+		if v := getenv(s.env); v != "" {
+			if err := s.set(&cfg, v); err != nil {
+				return Config{}, fmt.Errorf("%s: %w", s.env, err)
+			}
+		}
+	}
+
+	for _, fv := range flagValues {
+		if err := fv.s.set(&cfg, fv.value); err != nil {
+			return Config{}, fmt.Errorf("--%s: %w", fv.s.flag, err)
+		}
+	}
+
+	return cfg, cfg.Validate()
+}
+
+// Usage writes the flag reference, including defaults, to w.
+func Usage(w io.Writer) {
+	def := Default()
+	fmt.Fprintln(w, "Usage: server [flags]")
+	fmt.Fprintln(w, "  --config string\n\tJSON configuration file (env SKVS_CONFIG)")
+	for _, s := range settings {
+		fmt.Fprintf(w, "  --%s\n\t%s (env %s, default %v)\n", s.flag, s.help, s.env, s.get(def))
+	}
+}
+
+func (c *Config) readFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("read config: %w", err)
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(c); err != nil {
+		return fmt.Errorf("parse config %s: %w", path, err)
+	}
+	return nil
+}
+
+func (c Config) Validate() error {
+	var errs []error
+	if _, _, err := net.SplitHostPort(c.Addr); err != nil {
+		errs = append(errs, fmt.Errorf("addr: %w", err))
+	}
+	if _, _, err := net.SplitHostPort(c.MetricsAddr); c.MetricsAddr != "" && err != nil {
+		errs = append(errs, fmt.Errorf("metrics_addr: %w", err))
+	}
+	errs = append(errs, c.validateKey()...)
+	if suites, err := encryption.ParseSuites(c.CipherSuites); err != nil {
+		errs = append(errs, fmt.Errorf("cipher_suites: %w", err))
+	} else if !slices.Contains(suites, encryption.AES256GCM) {
+		// Clients default to it, and refusals of other suites are sealed
+		// with it.
+		errs = append(errs, fmt.Errorf("cipher_suites: must include %s", encryption.AES256GCM))
+	}
+	if c.SessionTTL < Duration(2*time.Second) {
+		errs = append(errs, fmt.Errorf("session_ttl: must be at least 2s"))
+	}
+	if c.MaxConcurrency < 1 {
+		errs = append(errs, fmt.Errorf("max_concurrency: must be at least 1"))
+	}
+	if c.Workers < 0 {
+		errs = append(errs, fmt.Errorf("workers: cannot be negative"))
+	}
+	if c.Readers < 1 {
+		errs = append(errs, fmt.Errorf("readers: must be at least 1"))
+	}
+	if c.ReadTimeout <= 0 {
+		errs = append(errs, fmt.Errorf("read_timeout: must be positive"))
+	}
+	if _, err := c.Level(); err != nil {
+		errs = append(errs, fmt.Errorf("log_level: %w", err))
+	}
+	if c.SnapshotPath != "" && c.SnapshotInterval <= 0 {
+		errs = append(errs, fmt.Errorf("snapshot_interval: must be positive when snapshot_path is set"))
+	}
+	if c.ShutdownTimeout <= 0 {
+		errs = append(errs, fmt.Errorf("shutdown_timeout: must be positive"))
+	}
+	if c.BusyRetryAfter <= 0 {
+		errs = append(errs, fmt.Errorf("busy_retry_after: must be positive"))
+	}
+	if c.RateLimit < 0 {
+		errs = append(errs, fmt.Errorf("rate_limit: cannot be negative"))
+	}
+	if c.RateLimit > 0 && c.RateBurst < 1 {
+		errs = append(errs, fmt.Errorf("rate_burst: must be at least 1 when rate_limit is set"))
+	}
+	if c.TenantMaxKeys < 0 || c.TenantMaxBytes < 0 {
+		errs = append(errs, fmt.Errorf("tenant quotas cannot be negative"))
+	}
+	if c.TenantSeparator == "" && (c.TenantMaxKeys > 0 || c.TenantMaxBytes > 0) {
+		errs = append(errs, fmt.Errorf("tenant_separator: must be set when tenant quotas are"))
+	}
+	if c.MaxKeys < 0 {
+		errs = append(errs, fmt.Errorf("max_keys: cannot be negative"))
+	}
+	if c.MaxMemoryBytes < 0 {
+		errs = append(errs, fmt.Errorf("max_memory_bytes: cannot be negative"))
+	}
+	return errors.Join(errs...)
+}
+
+// validateKey checks that exactly one key source is set and is well formed.
+// Reading the key file and deriving from the passphrase wait for KeySource.
+func (c Config) validateKey() []error {
+	var errs []error
+	sources := 0
+	for _, v := range []string{c.EncryptionKey, c.KeyFile, c.Passphrase} {
+		if v != "" {
+			sources++
+		}
+	}
+	switch {
+	case sources == 0:
+		errs = append(errs, fmt.Errorf("encryption_key: one of encryption_key, key_file or passphrase is required"))
+	case sources > 1:
+		errs = append(errs, fmt.Errorf("encryption_key, key_file and passphrase are mutually exclusive"))
+	}
+	if c.EncryptionKey != "" && len(c.EncryptionKey) != encryption.KeySize {
+		errs = append(errs, fmt.Errorf("encryption_key: must be exactly %d bytes, got %d", encryption.KeySize, len(c.EncryptionKey)))
+	}
+	if c.Passphrase != "" && c.KDF == "" {
+		errs = append(errs, fmt.Errorf("kdf: required with passphrase"))
+	}
+	if c.KDF != "" {
+		if c.Passphrase == "" {
+			errs = append(errs, fmt.Errorf("kdf: only used with passphrase"))
+		}
+		if _, err := encryption.ParseKDFParams(c.KDF); err != nil {
+			errs = append(errs, fmt.Errorf("kdf: %w", err))
+		}
+	}
+	return errs
+}
+
+// KeySource is where the server gets its encryption key.
+func (c Config) KeySource() encryption.KeySource {
+	return encryption.KeySource{Raw: c.EncryptionKey, File: c.KeyFile, Passphrase: c.Passphrase, KDF: c.KDF}
+}
+
+func (c Config) Level() (slog.Level, error) {
+	var level slog.Level
+	err := level.UnmarshalText([]byte(c.LogLevel))
+	return level, err
+}
+
+// ColdChanges lists the settings that differ in next but cannot be applied
+// without a restart.
+func (c Config) ColdChanges(next Config) []string {
+	var changed []string
+	for _, s := range settings {
+		if !s.hot && s.get(c) != s.get(next) {
+			changed = append(changed, s.flag)
+		}
+	}
+	return changed
+}
+
+func setInt(dst *int, v string) error {
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		return err
+	}
+	*dst = n
+	return nil
+}
+
+func setInt64(dst *int64, v string) error {
+	n, err := strconv.ParseInt(v, 10, 64)
+	if err != nil {
+		return err
+	}
+	*dst = n
+	return nil
+}
+
+func setFloat(dst *float64, v string) error {
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		return err
+	}
+	*dst = f
+	return nil
+}
+
+func setBool(dst *bool, v string) error {
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		return err
+	}
+	*dst = b
+	return nil
+}
+
+func setDuration(dst *Duration, v string) error {
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		return err
+	}
+	*dst = Duration(d)
+	return nil
+}
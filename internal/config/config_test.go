@@ -0,0 +1,165 @@
+package config
+
+import (
+	"errors"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testKey = "12345678901234567890123456789012"
+
+func env(vars map[string]string) func(string) string {
+	return func(name string) string { return vars[name] }
+}
+
+func writeConfig(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "skvs.json")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+	return path
+}
+
+func TestLoadDefaults(t *testing.T) {
+	cfg, err := Load(nil, env(map[string]string{"SKVS_ENCRYPTION_KEY": testKey}))
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+
+	want := Default()
+	want.EncryptionKey = testKey
+	if cfg != want {
+		t.Errorf("want %+v, got %+v", want, cfg)
+	}
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	path := writeConfig(t, `{
+		"addr": ":5000",
+		"max_concurrency": 50,
+		"read_timeout": "250ms",
+		"log_level": "debug",
+		"max_keys": 10
+	}`)
+
+	cfg, err := Load(
+		[]string{"--config", path, "--max-keys", "30", "--log-level=warn"},
+		env(map[string]string{
+			"SKVS_ENCRYPTION_KEY":  testKey,
+			"SKVS_MAX_CONCURRENCY": "75",
+			"SKVS_MAX_KEYS":        "20",
+		}),
+	)
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		got  any
+		want any
+	}{
+		{name: "file", got: cfg.Addr, want: ":5000"},
+		{name: "file duration", got: time.Duration(cfg.ReadTimeout), want: 250 * time.Millisecond},
+		{name: "env over file", got: cfg.MaxConcurrency, want: 75},
+		{name: "flag over env", got: cfg.MaxKeys, want: 30},
+		{name: "flag over file", got: cfg.LogLevel, want: "warn"},
+		{name: "default", got: cfg.MetricsAddr, want: ":9090"},
+	}
+	for _, tt := range tests {
+		if tt.got != tt.want {
+			t.Errorf("%s: want %v, got %v", tt.name, tt.want, tt.got)
+		}
+	}
+}
+
+func TestLoadLegacyPort(t *testing.T) {
+	cfg, err := Load(nil, env(map[string]string{"SKVS_ENCRYPTION_KEY": testKey, "PORT": "4999"}))
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if cfg.Addr != ":4999" {
+		t.Errorf("want :4999, got %s", cfg.Addr)
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    []string
+		env     map[string]string
+		file    string
+		noKey   bool
+		wantErr string
+	}{
+		{name: "missing key", noKey: true, wantErr: "encryption_key"},
+		{name: "bad level", args: []string{"--log-level", "loud"}, wantErr: "log_level"},
+		{name: "bad int env", env: map[string]string{"SKVS_MAX_KEYS": "lots"}, wantErr: "SKVS_MAX_KEYS"},
+		{name: "bad duration flag", args: []string{"--read-timeout", "soon"}, wantErr: "--read-timeout"},
+		{name: "zero concurrency", args: []string{"--max-concurrency", "0"}, wantErr: "max_concurrency"},
+		{name: "zero shutdown timeout", args: []string{"--shutdown-timeout", "0s"}, wantErr: "shutdown_timeout"},
+		{name: "negative rate", args: []string{"--rate-limit", "-1"}, wantErr: "rate_limit"},
+		{name: "zero burst", args: []string{"--rate-limit", "10", "--rate-burst", "0"}, wantErr: "rate_burst"},
+		{name: "quota without separator", args: []string{"--tenant-max-keys", "5", "--tenant-separator", ""}, wantErr: "tenant_separator"},
+		{name: "two key sources", args: []string{"--key-file", "skvs.key"}, wantErr: "mutually exclusive"},
+		{name: "passphrase without kdf", env: map[string]string{"SKVS_ENCRYPTION_KEY": "", "SKVS_PASSPHRASE": "hunter2"}, wantErr: "kdf: required"},
+		{name: "bad kdf", env: map[string]string{"SKVS_ENCRYPTION_KEY": "", "SKVS_PASSPHRASE": "hunter2", "SKVS_KDF": "$md5$x"}, wantErr: "kdf: KDF parameters"},
+		{name: "kdf without passphrase", env: map[string]string{"SKVS_KDF": "$scrypt$ln=15,r=8,p=1$c2FsdHNhbHRzYWx0"}, wantErr: "only used with passphrase"},
+		{name: "unknown cipher suite", env: map[string]string{"SKVS_CIPHER_SUITES": "aes-256-gcm,rot13"}, wantErr: "cipher_suites"},
+		{name: "cipher suites without aes", env: map[string]string{"SKVS_CIPHER_SUITES": "chacha20-poly1305"}, wantErr: "must include aes-256-gcm"},
+		{name: "short session ttl", args: []string{"--session-ttl", "1s"}, wantErr: "session_ttl"},
+		{name: "bad bool env", env: map[string]string{"SKVS_REQUIRE_SESSION": "sometimes"}, wantErr: "SKVS_REQUIRE_SESSION"},
+		{name: "no readers", args: []string{"--readers", "0"}, wantErr: "readers"},
+		{name: "bad addr", args: []string{"--addr", "4040"}, wantErr: "addr"},
+		{name: "unknown file field", file: `{"adr": ":1"}`, wantErr: "unknown field"},
+		{name: "unknown flag", args: []string{"--nope"}, wantErr: "not defined"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			vars := map[string]string{"SKVS_ENCRYPTION_KEY": testKey}
+			if tt.noKey {
+				vars = map[string]string{}
+			}
+			for k, v := range tt.env {
+				vars[k] = v
+			}
+			args := tt.args
+			if tt.file != "" {
+				args = append(args, "--config", writeConfig(t, tt.file))
+			}
+
+			_, err := Load(args, env(vars))
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("want error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+
+	if _, err := Load([]string{"-h"}, env(nil)); !errors.Is(err, flag.ErrHelp) {
+		t.Errorf("-h: want flag.ErrHelp, got %v", err)
+	}
+}
+
+func TestColdChanges(t *testing.T) {
+	old := Default()
+	next := old
+	next.LogLevel = "debug"
+	next.MaxKeys = 5
+	next.ReadTimeout = Duration(time.Second)
+	if got := old.ColdChanges(next); len(got) != 0 {
+		t.Errorf("hot settings only: want no cold changes, got %v", got)
+	}
+
+	next.Addr = ":1"
+	next.MaxConcurrency = 2
+	got := old.ColdChanges(next)
+	if strings.Join(got, ",") != "addr,max-concurrency" {
+		t.Errorf("want addr and max-concurrency, got %v", got)
+	}
+}
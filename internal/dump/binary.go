@@ -0,0 +1,86 @@
+package dump
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// The binary format is a magic header followed by records of
+//
+//	key length (1 byte) | value length (2 bytes, LE) | key | value
+//
+// which is enough for the protocol's 128-byte keys and 859-byte values.
+var binaryMagic = []byte("SKVSDUMP\x01")
+
+type binaryEncoder struct {
+	w *bufio.Writer
+}
+
+func newBinaryEncoder(w io.Writer) (*binaryEncoder, error) {
+	bw := bufio.NewWriter(w)
+	if _, err := bw.Write(binaryMagic); err != nil {
+		return nil, err
+	}
+	return &binaryEncoder{w: bw}, nil
+}
+
+func (e *binaryEncoder) Encode(r Record) error {
+	if len(r.Key) == 0 || len(r.Key) > 0xff {
+		return fmt.Errorf("key length %d out of range", len(r.Key))
+	}
+	if len(r.Value) > 0xffff {
+		return fmt.Errorf("value for key %q too long: %d bytes", r.Key, len(r.Value))
+	}
+
+	var header [3]byte
+	header[0] = byte(len(r.Key))
+	binary.LittleEndian.PutUint16(header[1:], uint16(len(r.Value)))
+	if _, err := e.w.Write(header[:]); err != nil {
+		return err
+	}
+	if _, err := e.w.WriteString(r.Key); err != nil {
+		return err
+	}
+	_, err := e.w.Write(r.Value)
+	return err
+}
+
+func (e *binaryEncoder) Flush() error {
+	return e.w.Flush()
+}
+
+type binaryDecoder struct {
+	r *bufio.Reader
+}
+
+func newBinaryDecoder(r io.Reader) (*binaryDecoder, error) {
+	br := bufio.NewReader(r)
+	magic := make([]byte, len(binaryMagic))
+	if _, err := io.ReadFull(br, magic); err != nil {
+		return nil, fmt.Errorf("read header: %w", err)
+	}
+	if !bytes.Equal(magic, binaryMagic) {
+		return nil, fmt.Errorf("not a binary dump")
+	}
+	return &binaryDecoder{r: br}, nil
+}
+
+func (d *binaryDecoder) Decode() (Record, error) {
+	var header [3]byte
+	if _, err := io.ReadFull(d.r, header[:]); err != nil {
+		if errors.Is(err, io.EOF) {
+			return Record{}, io.EOF
+		}
+		return Record{}, fmt.Errorf("read record header: %w", err)
+	}
+
+	buf := make([]byte, int(header[0])+int(binary.LittleEndian.Uint16(header[1:])))
+	if _, err := io.ReadFull(d.r, buf); err != nil {
+		return Record{}, fmt.Errorf("read record: %w", io.ErrUnexpectedEOF)
+	}
+	return Record{Key: string(buf[:header[0]]), Value: buf[header[0]:]}, nil
+}
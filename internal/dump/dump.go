@@ -0,0 +1,177 @@
+// Package dump reads and writes key/value datasets in the formats used to
+// export and import a store: JSON lines, CSV and a compact binary format.
+package dump
+
+import (
+	"bufio"
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"unicode/utf8"
+)
+
+type Format string
+
+const (
+	JSONL  Format = "jsonl"
+	CSV    Format = "csv"
+	Binary Format = "binary"
+)
+
+// Text formats mark records whose key or value is not valid UTF-8 with this
+// encoding and store both base64-encoded.
+const encodingBase64 = "base64"
+
+type Record struct {
+	Key   string
+	Value []byte
+}
+
+type Encoder interface {
+	Encode(Record) error
+	// Flush writes any buffered records; call it once at the end.
+	Flush() error
+}
+
+type Decoder interface {
+	// Decode returns io.EOF after the last record.
+	Decode() (Record, error)
+}
+
+func ParseFormat(s string) (Format, error) {
+	switch f := Format(s); f {
+	case JSONL, CSV, Binary:
+		return f, nil
+	default:
+		return "", fmt.Errorf("unknown dump format %q (want jsonl, csv or binary)", s)
+	}
+}
+
+func NewEncoder(w io.Writer, format Format) (Encoder, error) {
+	switch format {
+	case JSONL:
+		bw := bufio.NewWriter(w)
+		return &jsonEncoder{w: bw, enc: json.NewEncoder(bw)}, nil
+	case CSV:
+		cw := csv.NewWriter(w)
+		if err := cw.Write([]string{"key", "value", "encoding"}); err != nil {
+			return nil, err
+		}
+		return &csvEncoder{w: cw}, nil
+	case Binary:
+		return newBinaryEncoder(w)
+	default:
+		return nil, fmt.Errorf("unknown dump format %q", format)
+	}
+}
+
+func NewDecoder(r io.Reader, format Format) (Decoder, error) {
+	switch format {
+	case JSONL:
+		return &jsonDecoder{dec: json.NewDecoder(r)}, nil
+	case CSV:
+		cr := csv.NewReader(r)
+		cr.FieldsPerRecord = 3
+		header, err := cr.Read()
+		if err != nil {
+			return nil, fmt.Errorf("read csv header: %w", err)
+		}
+		if header[0] != "key" || header[1] != "value" || header[2] != "encoding" {
+			return nil, fmt.Errorf("unexpected csv header %v", header)
+		}
+		return &csvDecoder{r: cr}, nil
+	case Binary:
+		return newBinaryDecoder(r)
+	default:
+		return nil, fmt.Errorf("unknown dump format %q", format)
+	}
+}
+
+type textRecord struct {
+	Key      string `json:"key"`
+	Value    string `json:"value"`
+	Encoding string `json:"encoding,omitempty"`
+}
+
+func toText(r Record) textRecord {
+	if utf8.ValidString(r.Key) && utf8.Valid(r.Value) {
+		return textRecord{Key: r.Key, Value: string(r.Value)}
+	}
+	return textRecord{
+		Key:      base64.StdEncoding.EncodeToString([]byte(r.Key)),
+		Value:    base64.StdEncoding.EncodeToString(r.Value),
+		Encoding: encodingBase64,
+	}
+}
+
+func fromText(t textRecord) (Record, error) {
+	switch t.Encoding {
+	case "":
+		return Record{Key: t.Key, Value: []byte(t.Value)}, nil
+	case encodingBase64:
+		key, err := base64.StdEncoding.DecodeString(t.Key)
+		if err != nil {
+			return Record{}, fmt.Errorf("decode key: %w", err)
+		}
+		value, err := base64.StdEncoding.DecodeString(t.Value)
+		if err != nil {
+			return Record{}, fmt.Errorf("decode value for key %q: %w", key, err)
+		}
+		return Record{Key: string(key), Value: value}, nil
+	default:
+		return Record{}, fmt.Errorf("unknown encoding %q", t.Encoding)
+	}
+}
+
+type jsonEncoder struct {
+	w   *bufio.Writer
+	enc *json.Encoder
+}
+
+func (e *jsonEncoder) Encode(r Record) error {
+	return e.enc.Encode(toText(r))
+}
+
+func (e *jsonEncoder) Flush() error {
+	return e.w.Flush()
+}
+
+type jsonDecoder struct {
+	dec *json.Decoder
+}
+
+func (d *jsonDecoder) Decode() (Record, error) {
+	var t textRecord
+	if err := d.dec.Decode(&t); err != nil {
+		return Record{}, err
+	}
+	return fromText(t)
+}
+
+type csvEncoder struct {
+	w *csv.Writer
+}
+
+func (e *csvEncoder) Encode(r Record) error {
+	t := toText(r)
+	return e.w.Write([]string{t.Key, t.Value, t.Encoding})
+}
+
+func (e *csvEncoder) Flush() error {
+	e.w.Flush()
+	return e.w.Error()
+}
+
+type csvDecoder struct {
+	r *csv.Reader
+}
+
+func (d *csvDecoder) Decode() (Record, error) {
+	fields, err := d.r.Read()
+	if err != nil {
+		return Record{}, err
+	}
+	return fromText(textRecord{Key: fields[0], Value: fields[1], Encoding: fields[2]})
+}
@@ -0,0 +1,106 @@
+package dump
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+var records = []Record{
+	{Key: "cat", Value: []byte("jack")},
+	{Key: "quoted", Value: []byte(`say "hi", then, leave`)},
+	{Key: "multi", Value: []byte("line one\nline two")},
+	{Key: "binary", Value: []byte{0x00, 0xff, 0xfe, 0x01}},
+	{Key: "\xff\xfekey", Value: []byte("text")},
+}
+
+func TestRoundTrip(t *testing.T) {
+	for _, format := range []Format{JSONL, CSV, Binary} {
+		t.Run(string(format), func(t *testing.T) {
+			var buf bytes.Buffer
+			enc, err := NewEncoder(&buf, format)
+			if err != nil {
+				t.Fatalf("new encoder: %v", err)
+			}
+			for _, r := range records {
+				if err := enc.Encode(r); err != nil {
+					t.Fatalf("encode %q: %v", r.Key, err)
+				}
+			}
+			if err := enc.Flush(); err != nil {
+				t.Fatalf("flush: %v", err)
+			}
+
+			dec, err := NewDecoder(&buf, format)
+			if err != nil {
+				t.Fatalf("new decoder: %v", err)
+			}
+			var got []Record
+			for {
+				r, err := dec.Decode()
+				if errors.Is(err, io.EOF) {
+					break
+				}
+				if err != nil {
+					t.Fatalf("decode: %v", err)
+				}
+				got = append(got, r)
+			}
+
+			if !reflect.DeepEqual(got, records) {
+				t.Errorf("want %v, got %v", records, got)
+			}
+		})
+	}
+}
+
+func TestTextFormatsUseBase64OnlyWhenNeeded(t *testing.T) {
+	var buf bytes.Buffer
+	enc, _ := NewEncoder(&buf, JSONL)
+	_ = enc.Encode(Record{Key: "cat", Value: []byte("jack")})
+	_ = enc.Encode(Record{Key: "bin", Value: []byte{0xff}})
+	_ = enc.Flush()
+
+	want := `{"key":"cat","value":"jack"}
+{"key":"Ymlu","value":"/w==","encoding":"base64"}
+`
+	if got := buf.String(); got != want {
+		t.Errorf("want\n%s\ngot\n%s", want, got)
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		format Format
+		input  string
+	}{
+		{name: "bad magic", format: Binary, input: "NOTADUMP!"},
+		{name: "csv header", format: CSV, input: "a,b,c\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewDecoder(strings.NewReader(tt.input), tt.format); err == nil {
+				t.Errorf("want error")
+			}
+		})
+	}
+
+	dec, _ := NewDecoder(strings.NewReader(string(binaryMagic)+"\x03\x05\x00cat"), Binary)
+	if _, err := dec.Decode(); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("truncated record: want ErrUnexpectedEOF, got %v", err)
+	}
+
+	dec, _ = NewDecoder(strings.NewReader(`{"key":"a","value":"b","encoding":"rot13"}`), JSONL)
+	if _, err := dec.Decode(); err == nil {
+		t.Errorf("want error for unknown encoding")
+	}
+
+	if _, err := ParseFormat("xml"); err == nil {
+		t.Errorf("want error for unknown format")
+	}
+}
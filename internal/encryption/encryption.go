@@ -2,63 +2,150 @@
 package encryption
 
 import (
-	"crypto/aes"
 	"crypto/cipher"
 	"crypto/rand"
+	"encoding/binary"
 	"fmt"
-	"io"
+	"slices"
 
 	"github.com/thesimpledev/skvs/internal/protocol"
 )
 
-type Encryptor struct {
-	key   []byte
-	block cipher.Block
-	gcm   cipher.AEAD
+// Encryptor seals and opens frames under one suite and key. A sealed message
+// is the cleartext Header, then the nonce, then the ciphertext and tag. The
+// header names the suite so the receiver can tell which one to open it with,
+// and is authenticated along with the frame.
+type Encryptor interface {
+	Suite() Suite
+	// KeyID is the key ID in the headers of the messages it seals: KeyID of
+	// the key, or a session's ID.
+	KeyID() uint32
+	Encrypt(dir Direction, payload []byte) ([]byte, error)
+	Decrypt(dir Direction, payload []byte) ([]byte, error)
+
+	// EncryptTo and DecryptInto append to dst and return the extended slice.
+	// Given a dst with room for protocol.EncryptedFrameSize more bytes they
+	// do not allocate.
+	EncryptTo(dst []byte, dir Direction, payload []byte) ([]byte, error)
+	DecryptInto(dst []byte, dir Direction, payload []byte) ([]byte, error)
 }
 
-func New(key []byte) (*Encryptor, error) {
-	if len(key) != 32 {
-		return nil, fmt.Errorf("key must be exactly 32 bytes for AES-256-GCM")
-	}
+// New returns an AES-256-GCM encryptor, the suite every client and server
+// supports.
+func New(key []byte) (Encryptor, error) {
+	return NewSuite(AES256GCM, key)
+}
 
-	block, err := aes.NewCipher(key)
-	if err != nil {
-		return nil, fmt.Errorf("encryption: new cipher: %v", err)
+// NewSuite returns an encryptor for suite.
+func NewSuite(suite Suite, key []byte) (Encryptor, error) {
+	info, ok := suites[suite]
+	if !ok {
+		return nil, fmt.Errorf("encryption: unknown cipher suite %d", suite)
+	}
+	if len(key) != KeySize {
+		return nil, fmt.Errorf("key must be exactly %d bytes for %s", KeySize, info.name)
 	}
 
-	gcm, err := cipher.NewGCM(block)
+	aead, err := info.newAEAD(key)
 	if err != nil {
-		return nil, fmt.Errorf("encryption: new gcm: %v", err)
+		return nil, fmt.Errorf("encryption: new %s: %v", info.name, err)
 	}
+	return &aeadEncryptor{suite: suite, keyID: KeyID(key), aead: aead}, nil
+}
 
-	return &Encryptor{key: key, block: block, gcm: gcm}, nil
+type aeadEncryptor struct {
+	suite Suite
+	keyID uint32
+	aead  cipher.AEAD
 }
 
-func (e *Encryptor) Encrypt(payload []byte) ([]byte, error) {
-	nonce := make([]byte, e.gcm.NonceSize())
-	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+func (e *aeadEncryptor) Suite() Suite {
+	return e.suite
+}
+
+func (e *aeadEncryptor) KeyID() uint32 {
+	return e.keyID
+}
+
+func (e *aeadEncryptor) Encrypt(dir Direction, payload []byte) ([]byte, error) {
+	return e.EncryptTo(nil, dir, payload)
+}
+
+func (e *aeadEncryptor) EncryptTo(dst []byte, dir Direction, payload []byte) ([]byte, error) {
+	if len(payload) != protocol.FrameSize {
+		return nil, fmt.Errorf("encryption: payload must be a %d-byte frame, got %d", protocol.FrameSize, len(payload))
+	}
+	if dir != Request && dir != Response {
+		return nil, fmt.Errorf("encryption: unknown %s", dir)
+	}
+
+	start := len(dst)
+	dst = slices.Grow(dst, HeaderSize+e.aead.NonceSize()+len(payload)+e.aead.Overhead())
+	nonce := dst[start+HeaderSize : start+HeaderSize+e.aead.NonceSize()]
+	if _, err := rand.Read(nonce); err != nil {
 		return nil, fmt.Errorf("encryption: nonce: %v", err)
 	}
-	encryptedPayload := e.gcm.Seal(nonce, nonce, payload, nil)
+	return e.seal(dst, e.header(dir, payload), nonce, payload), nil
+}
 
-	if len(encryptedPayload) != protocol.EncryptedFrameSize {
-		return nil, fmt.Errorf("encrypted frame size mismatch: got %d want %d", len(encryptedPayload), protocol.EncryptedFrameSize)
+func (e *aeadEncryptor) header(dir Direction, frame []byte) Header {
+	return Header{
+		Suite:     e.suite,
+		Version:   ProtocolVersion,
+		Direction: dir,
+		KeyID:     e.keyID,
+		RequestID: binary.LittleEndian.Uint32(frame[dir.requestIDOffset():]),
 	}
+}
 
-	return encryptedPayload, nil
+// seal appends the message for payload under h and nonce to dst. nonce may
+// alias the bytes of dst just past the header, as it does in EncryptTo.
+func (e *aeadEncryptor) seal(dst []byte, h Header, nonce, payload []byte) []byte {
+	start := len(dst)
+	dst = h.appendTo(dst)
+	dst = append(dst, nonce...)
+	return e.aead.Seal(dst, nonce, payload, dst[start:start+HeaderSize])
 }
 
-func (e *Encryptor) Decrypt(payload []byte) ([]byte, error) {
-	if len(payload) < e.gcm.NonceSize() {
+func (e *aeadEncryptor) Decrypt(dir Direction, payload []byte) ([]byte, error) {
+	return e.DecryptInto(nil, dir, payload)
+}
+
+func (e *aeadEncryptor) DecryptInto(dst []byte, dir Direction, payload []byte) ([]byte, error) {
+	h, err := ParseHeader(payload)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case h.Suite != e.suite:
+		return nil, fmt.Errorf("decryption: message is sealed with %s, not %s", h.Suite, e.suite)
+	case h.Version != ProtocolVersion:
+		return nil, fmt.Errorf("decryption: unsupported protocol version %d", h.Version)
+	case h.Direction != dir:
+		return nil, fmt.Errorf("decryption: got a %s, want a %s", h.Direction, dir)
+	case h.KeyID != e.keyID:
+		return nil, fmt.Errorf("decryption: message is sealed under key %08x, not %08x", h.KeyID, e.keyID)
+	}
+
+	nonceSize := e.aead.NonceSize()
+	if len(payload) < HeaderSize+nonceSize {
 		return nil, fmt.Errorf("decryption: ciphertext too short")
 	}
 
-	nonce, ciphertext := payload[:e.gcm.NonceSize()], payload[e.gcm.NonceSize():]
-	plaintext, err := e.gcm.Open(nil, nonce, ciphertext, nil)
+	start := len(dst)
+	nonce, ciphertext := payload[HeaderSize:HeaderSize+nonceSize], payload[HeaderSize+nonceSize:]
+	plaintext, err := e.aead.Open(dst, nonce, ciphertext, payload[:HeaderSize])
 	if err != nil {
 		return nil, fmt.Errorf("decryption: %v", err)
 	}
 
+	frame := plaintext[start:]
+	if len(frame) != protocol.FrameSize {
+		return nil, fmt.Errorf("decryption: payload is %d bytes, not a %d-byte frame", len(frame), protocol.FrameSize)
+	}
+	if id := binary.LittleEndian.Uint32(frame[dir.requestIDOffset():]); id != h.RequestID {
+		return nil, fmt.Errorf("decryption: header request ID %d does not match frame request ID %d", h.RequestID, id)
+	}
+
 	return plaintext, nil
 }
@@ -62,12 +62,12 @@ func TestEncryptionDecryption(t *testing.T) {
 	}
 	expected := protocol.DtoToFrame(dto)
 
-	payload, err := encryptor.Encrypt(expected)
+	payload, err := encryptor.Encrypt(Request, expected)
 	if err != nil {
 		t.Fatalf("got error: %v", err)
 	}
 
-	got, err := encryptor.Decrypt(payload)
+	got, err := encryptor.Decrypt(Request, payload)
 	if err != nil {
 		t.Fatalf("got error: %v", err)
 	}
@@ -84,7 +84,7 @@ func TestEncryptInvalidFrameSize(t *testing.T) {
 		t.Fatalf("got error: %v", err)
 	}
 
-	_, err = encryptor.Encrypt(expected)
+	_, err = encryptor.Encrypt(Request, expected)
 	if err == nil {
 		t.Errorf("Expected Length error got none")
 	}
@@ -94,9 +94,91 @@ func TestDecryptShortPayload(t *testing.T) {
 	encryptor, _ := New([]byte("asdfhjshajshehdhdkfhehdhsakjhhki"))
 
 	shortPayload := []byte("short")
-	_, err := encryptor.Decrypt(shortPayload)
+	_, err := encryptor.Decrypt(Request, shortPayload)
 
 	if err == nil {
 		t.Error("expected error for short payload, got nil")
 	}
 }
+
+func TestAppendVariants(t *testing.T) {
+	encryptor, err := New([]byte("asdfhjshajshehdhdkfhehdhsakjhhki"))
+	if err != nil {
+		t.Fatalf("got error: %v", err)
+	}
+	frame := protocol.DtoToFrame(protocol.FrameDTO{Cmd: protocol.CMD_GET, Key: "cat"})
+
+	prefix := []byte("prefix")
+	encrypted, err := encryptor.EncryptTo(bytes.Clone(prefix), Request, frame)
+	if err != nil {
+		t.Fatalf("encrypt to: %v", err)
+	}
+	if !bytes.HasPrefix(encrypted, prefix) || len(encrypted) != len(prefix)+HeaderSize+12+protocol.FrameSize+16 {
+		t.Fatalf("want prefix kept and one frame appended, got %d bytes", len(encrypted))
+	}
+
+	decrypted, err := encryptor.DecryptInto(bytes.Clone(prefix), Request, encrypted[len(prefix):])
+	if err != nil {
+		t.Fatalf("decrypt into: %v", err)
+	}
+	if !bytes.Equal(decrypted, append(bytes.Clone(prefix), frame...)) {
+		t.Error("want prefix followed by the frame")
+	}
+
+	encBuf := make([]byte, 0, protocol.EncryptedFrameSize)
+	plainBuf := make([]byte, 0, protocol.FrameSize)
+	allocs := testing.AllocsPerRun(100, func() {
+		encrypted, _ := encryptor.EncryptTo(encBuf[:0], Request, frame)
+		_, _ = encryptor.DecryptInto(plainBuf[:0], Request, encrypted)
+	})
+	if allocs != 0 {
+		t.Errorf("want no allocations with buffers of the right size, got %v", allocs)
+	}
+}
+
+func BenchmarkEncrypt(b *testing.B) {
+	encryptor, err := New([]byte("asdfhjshajshehdhdkfhehdhsakjhhki"))
+	if err != nil {
+		b.Fatalf("got error: %v", err)
+	}
+	frame := protocol.DtoToFrame(protocol.FrameDTO{Cmd: protocol.CMD_SET, Key: "cat", Value: []byte("jack")})
+
+	b.Run("Encrypt", func(b *testing.B) {
+		b.ReportAllocs()
+		for b.Loop() {
+			_, _ = encryptor.Encrypt(Request, frame)
+		}
+	})
+	b.Run("EncryptTo", func(b *testing.B) {
+		buf := make([]byte, 0, protocol.EncryptedFrameSize)
+		b.ReportAllocs()
+		for b.Loop() {
+			_, _ = encryptor.EncryptTo(buf[:0], Request, frame)
+		}
+	})
+}
+
+func BenchmarkDecrypt(b *testing.B) {
+	encryptor, err := New([]byte("asdfhjshajshehdhdkfhehdhsakjhhki"))
+	if err != nil {
+		b.Fatalf("got error: %v", err)
+	}
+	encrypted, err := encryptor.Encrypt(Request, protocol.DtoToFrame(protocol.FrameDTO{Cmd: protocol.CMD_SET, Key: "cat", Value: []byte("jack")}))
+	if err != nil {
+		b.Fatalf("got error: %v", err)
+	}
+
+	b.Run("Decrypt", func(b *testing.B) {
+		b.ReportAllocs()
+		for b.Loop() {
+			_, _ = encryptor.Decrypt(Request, encrypted)
+		}
+	})
+	b.Run("DecryptInto", func(b *testing.B) {
+		buf := make([]byte, 0, protocol.FrameSize)
+		b.ReportAllocs()
+		for b.Loop() {
+			_, _ = encryptor.DecryptInto(buf[:0], Request, encrypted)
+		}
+	})
+}
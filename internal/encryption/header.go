@@ -0,0 +1,86 @@
+package encryption
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"github.com/thesimpledev/skvs/internal/protocol"
+)
+
+// ProtocolVersion is the wire format version carried in every header.
+const ProtocolVersion byte = 1
+
+// HeaderSize is the cleartext header in front of every message: suite ID,
+// protocol version, direction, key ID and request ID.
+const HeaderSize = 1 + 1 + 1 + 4 + 4
+
+// Direction tells requests from responses, so a response cannot be sent
+// back to the server as a request.
+type Direction byte
+
+const (
+	Request  Direction = 1
+	Response Direction = 2
+)
+
+func (d Direction) String() string {
+	switch d {
+	case Request:
+		return "request"
+	case Response:
+		return "response"
+	default:
+		return fmt.Sprintf("direction(%d)", byte(d))
+	}
+}
+
+// requestIDOffset is where the request ID sits in a plaintext frame.
+func (d Direction) requestIDOffset() int {
+	if d == Request {
+		return protocol.CommandSize + protocol.FlagSize
+	}
+	return protocol.StatusSize
+}
+
+// Header is the cleartext front of a message. It is authenticated as the
+// AEAD's associated data, so changing any field, or moving it to another
+// message, fails the tag.
+type Header struct {
+	Suite     Suite
+	Version   byte
+	Direction Direction
+	KeyID     uint32
+	RequestID uint32
+}
+
+// ParseHeader reads the header of message without opening it.
+func ParseHeader(message []byte) (Header, error) {
+	if len(message) < HeaderSize {
+		return Header{}, errors.New("decryption: message too short for header")
+	}
+	return Header{
+		Suite:     Suite(message[0]),
+		Version:   message[1],
+		Direction: Direction(message[2]),
+		KeyID:     binary.LittleEndian.Uint32(message[3:]),
+		RequestID: binary.LittleEndian.Uint32(message[7:]),
+	}, nil
+}
+
+func (h Header) appendTo(dst []byte) []byte {
+	dst = append(dst, byte(h.Suite), h.Version, byte(h.Direction))
+	dst = binary.LittleEndian.AppendUint32(dst, h.KeyID)
+	return binary.LittleEndian.AppendUint32(dst, h.RequestID)
+}
+
+// KeyID names key on the wire without revealing it: the first four bytes of
+// its SHA-256 hash under a fixed label. A mismatch means the peers hold
+// different keys.
+func KeyID(key []byte) uint32 {
+	h := sha256.New()
+	h.Write([]byte("skvs key id\x00"))
+	h.Write(key)
+	return binary.LittleEndian.Uint32(h.Sum(nil))
+}
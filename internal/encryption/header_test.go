@@ -0,0 +1,97 @@
+package encryption
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/thesimpledev/skvs/internal/protocol"
+)
+
+func TestHeader(t *testing.T) {
+	key := []byte("asdfhjshajshehdhdkfhehdhsakjhhki")
+	e, err := NewSuite(ChaCha20Poly1305, key)
+	if err != nil {
+		t.Fatalf("new suite: %v", err)
+	}
+	frame := protocol.DtoToFrame(protocol.FrameDTO{Cmd: protocol.CMD_GET, Key: "cat", RequestID: 42})
+
+	encrypted, err := e.Encrypt(Request, frame)
+	if err != nil {
+		t.Fatalf("encrypt: %v", err)
+	}
+	h, err := ParseHeader(encrypted)
+	if err != nil {
+		t.Fatalf("parse header: %v", err)
+	}
+	want := Header{Suite: ChaCha20Poly1305, Version: ProtocolVersion, Direction: Request, KeyID: KeyID(key), RequestID: 42}
+	if h != want {
+		t.Errorf("want %+v, got %+v", want, h)
+	}
+
+	response := protocol.ResponseDTOToFrame(protocol.NewResponseDTO(protocol.STATUS_OK, nil))
+	encryptedResponse, err := e.Encrypt(Response, response)
+	if err != nil {
+		t.Fatalf("encrypt response: %v", err)
+	}
+	if _, err := e.Decrypt(Response, encryptedResponse); err != nil {
+		t.Errorf("decrypt response: %v", err)
+	}
+
+	if _, err := ParseHeader(encrypted[:HeaderSize-1]); err == nil {
+		t.Error("want a short header refused")
+	}
+	if _, err := e.Encrypt(Direction(9), frame); err == nil {
+		t.Error("want an unknown direction refused")
+	}
+	if KeyID(key) == KeyID(bytes.Repeat([]byte{1}, KeySize)) {
+		t.Error("want different keys to have different IDs")
+	}
+}
+
+func TestDecryptRejectsMismatches(t *testing.T) {
+	key := []byte("asdfhjshajshehdhdkfhehdhsakjhhki")
+	e, err := NewSuite(AES256GCM, key)
+	if err != nil {
+		t.Fatalf("new suite: %v", err)
+	}
+	ae := e.(*aeadEncryptor)
+	frame := protocol.DtoToFrame(protocol.FrameDTO{Cmd: protocol.CMD_SET, Key: "cat", Value: []byte("jack"), RequestID: 7})
+	nonce := bytes.Repeat([]byte{3}, 12)
+
+	sealWith := func(change func(h *Header)) []byte {
+		h := ae.header(Request, frame)
+		change(&h)
+		return ae.seal(nil, h, nonce, frame)
+	}
+	edit := func(offset int, b byte) []byte {
+		message := ae.seal(nil, ae.header(Request, frame), nonce, frame)
+		message[offset] = b
+		return message
+	}
+
+	tests := []struct {
+		name    string
+		message []byte
+		dir     Direction
+		wantErr string
+	}{
+		{name: "request sent back as response", message: sealWith(func(*Header) {}), dir: Response, wantErr: "got a request, want a response"},
+		{name: "response reflected as request", message: sealWith(func(h *Header) { h.Direction = Response }), dir: Request, wantErr: "got a response, want a request"},
+		{name: "direction rewritten", message: edit(2, byte(Response)), dir: Response, wantErr: "authentication failed"},
+		{name: "other version", message: sealWith(func(h *Header) { h.Version = 2 }), dir: Request, wantErr: "protocol version 2"},
+		{name: "other key", message: sealWith(func(h *Header) { h.KeyID++ }), dir: Request, wantErr: "sealed under key"},
+		{name: "request ID rewritten", message: edit(7, 8), dir: Request, wantErr: "authentication failed"},
+		{name: "request ID not the frame's", message: sealWith(func(h *Header) { h.RequestID = 8 }), dir: Request, wantErr: "does not match"},
+		{name: "suite rewritten", message: edit(0, byte(XChaCha20Poly1305)), dir: Request, wantErr: "sealed with xchacha20-poly1305"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := e.Decrypt(tt.dir, tt.message)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("want error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
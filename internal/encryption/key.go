@@ -0,0 +1,251 @@
+package encryption
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/scrypt"
+)
+
+// KeySize is the key length every suite takes.
+const KeySize = 32
+
+// KeySource says where the key comes from: given as 32 raw bytes, read from
+// a key file, or derived from a passphrase with the KDF parameters that were
+// stored when the key was first set up. Exactly one of Raw, File and
+// Passphrase must be set.
+type KeySource struct {
+	Raw        string
+	File       string
+	Passphrase string
+	KDF        string
+}
+
+// Load returns the key. Deriving from a passphrase is deliberately slow.
+func (s KeySource) Load() ([]byte, error) {
+	set := 0
+	for _, v := range []string{s.Raw, s.File, s.Passphrase} {
+		if v != "" {
+			set++
+		}
+	}
+	switch {
+	case set == 0:
+		return nil, errors.New("no key: give a key, a key file or a passphrase")
+	case set > 1:
+		return nil, errors.New("give only one of a key, a key file or a passphrase")
+	case s.KDF != "" && s.Passphrase == "":
+		return nil, errors.New("KDF parameters are only used with a passphrase")
+	}
+
+	switch {
+	case s.File != "":
+		return ReadKeyFile(s.File)
+	case s.Passphrase != "":
+		if s.KDF == "" {
+			return nil, errors.New("a passphrase needs KDF parameters; generate them with keygen")
+		}
+		params, err := ParseKDFParams(s.KDF)
+		if err != nil {
+			return nil, err
+		}
+		return params.DeriveKey(s.Passphrase)
+	default:
+		if len(s.Raw) != KeySize {
+			return nil, fmt.Errorf("key must be exactly %d bytes, got %d", KeySize, len(s.Raw))
+		}
+		return []byte(s.Raw), nil
+	}
+}
+
+// GenerateKey returns a new random key.
+func GenerateKey() []byte {
+	key := make([]byte, KeySize)
+	_, _ = rand.Read(key)
+	return key
+}
+
+// ParseKey decodes a key written as 64 hex digits or as base64, with or
+// without padding. Surrounding whitespace is ignored.
+func ParseKey(s string) ([]byte, error) {
+	s = strings.TrimSpace(s)
+
+	var key []byte
+	var err error
+	if len(s) == 2*KeySize {
+		key, err = hex.DecodeString(s)
+	} else {
+		key, err = base64.StdEncoding.DecodeString(s)
+		if err != nil {
+			key, err = base64.RawStdEncoding.DecodeString(s)
+		}
+	}
+	if err != nil {
+		return nil, errors.New("key must be hex or base64")
+	}
+	if len(key) != KeySize {
+		return nil, fmt.Errorf("key must decode to %d bytes, got %d", KeySize, len(key))
+	}
+	return key, nil
+}
+
+// ReadKeyFile reads a key written by keygen or by hand as hex or base64.
+func ReadKeyFile(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read key file: %w", err)
+	}
+	key, err := ParseKey(string(data))
+	if err != nil {
+		return nil, fmt.Errorf("key file %s: %w", path, err)
+	}
+	return key, nil
+}
+
+// KDFParams are the salt and costs for deriving a key from a passphrase. They
+// are not secret, but must be kept: a new salt gives a different key. In
+// text they use the PHC string format, for example
+// "$argon2id$v=19$m=65536,t=3,p=4$<salt>" or "$scrypt$ln=15,r=8,p=1$<salt>"
+// with the salt in unpadded base64.
+type KDFParams struct {
+	Algorithm string
+	Salt      []byte
+
+	// Argon2id: passes over memory, memory in KiB and lanes.
+	Time    uint32
+	Memory  uint32
+	Threads uint8
+
+	// scrypt: log2 of the cost N, block size and parallelism.
+	LogN uint8
+	R    int
+	P    int
+}
+
+const saltSize = 16
+
+// NewKDFParams returns parameters with a fresh random salt and the
+// recommended costs for algorithm, "argon2id" or "scrypt".
+func NewKDFParams(algorithm string) (KDFParams, error) {
+	salt := make([]byte, saltSize)
+	_, _ = rand.Read(salt)
+
+	switch algorithm {
+	case "argon2id":
+		return KDFParams{Algorithm: algorithm, Salt: salt, Time: 3, Memory: 64 * 1024, Threads: 4}, nil
+	case "scrypt":
+		return KDFParams{Algorithm: algorithm, Salt: salt, LogN: 15, R: 8, P: 1}, nil
+	default:
+		return KDFParams{}, fmt.Errorf("unknown KDF %q, want argon2id or scrypt", algorithm)
+	}
+}
+
+func (p KDFParams) String() string {
+	salt := base64.RawStdEncoding.EncodeToString(p.Salt)
+	switch p.Algorithm {
+	case "argon2id":
+		return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s", argon2.Version, p.Memory, p.Time, p.Threads, salt)
+	case "scrypt":
+		return fmt.Sprintf("$scrypt$ln=%d,r=%d,p=%d$%s", p.LogN, p.R, p.P, salt)
+	default:
+		return ""
+	}
+}
+
+// ParseKDFParams parses the PHC string written by String and checks that
+// the costs are within reasonable bounds.
+func ParseKDFParams(s string) (KDFParams, error) {
+	fields := strings.Split(strings.TrimSpace(s), "$")
+	if len(fields) < 4 || fields[0] != "" {
+		return KDFParams{}, fmt.Errorf("KDF parameters %q are not a PHC string", s)
+	}
+
+	p := KDFParams{Algorithm: fields[1]}
+	var costs map[string]int
+	var err error
+	switch {
+	case p.Algorithm == "argon2id" && len(fields) == 5:
+		if fields[2] != fmt.Sprintf("v=%d", argon2.Version) {
+			return KDFParams{}, fmt.Errorf("unsupported argon2id version %q", fields[2])
+		}
+		costs, err = parseCosts(fields[3], "m", "t", "p")
+		if err == nil {
+			p.Memory, p.Time, p.Threads = uint32(costs["m"]), uint32(costs["t"]), uint8(costs["p"])
+			err = checkRange(costs, map[string][2]int{"m": {8 * 1024, 4 * 1024 * 1024}, "t": {1, 100}, "p": {1, 255}})
+		}
+	case p.Algorithm == "scrypt" && len(fields) == 4:
+		costs, err = parseCosts(fields[2], "ln", "r", "p")
+		if err == nil {
+			p.LogN, p.R, p.P = uint8(costs["ln"]), costs["r"], costs["p"]
+			err = checkRange(costs, map[string][2]int{"ln": {10, 24}, "r": {1, 64}, "p": {1, 64}})
+		}
+	default:
+		return KDFParams{}, fmt.Errorf("unsupported KDF %q", p.Algorithm)
+	}
+	if err != nil {
+		return KDFParams{}, fmt.Errorf("%s parameters: %w", p.Algorithm, err)
+	}
+
+	p.Salt, err = base64.RawStdEncoding.DecodeString(fields[len(fields)-1])
+	if err != nil {
+		return KDFParams{}, fmt.Errorf("%s salt: %w", p.Algorithm, err)
+	}
+	if len(p.Salt) < 8 {
+		return KDFParams{}, fmt.Errorf("%s salt must be at least 8 bytes", p.Algorithm)
+	}
+	return p, nil
+}
+
+// DeriveKey stretches passphrase into a key.
+func (p KDFParams) DeriveKey(passphrase string) ([]byte, error) {
+	switch p.Algorithm {
+	case "argon2id":
+		return argon2.IDKey([]byte(passphrase), p.Salt, p.Time, p.Memory, p.Threads, KeySize), nil
+	case "scrypt":
+		key, err := scrypt.Key([]byte(passphrase), p.Salt, 1<<p.LogN, p.R, p.P, KeySize)
+		if err != nil {
+			return nil, fmt.Errorf("scrypt: %w", err)
+		}
+		return key, nil
+	default:
+		return nil, fmt.Errorf("unsupported KDF %q", p.Algorithm)
+	}
+}
+
+// parseCosts reads "k=v,k=v" with exactly the given keys.
+func parseCosts(s string, keys ...string) (map[string]int, error) {
+	costs := make(map[string]int, len(keys))
+	for pair := range strings.SplitSeq(s, ",") {
+		k, v, ok := strings.Cut(pair, "=")
+		n, err := strconv.Atoi(v)
+		if !ok || err != nil {
+			return nil, fmt.Errorf("malformed cost %q", pair)
+		}
+		costs[k] = n
+	}
+	for _, k := range keys {
+		if _, ok := costs[k]; !ok {
+			return nil, fmt.Errorf("missing %s", k)
+		}
+	}
+	if len(costs) != len(keys) {
+		return nil, fmt.Errorf("unexpected costs in %q", s)
+	}
+	return costs, nil
+}
+
+func checkRange(costs map[string]int, bounds map[string][2]int) error {
+	for k, b := range bounds {
+		if costs[k] < b[0] || costs[k] > b[1] {
+			return fmt.Errorf("%s=%d is outside %d to %d", k, costs[k], b[0], b[1])
+		}
+	}
+	return nil
+}
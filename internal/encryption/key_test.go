@@ -0,0 +1,148 @@
+package encryption
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseKey(t *testing.T) {
+	key := bytes.Repeat([]byte{0xab}, KeySize)
+
+	tests := []struct {
+		name  string
+		input string
+		err   bool
+	}{
+		{name: "hex", input: hex.EncodeToString(key)},
+		{name: "hex with newline", input: hex.EncodeToString(key) + "\n"},
+		{name: "base64", input: base64.StdEncoding.EncodeToString(key)},
+		{name: "unpadded base64", input: base64.RawStdEncoding.EncodeToString(key)},
+		{name: "too short", input: hex.EncodeToString(key[:16]), err: true},
+		{name: "not encoded", input: strings.Repeat("z", 64), err: true},
+		{name: "raw bytes", input: "12345678901234567890123456789012", err: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseKey(tt.input)
+			if (err != nil) != tt.err {
+				t.Fatalf("want error %v, got %v", tt.err, err)
+			}
+			if !tt.err && !bytes.Equal(got, key) {
+				t.Errorf("want %x, got %x", key, got)
+			}
+		})
+	}
+}
+
+func TestKDFParams(t *testing.T) {
+	for _, algorithm := range []string{"argon2id", "scrypt"} {
+		t.Run(algorithm, func(t *testing.T) {
+			params, err := NewKDFParams(algorithm)
+			if err != nil {
+				t.Fatalf("new params: %v", err)
+			}
+			parsed, err := ParseKDFParams(params.String())
+			if err != nil {
+				t.Fatalf("parse %s: %v", params, err)
+			}
+			if parsed.String() != params.String() {
+				t.Errorf("round trip: want %s, got %s", params, parsed)
+			}
+
+			other, _ := NewKDFParams(algorithm)
+			if bytes.Equal(other.Salt, params.Salt) {
+				t.Error("want a fresh salt each time")
+			}
+		})
+	}
+
+	bad := []string{
+		"",
+		"argon2id",
+		"$argon2i$v=19$m=65536,t=3,p=4$c2FsdHNhbHRzYWx0",
+		"$argon2id$v=16$m=65536,t=3,p=4$c2FsdHNhbHRzYWx0",
+		"$argon2id$v=19$m=65536,t=3$c2FsdHNhbHRzYWx0",
+		"$argon2id$v=19$m=1,t=3,p=4$c2FsdHNhbHRzYWx0",
+		"$argon2id$v=19$m=65536,t=3,p=4$c2FsdA",
+		"$scrypt$ln=40,r=8,p=1$c2FsdHNhbHRzYWx0",
+		"$scrypt$ln=15,r=8,p=1,x=2$c2FsdHNhbHRzYWx0",
+		"$scrypt$ln=15,r=8,p=1$not base64!",
+	}
+	for _, s := range bad {
+		if _, err := ParseKDFParams(s); err == nil {
+			t.Errorf("want %q refused", s)
+		}
+	}
+}
+
+func TestDeriveKey(t *testing.T) {
+	// RFC 7914 section 12, third vector; a 32-byte key is the first half of
+	// its 64-byte output.
+	rfc := KDFParams{Algorithm: "scrypt", Salt: []byte("NaCl"), LogN: 10, R: 8, P: 16}
+	key, err := rfc.DeriveKey("password")
+	if err != nil {
+		t.Fatalf("derive: %v", err)
+	}
+	if want := "fdbabe1c9d3472007856e7190d01e9fe7c6ad7cbc8237830e77376634b373162"; hex.EncodeToString(key) != want {
+		t.Errorf("scrypt: want %s, got %x", want, key)
+	}
+
+	params, err := ParseKDFParams("$argon2id$v=19$m=8192,t=1,p=1$c2FsdHNhbHRzYWx0c2FsdA")
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	first, _ := params.DeriveKey("correct horse")
+	again, _ := params.DeriveKey("correct horse")
+	other, _ := params.DeriveKey("battery staple")
+	if len(first) != KeySize || !bytes.Equal(first, again) || bytes.Equal(first, other) {
+		t.Error("want argon2id to derive the same key from the same passphrase only")
+	}
+}
+
+func TestKeySource(t *testing.T) {
+	key := GenerateKey()
+	file := filepath.Join(t.TempDir(), "skvs.key")
+	if err := os.WriteFile(file, []byte(hex.EncodeToString(key)+"\n"), 0o600); err != nil {
+		t.Fatalf("write key file: %v", err)
+	}
+	kdf := "$scrypt$ln=10,r=8,p=1$c2FsdHNhbHRzYWx0c2FsdA"
+	derived, err := KDFParams{Algorithm: "scrypt", Salt: []byte("saltsaltsaltsalt"), LogN: 10, R: 8, P: 1}.DeriveKey("hunter2")
+	if err != nil {
+		t.Fatalf("derive: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		source KeySource
+		want   []byte
+		err    bool
+	}{
+		{name: "raw", source: KeySource{Raw: "12345678901234567890123456789012"}, want: []byte("12345678901234567890123456789012")},
+		{name: "file", source: KeySource{File: file}, want: key},
+		{name: "passphrase", source: KeySource{Passphrase: "hunter2", KDF: kdf}, want: derived},
+		{name: "short raw", source: KeySource{Raw: "short"}, err: true},
+		{name: "missing file", source: KeySource{File: file + ".missing"}, err: true},
+		{name: "passphrase without kdf", source: KeySource{Passphrase: "hunter2"}, err: true},
+		{name: "kdf without passphrase", source: KeySource{File: file, KDF: kdf}, err: true},
+		{name: "two sources", source: KeySource{Raw: "12345678901234567890123456789012", File: file}, err: true},
+		{name: "none", err: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.source.Load()
+			if (err != nil) != tt.err {
+				t.Fatalf("want error %v, got %v", tt.err, err)
+			}
+			if !tt.err && !bytes.Equal(got, tt.want) {
+				t.Errorf("want %x, got %x", tt.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,52 @@
+package encryption
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrSuiteRefused is returned for a message sealed under a suite the keyring
+// does not hold.
+var ErrSuiteRefused = errors.New("suite not accepted")
+
+// Keyring holds an encryptor for each suite a server accepts, all with the
+// same key. Clients pick a suite; the server opens each message with the
+// suite named in its header and answers with the same one.
+type Keyring struct {
+	encryptors map[Suite]Encryptor
+}
+
+func NewKeyring(key []byte, accepted ...Suite) (*Keyring, error) {
+	if len(accepted) == 0 {
+		return nil, errors.New("encryption: keyring needs at least one suite")
+	}
+	k := &Keyring{encryptors: make(map[Suite]Encryptor, len(accepted))}
+	for _, suite := range accepted {
+		e, err := NewSuite(suite, key)
+		if err != nil {
+			return nil, err
+		}
+		k.encryptors[suite] = e
+	}
+	return k, nil
+}
+
+// For returns the encryptor for the suite message was sealed with, or an
+// error if that suite is not accepted.
+func (k *Keyring) For(message []byte) (Encryptor, error) {
+	h, err := ParseHeader(message)
+	if err != nil {
+		return nil, err
+	}
+	e, ok := k.encryptors[h.Suite]
+	if !ok {
+		return nil, fmt.Errorf("decryption: %s: %w", h.Suite, ErrSuiteRefused)
+	}
+	return e, nil
+}
+
+// Suite returns the encryptor for suite, if the keyring holds it.
+func (k *Keyring) Suite(suite Suite) (Encryptor, bool) {
+	e, ok := k.encryptors[suite]
+	return e, ok
+}
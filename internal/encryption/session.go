@@ -0,0 +1,74 @@
+package encryption
+
+import (
+	"bytes"
+	"crypto/ecdh"
+	"crypto/hkdf"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+)
+
+// Handshake is one side of a session key exchange: an ephemeral X25519 key
+// pair used for a single session and then dropped. The handshake messages
+// are sealed with the pre-shared key, which authenticates the public keys,
+// but the session key depends on the ephemeral secrets too, so a pre-shared
+// key leaked later does not open recorded sessions.
+type Handshake struct {
+	private *ecdh.PrivateKey
+}
+
+func NewHandshake() (*Handshake, error) {
+	private, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("handshake: generate key: %v", err)
+	}
+	return &Handshake{private: private}, nil
+}
+
+// PublicKey is the 32-byte public key to send to the peer.
+func (h *Handshake) PublicKey() []byte {
+	return h.private.PublicKey().Bytes()
+}
+
+// SessionKey completes the exchange and derives the key for session id with
+// HKDF-SHA256, salted with the pre-shared key and bound to both public keys
+// and the ID. clientPublic and serverPublic are the two public keys in that
+// order; one of them must be this side's.
+func (h *Handshake) SessionKey(psk, clientPublic, serverPublic []byte, id uint32) ([]byte, error) {
+	own := h.PublicKey()
+	peer := clientPublic
+	if bytes.Equal(own, clientPublic) {
+		peer = serverPublic
+	} else if !bytes.Equal(own, serverPublic) {
+		return nil, fmt.Errorf("handshake: neither public key is ours")
+	}
+
+	peerKey, err := ecdh.X25519().NewPublicKey(peer)
+	if err != nil {
+		return nil, fmt.Errorf("handshake: peer public key: %v", err)
+	}
+	shared, err := h.private.ECDH(peerKey)
+	if err != nil {
+		return nil, fmt.Errorf("handshake: %v", err)
+	}
+
+	info := make([]byte, 0, 16+2*len(own)+4)
+	info = append(info, "skvs session v1\x00"...)
+	info = append(info, clientPublic...)
+	info = append(info, serverPublic...)
+	info = binary.LittleEndian.AppendUint32(info, id)
+	return hkdf.Key(sha256.New, shared, psk, string(info), KeySize)
+}
+
+// NewSession returns an encryptor for a session key. Its messages carry id
+// in place of the key ID, which is how the server finds the session.
+func NewSession(suite Suite, key []byte, id uint32) (Encryptor, error) {
+	e, err := NewSuite(suite, key)
+	if err != nil {
+		return nil, err
+	}
+	e.(*aeadEncryptor).keyID = id
+	return e, nil
+}
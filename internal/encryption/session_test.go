@@ -0,0 +1,91 @@
+package encryption
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/thesimpledev/skvs/internal/protocol"
+)
+
+func TestHandshake(t *testing.T) {
+	psk := []byte("asdfhjshajshehdhdkfhehdhsakjhhki")
+	client, err := NewHandshake()
+	if err != nil {
+		t.Fatalf("client handshake: %v", err)
+	}
+	server, err := NewHandshake()
+	if err != nil {
+		t.Fatalf("server handshake: %v", err)
+	}
+	clientPublic, serverPublic := client.PublicKey(), server.PublicKey()
+
+	clientKey, err := client.SessionKey(psk, clientPublic, serverPublic, 7)
+	if err != nil {
+		t.Fatalf("client key: %v", err)
+	}
+	serverKey, err := server.SessionKey(psk, clientPublic, serverPublic, 7)
+	if err != nil {
+		t.Fatalf("server key: %v", err)
+	}
+	if !bytes.Equal(clientKey, serverKey) || len(clientKey) != KeySize {
+		t.Fatalf("want both sides to derive the same %d-byte key", KeySize)
+	}
+	if bytes.Equal(clientKey, psk) {
+		t.Error("want a session key different from the pre-shared key")
+	}
+
+	tests := []struct {
+		name       string
+		psk        []byte
+		id         uint32
+		serverSide []byte
+	}{
+		{name: "other pre-shared key", psk: bytes.Repeat([]byte{1}, KeySize), id: 7, serverSide: serverPublic},
+		{name: "other session ID", psk: psk, id: 8, serverSide: serverPublic},
+	}
+	for _, tt := range tests {
+		key, err := client.SessionKey(tt.psk, clientPublic, tt.serverSide, tt.id)
+		if err != nil || bytes.Equal(key, clientKey) {
+			t.Errorf("%s: want a different key, got %v", tt.name, err)
+		}
+	}
+
+	other, _ := NewHandshake()
+	if _, err := client.SessionKey(psk, other.PublicKey(), serverPublic, 7); err == nil {
+		t.Error("want a handshake refused when neither public key is ours")
+	}
+	if _, err := client.SessionKey(psk, clientPublic, make([]byte, protocol.PublicKeySize), 7); err == nil {
+		t.Error("want a low-order peer key refused")
+	}
+}
+
+func TestSessionEncryptor(t *testing.T) {
+	psk := []byte("asdfhjshajshehdhdkfhehdhsakjhhki")
+	key := bytes.Repeat([]byte{5}, KeySize)
+	session, err := NewSession(XChaCha20Poly1305, key, 99)
+	if err != nil {
+		t.Fatalf("new session: %v", err)
+	}
+	static, err := NewSuite(XChaCha20Poly1305, psk)
+	if err != nil {
+		t.Fatalf("new suite: %v", err)
+	}
+	if session.KeyID() != 99 || static.KeyID() != KeyID(psk) {
+		t.Errorf("want key IDs 99 and %08x, got %d and %08x", KeyID(psk), session.KeyID(), static.KeyID())
+	}
+
+	frame := protocol.DtoToFrame(protocol.FrameDTO{Cmd: protocol.CMD_PING, RequestID: 3})
+	encrypted, err := session.Encrypt(Request, frame)
+	if err != nil {
+		t.Fatalf("encrypt: %v", err)
+	}
+	if h, _ := ParseHeader(encrypted); h.KeyID != 99 {
+		t.Errorf("want the session ID in the header, got %d", h.KeyID)
+	}
+	if _, err := session.Decrypt(Request, encrypted); err != nil {
+		t.Errorf("decrypt: %v", err)
+	}
+	if _, err := static.Decrypt(Request, encrypted); err == nil {
+		t.Error("want the pre-shared key to refuse a session message")
+	}
+}
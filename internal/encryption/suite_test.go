@@ -0,0 +1,218 @@
+package encryption
+
+import (
+	"bytes"
+	"encoding/hex"
+	"slices"
+	"testing"
+
+	"github.com/thesimpledev/skvs/internal/protocol"
+)
+
+func unhex(t *testing.T, s string) []byte {
+	t.Helper()
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatalf("bad hex: %v", err)
+	}
+	return b
+}
+
+// TestSuiteVectors checks each suite's cipher against its published
+// known-answer test: GCM spec test case 15, RFC 8439 section 2.8.2 and
+// draft-irtf-cfrg-xchacha appendix A.3.1.
+func TestSuiteVectors(t *testing.T) {
+	sunscreen := "Ladies and Gentlemen of the class of '99: If I could offer you only one tip for the future, sunscreen would be it."
+
+	tests := []struct {
+		name      string
+		suite     Suite
+		key       string
+		nonce     string
+		aad       string
+		plaintext []byte
+		sealed    string
+	}{
+		{
+			name:      "aes-256-gcm",
+			suite:     AES256GCM,
+			key:       "feffe9928665731c6d6a8f9467308308feffe9928665731c6d6a8f9467308308",
+			nonce:     "cafebabefacedbaddecaf888",
+			plaintext: unhex(t, "d9313225f88406e5a55909c5aff5269a86a7a9531534f7da2e4c303d8a318a721c3c0c95956809532fcf0e2449a6b525b16aedf5aa0de657ba637b391aafd255"),
+			sealed: "522dc1f099567d07f47f37a32a84427d643a8cdcbfe5c0c97598a2bd2555d1aa8cb08e48590dbb3da7b08b1056828838c5f61e6393ba7a0abcc9f662898015ad" +
+				"b094dac5d93471bdec1a502270e3cc6c",
+		},
+		{
+			name:      "chacha20-poly1305",
+			suite:     ChaCha20Poly1305,
+			key:       "808182838485868788898a8b8c8d8e8f909192939495969798999a9b9c9d9e9f",
+			nonce:     "070000004041424344454647",
+			aad:       "50515253c0c1c2c3c4c5c6c7",
+			plaintext: []byte(sunscreen),
+			sealed: "d31a8d34648e60db7b86afbc53ef7ec2a4aded51296e08fea9e2b5a736ee62d63dbea45e8ca9671282fafb69da92728b1a71de0a9e060b2905d6a5b67ecd3b3692ddbd7f2d778b8c9803aee328091b58fab324e4fad675945585808b4831d7bc3ff4def08e4b7a9de576d26586cec64b6116" +
+				"1ae10b594f09e26a7e902ecbd0600691",
+		},
+		{
+			name:      "xchacha20-poly1305",
+			suite:     XChaCha20Poly1305,
+			key:       "808182838485868788898a8b8c8d8e8f909192939495969798999a9b9c9d9e9f",
+			nonce:     "404142434445464748494a4b4c4d4e4f5051525354555657",
+			aad:       "50515253c0c1c2c3c4c5c6c7",
+			plaintext: []byte(sunscreen),
+			sealed: "bd6d179d3e83d43b9576579493c0e939572a1700252bfaccbed2902c21396cbb731c7f1b0b4aa6440bf3a82f4eda7e39ae64c6708c54c216cb96b72e1213b4522f8c9ba40db5d945b11b69b982c1bb9e3f3fac2bc369488f76b2383565d3fff921f9664c97637da9768812f615c68b13b52e" +
+				"c0875924c1c7987947deafd8780acf49",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.suite.String() != tt.name {
+				t.Errorf("want name %s, got %s", tt.name, tt.suite)
+			}
+			aead, err := suites[tt.suite].newAEAD(unhex(t, tt.key))
+			if err != nil {
+				t.Fatalf("new aead: %v", err)
+			}
+			nonce, aad := unhex(t, tt.nonce), unhex(t, tt.aad)
+
+			sealed := aead.Seal(nil, nonce, tt.plaintext, aad)
+			if got := hex.EncodeToString(sealed); got != tt.sealed {
+				t.Errorf("seal:\nwant %s\ngot  %s", tt.sealed, got)
+			}
+			opened, err := aead.Open(nil, nonce, unhex(t, tt.sealed), aad)
+			if err != nil || !bytes.Equal(opened, tt.plaintext) {
+				t.Errorf("open: want the plaintext back, got %v", err)
+			}
+		})
+	}
+}
+
+func TestSuiteFraming(t *testing.T) {
+	key := []byte("asdfhjshajshehdhdkfhehdhsakjhhki")
+	frame := protocol.DtoToFrame(protocol.FrameDTO{Cmd: protocol.CMD_SET, Key: "cat", Value: []byte("jack")})
+
+	tests := []struct {
+		suite     Suite
+		nonceSize int
+	}{
+		{suite: AES256GCM, nonceSize: 12},
+		{suite: ChaCha20Poly1305, nonceSize: 12},
+		{suite: XChaCha20Poly1305, nonceSize: 24},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.suite.String(), func(t *testing.T) {
+			e, err := NewSuite(tt.suite, key)
+			if err != nil {
+				t.Fatalf("new suite: %v", err)
+			}
+
+			ae := e.(*aeadEncryptor)
+			nonce := bytes.Repeat([]byte{7}, tt.nonceSize)
+			message := ae.seal(nil, ae.header(Request, frame), nonce, frame)
+			if message[0] != byte(tt.suite) || !bytes.Equal(message[HeaderSize:HeaderSize+tt.nonceSize], nonce) {
+				t.Errorf("want the suite ID and nonce in front, got % x", message[:HeaderSize+tt.nonceSize])
+			}
+			if len(message) != tt.suite.MessageSize() || len(message) > protocol.EncryptedFrameSize {
+				t.Errorf("unexpected message size %d", len(message))
+			}
+
+			encrypted, err := e.Encrypt(Request, frame)
+			if err != nil {
+				t.Fatalf("encrypt: %v", err)
+			}
+			if bytes.Equal(encrypted, message) {
+				t.Error("want a random nonce per message")
+			}
+			decrypted, err := e.Decrypt(Request, encrypted)
+			if err != nil || !bytes.Equal(decrypted, frame) {
+				t.Fatalf("want the frame back, got %v", err)
+			}
+
+			tampered := bytes.Clone(encrypted)
+			tampered[len(tampered)-1] ^= 1
+			if _, err := e.Decrypt(Request, tampered); err == nil {
+				t.Error("want a tampered message rejected")
+			}
+
+			for _, other := range Suites() {
+				if other == tt.suite {
+					continue
+				}
+				o, err := NewSuite(other, key)
+				if err != nil {
+					t.Fatalf("new suite: %v", err)
+				}
+				if _, err := o.Decrypt(Request, encrypted); err == nil {
+					t.Errorf("want %s to refuse a %s message", other, tt.suite)
+				}
+			}
+		})
+	}
+}
+
+func TestParseSuites(t *testing.T) {
+	tests := []struct {
+		list string
+		want []Suite
+		err  bool
+	}{
+		{list: "aes-256-gcm", want: []Suite{AES256GCM}},
+		{list: "xchacha20-poly1305, chacha20-poly1305", want: []Suite{XChaCha20Poly1305, ChaCha20Poly1305}},
+		{list: "aes-128-gcm", err: true},
+		{list: "", err: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.list, func(t *testing.T) {
+			got, err := ParseSuites(tt.list)
+			if (err != nil) != tt.err {
+				t.Fatalf("want error %v, got %v", tt.err, err)
+			}
+			if !tt.err && !slices.Equal(got, tt.want) {
+				t.Errorf("want %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestKeyring(t *testing.T) {
+	key := []byte("asdfhjshajshehdhdkfhehdhsakjhhki")
+	k, err := NewKeyring(key, AES256GCM, XChaCha20Poly1305)
+	if err != nil {
+		t.Fatalf("new keyring: %v", err)
+	}
+	frame := protocol.DtoToFrame(protocol.FrameDTO{Cmd: protocol.CMD_PING})
+
+	for _, suite := range Suites() {
+		e, err := NewSuite(suite, key)
+		if err != nil {
+			t.Fatalf("new suite: %v", err)
+		}
+		encrypted, err := e.Encrypt(Request, frame)
+		if err != nil {
+			t.Fatalf("encrypt: %v", err)
+		}
+
+		opener, err := k.For(encrypted)
+		if suite == ChaCha20Poly1305 {
+			if err == nil {
+				t.Error("want a suite outside the keyring refused")
+			}
+			continue
+		}
+		if err != nil || opener.Suite() != suite {
+			t.Fatalf("want the %s encryptor, got %v", suite, err)
+		}
+		if _, err := opener.Decrypt(Request, encrypted); err != nil {
+			t.Errorf("decrypt %s: %v", suite, err)
+		}
+	}
+
+	if _, err := k.For(nil); err == nil {
+		t.Error("want an empty message refused")
+	}
+	if _, err := NewKeyring(key); err == nil {
+		t.Error("want a keyring without suites refused")
+	}
+}
@@ -0,0 +1,390 @@
+// Package metrics provides a minimal Prometheus-compatible metrics registry.
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+var DefaultBuckets = []float64{.00005, .0001, .00025, .0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1}
+
+type collector interface {
+	write(w *bufio.Writer)
+}
+
+type Registry struct {
+	mu         sync.Mutex
+	collectors []collector
+}
+
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+func (r *Registry) register(c collector) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.collectors = append(r.collectors, c)
+}
+
+func (r *Registry) Write(w io.Writer) error {
+	r.mu.Lock()
+	collectors := append([]collector(nil), r.collectors...)
+	r.mu.Unlock()
+
+	bw := bufio.NewWriter(w)
+	for _, c := range collectors {
+		c.write(bw)
+	}
+	return bw.Flush()
+}
+
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", ContentType)
+		_ = r.Write(w)
+	})
+}
+
+type Counter struct {
+	v atomic.Uint64
+}
+
+func (c *Counter) Inc() {
+	c.v.Add(1)
+}
+
+func (c *Counter) Add(n uint64) {
+	c.v.Add(n)
+}
+
+func (c *Counter) Value() uint64 {
+	return c.v.Load()
+}
+
+type Gauge struct {
+	bits atomic.Uint64
+}
+
+func (g *Gauge) Set(v float64) {
+	g.bits.Store(math.Float64bits(v))
+}
+
+func (g *Gauge) Add(delta float64) {
+	for {
+		old := g.bits.Load()
+		next := math.Float64bits(math.Float64frombits(old) + delta)
+		if g.bits.CompareAndSwap(old, next) {
+			return
+		}
+	}
+}
+
+func (g *Gauge) Inc() {
+	g.Add(1)
+}
+
+func (g *Gauge) Dec() {
+	g.Add(-1)
+}
+
+func (g *Gauge) Value() float64 {
+	return math.Float64frombits(g.bits.Load())
+}
+
+type Histogram struct {
+	upperBounds []float64
+	counts      []atomic.Uint64
+	count       atomic.Uint64
+	sumBits     atomic.Uint64
+}
+
+func newHistogram(buckets []float64) *Histogram {
+	return &Histogram{
+		upperBounds: buckets,
+		counts:      make([]atomic.Uint64, len(buckets)),
+	}
+}
+
+func (h *Histogram) Observe(v float64) {
+	i := sort.SearchFloat64s(h.upperBounds, v)
+	if i < len(h.counts) {
+		h.counts[i].Add(1)
+	}
+	h.count.Add(1)
+	for {
+		old := h.sumBits.Load()
+		next := math.Float64bits(math.Float64frombits(old) + v)
+		if h.sumBits.CompareAndSwap(old, next) {
+			return
+		}
+	}
+}
+
+func (h *Histogram) Count() uint64 {
+	return h.count.Load()
+}
+
+func (h *Histogram) Sum() float64 {
+	return math.Float64frombits(h.sumBits.Load())
+}
+
+type desc struct {
+	name   string
+	help   string
+	kind   string
+	labels []string
+}
+
+func (d desc) header(w *bufio.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n", d.name, escapeHelp(d.help))
+	fmt.Fprintf(w, "# TYPE %s %s\n", d.name, d.kind)
+}
+
+func (r *Registry) NewCounter(name, help string) *Counter {
+	v := r.NewCounterVec(name, help)
+	return v.WithLabelValues()
+}
+
+type CounterVec struct {
+	desc
+	mu       sync.RWMutex
+	children map[string]*labeledCounter
+}
+
+type labeledCounter struct {
+	values []string
+	c      Counter
+}
+
+func (r *Registry) NewCounterVec(name, help string, labels ...string) *CounterVec {
+	v := &CounterVec{
+		desc:     desc{name: name, help: help, kind: "counter", labels: labels},
+		children: make(map[string]*labeledCounter),
+	}
+	r.register(v)
+	return v
+}
+
+func (v *CounterVec) WithLabelValues(values ...string) *Counter {
+	if len(values) != len(v.labels) {
+		panic(fmt.Sprintf("metrics: %s expects %d label values, got %d", v.name, len(v.labels), len(values)))
+	}
+	var buf [64]byte
+	key := labelKey(buf[:0], values)
+
+	v.mu.RLock()
+	child, ok := v.children[string(key)]
+	v.mu.RUnlock()
+	if ok {
+		return &child.c
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if child, ok = v.children[string(key)]; !ok {
+		child = &labeledCounter{values: append([]string(nil), values...)}
+		v.children[string(key)] = child
+	}
+	return &child.c
+}
+
+func (v *CounterVec) write(w *bufio.Writer) {
+	v.header(w)
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	for _, key := range sortedKeys(v.children) {
+		child := v.children[key]
+		fmt.Fprintf(w, "%s%s %d\n", v.name, formatLabels(v.labels, child.values, "", ""), child.c.Value())
+	}
+}
+
+type gaugeFunc struct {
+	desc
+	fn func() float64
+}
+
+func (g *gaugeFunc) write(w *bufio.Writer) {
+	g.header(w)
+	fmt.Fprintf(w, "%s %s\n", g.name, formatFloat(g.fn()))
+}
+
+type gauge struct {
+	desc
+	g *Gauge
+}
+
+func (g *gauge) write(w *bufio.Writer) {
+	g.header(w)
+	fmt.Fprintf(w, "%s %s\n", g.name, formatFloat(g.g.Value()))
+}
+
+func (r *Registry) NewGauge(name, help string) *Gauge {
+	g := &gauge{desc: desc{name: name, help: help, kind: "gauge"}, g: &Gauge{}}
+	r.register(g)
+	return g.g
+}
+
+// NewGaugeFunc registers a gauge whose value is read from fn at scrape time.
+func (r *Registry) NewGaugeFunc(name, help string, fn func() float64) {
+	r.register(&gaugeFunc{desc: desc{name: name, help: help, kind: "gauge"}, fn: fn})
+}
+
+// NewCounterFunc registers a counter whose value is read from fn at scrape time.
+func (r *Registry) NewCounterFunc(name, help string, fn func() float64) {
+	r.register(&gaugeFunc{desc: desc{name: name, help: help, kind: "counter"}, fn: fn})
+}
+
+type HistogramVec struct {
+	desc
+	buckets  []float64
+	mu       sync.RWMutex
+	children map[string]*labeledHistogram
+}
+
+type labeledHistogram struct {
+	values []string
+	h      *Histogram
+}
+
+func (r *Registry) NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	if buckets == nil {
+		buckets = DefaultBuckets
+	}
+	buckets = append([]float64(nil), buckets...)
+	sort.Float64s(buckets)
+
+	v := &HistogramVec{
+		desc:     desc{name: name, help: help, kind: "histogram", labels: labels},
+		buckets:  buckets,
+		children: make(map[string]*labeledHistogram),
+	}
+	r.register(v)
+	return v
+}
+
+func (v *HistogramVec) WithLabelValues(values ...string) *Histogram {
+	if len(values) != len(v.labels) {
+		panic(fmt.Sprintf("metrics: %s expects %d label values, got %d", v.name, len(v.labels), len(values)))
+	}
+	var buf [64]byte
+	key := labelKey(buf[:0], values)
+
+	v.mu.RLock()
+	child, ok := v.children[string(key)]
+	v.mu.RUnlock()
+	if ok {
+		return child.h
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if child, ok = v.children[string(key)]; !ok {
+		child = &labeledHistogram{values: append([]string(nil), values...), h: newHistogram(v.buckets)}
+		v.children[string(key)] = child
+	}
+	return child.h
+}
+
+func (v *HistogramVec) write(w *bufio.Writer) {
+	v.header(w)
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	for _, key := range sortedKeys(v.children) {
+		child := v.children[key]
+		var cumulative uint64
+		for i, bound := range v.buckets {
+			cumulative += child.h.counts[i].Load()
+			fmt.Fprintf(w, "%s_bucket%s %d\n", v.name, formatLabels(v.labels, child.values, "le", formatFloat(bound)), cumulative)
+		}
+		count := child.h.Count()
+		fmt.Fprintf(w, "%s_bucket%s %d\n", v.name, formatLabels(v.labels, child.values, "le", "+Inf"), count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", v.name, formatLabels(v.labels, child.values, "", ""), formatFloat(child.h.Sum()))
+		fmt.Fprintf(w, "%s_count%s %d\n", v.name, formatLabels(v.labels, child.values, "", ""), count)
+	}
+}
+
+func sortedKeys[T any](m map[string]T) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func formatLabels(names, values []string, extraName, extraValue string) string {
+	if len(names) == 0 && extraName == "" {
+		return ""
+	}
+
+	var b strings.Builder
+	b.WriteByte('{')
+	for i, name := range names {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(name)
+		b.WriteString(`="`)
+		b.WriteString(escapeLabel(values[i]))
+		b.WriteByte('"')
+	}
+	if extraName != "" {
+		if len(names) > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(extraName)
+		b.WriteString(`="`)
+		b.WriteString(extraValue)
+		b.WriteByte('"')
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+
+func escapeLabel(s string) string {
+	return labelEscaper.Replace(s)
+}
+
+var helpEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+
+func escapeHelp(s string) string {
+	return helpEscaper.Replace(s)
+}
+
+// labelKey joins label values into the key of a vector's children. Looking
+// the key up as string(key) does not allocate, so recording to an existing
+// child is allocation free.
+func labelKey(dst []byte, values []string) []byte {
+	for i, value := range values {
+		if i > 0 {
+			dst = append(dst, '\xff')
+		}
+		dst = append(dst, value...)
+	}
+	return dst
+}
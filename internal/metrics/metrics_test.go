@@ -0,0 +1,150 @@
+package metrics
+
+import (
+	"bytes"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestCounterVec(t *testing.T) {
+	r := NewRegistry()
+	v := r.NewCounterVec("skvs_requests_total", "Requests processed.", "command", "status")
+
+	v.WithLabelValues("get", "ok").Inc()
+	v.WithLabelValues("get", "ok").Add(2)
+	v.WithLabelValues("set", "error").Inc()
+
+	if got := v.WithLabelValues("get", "ok").Value(); got != 3 {
+		t.Errorf("want 3, got %d", got)
+	}
+
+	var buf bytes.Buffer
+	if err := r.Write(&buf); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+
+	want := `# HELP skvs_requests_total Requests processed.
+# TYPE skvs_requests_total counter
+skvs_requests_total{command="get",status="ok"} 3
+skvs_requests_total{command="set",status="error"} 1
+`
+	if buf.String() != want {
+		t.Errorf("want:\n%s\ngot:\n%s", want, buf.String())
+	}
+}
+
+func TestVecRecordingDoesNotAllocate(t *testing.T) {
+	r := NewRegistry()
+	counters := r.NewCounterVec("c", "help", "command", "status")
+	histograms := r.NewHistogramVec("h", "help", nil, "command", "status")
+	counters.WithLabelValues("get", "ok").Inc()
+	histograms.WithLabelValues("get", "ok").Observe(1)
+
+	allocs := testing.AllocsPerRun(100, func() {
+		counters.WithLabelValues("get", "ok").Inc()
+		histograms.WithLabelValues("get", "ok").Observe(1)
+	})
+	if allocs != 0 {
+		t.Errorf("want no allocations for existing children, got %v", allocs)
+	}
+}
+
+func TestCounterVecLabelMismatch(t *testing.T) {
+	r := NewRegistry()
+	v := r.NewCounterVec("c", "help", "a")
+
+	defer func() {
+		if recover() == nil {
+			t.Error("expected panic for wrong label count")
+		}
+	}()
+	v.WithLabelValues("x", "y")
+}
+
+func TestGauge(t *testing.T) {
+	r := NewRegistry()
+	g := r.NewGauge("in_flight", "In flight.")
+	g.Inc()
+	g.Inc()
+	g.Dec()
+	g.Add(0.5)
+
+	if g.Value() != 1.5 {
+		t.Errorf("want 1.5, got %v", g.Value())
+	}
+
+	r.NewGaugeFunc("keys", "Keys.", func() float64 { return 42 })
+
+	var buf bytes.Buffer
+	_ = r.Write(&buf)
+
+	for _, line := range []string{"in_flight 1.5", "keys 42", "# TYPE keys gauge"} {
+		if !strings.Contains(buf.String(), line+"\n") {
+			t.Errorf("output missing %q:\n%s", line, buf.String())
+		}
+	}
+}
+
+func TestHistogram(t *testing.T) {
+	r := NewRegistry()
+	v := r.NewHistogramVec("latency_seconds", "Latency.", []float64{1, 0.1}, "command")
+	h := v.WithLabelValues("get")
+
+	h.Observe(0.0625)
+	h.Observe(0.5)
+	h.Observe(0.75)
+	h.Observe(2)
+
+	if h.Count() != 4 {
+		t.Errorf("count: want 4, got %d", h.Count())
+	}
+	if h.Sum() != 3.3125 {
+		t.Errorf("sum: want 3.3125, got %v", h.Sum())
+	}
+
+	var buf bytes.Buffer
+	_ = r.Write(&buf)
+
+	want := `# HELP latency_seconds Latency.
+# TYPE latency_seconds histogram
+latency_seconds_bucket{command="get",le="0.1"} 1
+latency_seconds_bucket{command="get",le="1"} 3
+latency_seconds_bucket{command="get",le="+Inf"} 4
+latency_seconds_sum{command="get"} 3.3125
+latency_seconds_count{command="get"} 4
+`
+	if buf.String() != want {
+		t.Errorf("want:\n%s\ngot:\n%s", want, buf.String())
+	}
+}
+
+func TestLabelEscaping(t *testing.T) {
+	r := NewRegistry()
+	r.NewCounterVec("c", "line one\nline two", "l").WithLabelValues("a\"b\\c\n").Inc()
+
+	var buf bytes.Buffer
+	_ = r.Write(&buf)
+
+	if !strings.Contains(buf.String(), `# HELP c line one\nline two`) {
+		t.Errorf("help not escaped:\n%s", buf.String())
+	}
+	if !strings.Contains(buf.String(), `c{l="a\"b\\c\n"} 1`) {
+		t.Errorf("label not escaped:\n%s", buf.String())
+	}
+}
+
+func TestHandler(t *testing.T) {
+	r := NewRegistry()
+	r.NewCounter("hits_total", "Hits.").Inc()
+
+	rec := httptest.NewRecorder()
+	r.Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+
+	if ct := rec.Header().Get("Content-Type"); ct != ContentType {
+		t.Errorf("content type: want %q, got %q", ContentType, ct)
+	}
+	if !strings.Contains(rec.Body.String(), "hits_total 1\n") {
+		t.Errorf("unexpected body:\n%s", rec.Body.String())
+	}
+}
@@ -4,6 +4,9 @@ package protocol
 import (
 	"bytes"
 	"fmt"
+	"slices"
+	"strconv"
+	"sync"
 	"time"
 )
 
@@ -12,32 +15,72 @@ const (
 	CMD_GET    = 1
 	CMD_DELETE = 2
 	CMD_EXISTS = 3
+	CMD_INFO   = 4
+	CMD_PING   = 5
+	CMD_SCAN   = 6
+
+	// CMD_HANDSHAKE starts a session: see PackSession.
+	CMD_HANDSHAKE = 7
 
 	STATUS_OK        = 0
 	STATUS_NOT_FOUND = 1
-	STATUS_ERROR     = 2
-
-	FLAG_OVERWRITE uint32 = 1 << 0
-	FLAG_OLD       uint32 = 1 << 1
 
-	CommandSize        = 1
-	FlagSize           = 4
-	StatusSize         = 1
-	FrameSize          = 996
-	EncryptedFrameSize = 1024
+	// Every status from STATUS_ERROR upwards is an error. STATUS_ERROR itself is
+	// the generic code; the rest let clients react without parsing the message.
+	STATUS_ERROR            = 2
+	STATUS_WRONG_TYPE       = 3
+	STATUS_VALUE_TOO_LARGE  = 4
+	STATUS_KEY_EXISTS       = 5
+	STATUS_AUTH_FAILURE     = 6
+	STATUS_RATE_LIMITED     = 7
+	STATUS_OUT_OF_MEMORY    = 8
+	STATUS_VERSION_MISMATCH = 9
+	STATUS_UNKNOWN_COMMAND  = 10
+	STATUS_INVALID_REQUEST  = 11
+	STATUS_BUSY             = 12
+	// STATUS_SESSION_EXPIRED answers a request sealed under a session the
+	// server does not have, so the client should handshake and resend.
+	STATUS_SESSION_EXPIRED = 13
+	// STATUS_SUITE_REFUSED answers a request sealed under a cipher suite the
+	// server does not accept. It is sealed under AES-256-GCM, which every
+	// server accepts.
+	STATUS_SUITE_REFUSED = 14
+
+	// Statuses from 128 upwards are informational rather than errors.
+	STATUS_NOT_MODIFIED = 128
+
+	FLAG_OVERWRITE  uint32 = 1 << 0
+	FLAG_OLD        uint32 = 1 << 1
+	FLAG_IF_VERSION uint32 = 1 << 2
+
+	CommandSize   = 1
+	FlagSize      = 4
+	RequestIDSize = 4
+	StatusSize    = 1
+	VersionSize   = 8
+	FrameSize     = 996
+	// EncryptedFrameSize is the largest a frame gets on the wire: an 11-byte
+	// cleartext header, a nonce of up to 24 bytes and a 16-byte tag around
+	// the frame. AES-256-GCM and ChaCha20-Poly1305 frames are 1035 bytes.
+	EncryptedFrameSize = FrameSize + 11 + 24 + 16
 	KeySize            = 128
-	ValueSize          = 863
-	ResponseValueSize  = FrameSize - StatusSize
+	ValueSize          = FrameSize - CommandSize - FlagSize - RequestIDSize - KeySize
+	ResponseValueSize  = FrameSize - StatusSize - RequestIDSize - VersionSize
 	Port               = 4040
 	Timeout            = 5 * time.Second
 )
 
+// FrameDTO is a decoded request. IfVersion makes a GET conditional: when the
+// key is still at that version the server answers STATUS_NOT_MODIFIED without
+// the value. On the wire it travels in the value field under FLAG_IF_VERSION.
 type FrameDTO struct {
 	Cmd       byte
+	RequestID uint32
 	Key       string
 	Value     []byte
 	Overwrite bool
 	Old       bool
+	IfVersion uint64
 }
 
 func NewFrameDTO(cmdStr string, key, value string, overwrite, old bool) (FrameDTO, error) {
@@ -51,11 +94,18 @@ func NewFrameDTO(cmdStr string, key, value string, overwrite, old bool) (FrameDT
 		cmd = CMD_DELETE
 	case "exists":
 		cmd = CMD_EXISTS
+	case "info":
+		cmd = CMD_INFO
+	case "ping":
+		cmd = CMD_PING
+	case "scan":
+		cmd = CMD_SCAN
 	default:
 		return FrameDTO{}, fmt.Errorf("unknown command string %s", cmdStr)
 	}
 
-	if key == "" {
+	// SCAN carries its cursor in the key field; empty starts from the top.
+	if key == "" && cmd != CMD_INFO && cmd != CMD_PING && cmd != CMD_SCAN {
 		return FrameDTO{}, fmt.Errorf("key cannot be empty")
 	}
 
@@ -85,8 +135,20 @@ func NewFrameDTO(cmdStr string, key, value string, overwrite, old bool) (FrameDT
 }
 
 func FrameToDTO(frame []byte) (FrameDTO, error) {
+	dto, key, err := ParseFrame(frame)
+	if err != nil {
+		return FrameDTO{}, err
+	}
+	dto.Key = string(key)
+	return dto, nil
+}
+
+// ParseFrame is FrameToDTO without the key string, so that a server can look
+// keys up without allocating: dto.Key is empty and key, like dto.Value,
+// points into frame.
+func ParseFrame(frame []byte) (dto FrameDTO, key []byte, err error) {
 	if len(frame) != FrameSize {
-		return FrameDTO{}, fmt.Errorf("invalid frame size %d", len(frame))
+		return FrameDTO{}, nil, fmt.Errorf("invalid frame size %d", len(frame))
 	}
 
 	cmd := frame[0]
@@ -96,29 +158,44 @@ func FrameToDTO(frame []byte) (FrameDTO, error) {
 		uint32(frame[3])<<16 |
 		uint32(frame[4])<<24
 
-	start := CommandSize + FlagSize
+	requestID := getUint32(frame[CommandSize+FlagSize:])
+
+	start := CommandSize + FlagSize + RequestIDSize
 	keyBytes := frame[start : start+KeySize]
 	valBytes := frame[start+KeySize : start+KeySize+ValueSize]
 
 	overwrite := flags&FLAG_OVERWRITE != 0
 	old := flags&FLAG_OLD != 0
 
-	key := string(bytes.TrimRight(keyBytes, "\x00"))
+	key = bytes.TrimRight(keyBytes, "\x00")
 	value := bytes.TrimRight(valBytes, "\x00")
 
+	var ifVersion uint64
+	if flags&FLAG_IF_VERSION != 0 {
+		ifVersion = getUint64(valBytes)
+		value = nil
+	}
+
 	frameDTO := FrameDTO{
 		Cmd:       cmd,
-		Key:       key,
+		RequestID: requestID,
 		Value:     value,
 		Overwrite: overwrite,
 		Old:       old,
+		IfVersion: ifVersion,
 	}
 
-	return frameDTO, nil
+	return frameDTO, key, nil
 }
 
 func DtoToFrame(dto FrameDTO) []byte {
-	frame := make([]byte, FrameSize)
+	return AppendFrame(make([]byte, 0, FrameSize), dto)
+}
+
+// AppendFrame appends the request frame for dto to dst and returns the
+// extended slice. Given a dst with room for FrameSize more bytes it does not
+// allocate.
+func AppendFrame(dst []byte, dto FrameDTO) []byte {
 	var flags uint32
 
 	if dto.Overwrite {
@@ -129,22 +206,199 @@ func DtoToFrame(dto FrameDTO) []byte {
 		flags |= FLAG_OLD
 	}
 
+	if dto.IfVersion != 0 {
+		flags |= FLAG_IF_VERSION
+	}
+
+	dst, frame := grow(dst)
+
 	// Building the frame manually. While I could use the encoding/binary package I decided doing it by hand would be more clear.
 	frame[0] = dto.Cmd
 	frame[1] = byte(flags)
 	frame[2] = byte(flags >> 8)
 	frame[3] = byte(flags >> 16)
 	frame[4] = byte(flags >> 24)
+	putUint32(frame[CommandSize+FlagSize:], dto.RequestID)
+
+	start := CommandSize + FlagSize + RequestIDSize
+	copy(frame[start:start+KeySize], dto.Key)
+	if dto.IfVersion != 0 {
+		putUint64(frame[start+KeySize:], dto.IfVersion)
+	} else {
+		copy(frame[start+KeySize:], dto.Value)
+	}
+
+	return dst
+}
+
+// grow extends dst by one zeroed frame and returns it along with the frame.
+func grow(dst []byte) ([]byte, []byte) {
+	start := len(dst)
+	dst = slices.Grow(dst, FrameSize)[:start+FrameSize]
+	frame := dst[start:]
+	clear(frame)
+	return dst, frame
+}
+
+var buffers = sync.Pool{
+	New: func() any {
+		b := make([]byte, 0, EncryptedFrameSize)
+		return &b
+	},
+}
+
+// GetBuffer returns an empty buffer from a shared pool with room for one
+// encrypted frame, for use with AppendFrame and the encryptor's EncryptTo and
+// DecryptInto. Hand it back with PutBuffer once nothing refers to it.
+func GetBuffer() *[]byte {
+	return buffers.Get().(*[]byte)
+}
+
+func PutBuffer(b *[]byte) {
+	*b = (*b)[:0]
+	buffers.Put(b)
+}
+
+func CommandName(cmd byte) string {
+	switch cmd {
+	case CMD_SET:
+		return "set"
+	case CMD_GET:
+		return "get"
+	case CMD_DELETE:
+		return "delete"
+	case CMD_EXISTS:
+		return "exists"
+	case CMD_INFO:
+		return "info"
+	case CMD_PING:
+		return "ping"
+	case CMD_SCAN:
+		return "scan"
+	case CMD_HANDSHAKE:
+		return "handshake"
+	default:
+		return "unknown"
+	}
+}
+
+// PackKeys encodes as many of keys as fit in a response value, each as a
+// length byte followed by the key, and returns how many it packed. SCAN
+// responses use it; an empty page means the scan is complete.
+func PackKeys(keys []string) ([]byte, int) {
+	var packed []byte
+	for i, key := range keys {
+		if len(key) == 0 || len(key) > KeySize {
+			continue
+		}
+		if len(packed)+1+len(key) > ResponseValueSize {
+			return packed, i
+		}
+		packed = append(packed, byte(len(key)))
+		packed = append(packed, key...)
+	}
+	return packed, len(keys)
+}
+
+func UnpackKeys(packed []byte) ([]string, error) {
+	var keys []string
+	for len(packed) > 0 {
+		n := int(packed[0])
+		if n == 0 || 1+n > len(packed) {
+			return nil, fmt.Errorf("malformed key list at byte %d", len(packed))
+		}
+		keys = append(keys, string(packed[1:1+n]))
+		packed = packed[1+n:]
+	}
+	return keys, nil
+}
+
+// PublicKeySize is the size of an X25519 public key, which a handshake
+// request carries as its value.
+const PublicKeySize = 32
 
-	copy(frame[5:5+KeySize], []byte(dto.Key))
-	copy(frame[5+KeySize:], []byte(dto.Value))
+// UnpackPublicKey returns the public key in a handshake request's value.
+// Trailing zero bytes trimmed off on the wire are put back.
+func UnpackPublicKey(value []byte) ([]byte, error) {
+	if len(value) > PublicKeySize {
+		return nil, fmt.Errorf("handshake value is %d bytes, want %d", len(value), PublicKeySize)
+	}
+	public := make([]byte, PublicKeySize)
+	copy(public, value)
+	return public, nil
+}
+
+// PackSession encodes the server's answer to a handshake: its public key,
+// then the session ID and the session lifetime in seconds, both as 32-bit
+// little-endian integers.
+func PackSession(public []byte, id uint32, lifetime time.Duration) []byte {
+	packed := make([]byte, PublicKeySize+8)
+	copy(packed, public)
+	putUint32(packed[PublicKeySize:], id)
+	putUint32(packed[PublicKeySize+4:], uint32(lifetime/time.Second))
+	return packed
+}
+
+// UnpackSession decodes a value written by PackSession.
+func UnpackSession(value []byte) (public []byte, id uint32, lifetime time.Duration, err error) {
+	if len(value) > PublicKeySize+8 {
+		return nil, 0, 0, fmt.Errorf("session value is %d bytes, want %d", len(value), PublicKeySize+8)
+	}
+	packed := make([]byte, PublicKeySize+8)
+	copy(packed, value)
+	id = getUint32(packed[PublicKeySize:])
+	lifetime = time.Duration(getUint32(packed[PublicKeySize+4:])) * time.Second
+	return packed[:PublicKeySize], id, lifetime, nil
+}
 
-	return frame
+func StatusName(status byte) string {
+	switch status {
+	case STATUS_OK:
+		return "ok"
+	case STATUS_NOT_FOUND:
+		return "not_found"
+	case STATUS_ERROR:
+		return "error"
+	case STATUS_WRONG_TYPE:
+		return "wrong_type"
+	case STATUS_VALUE_TOO_LARGE:
+		return "value_too_large"
+	case STATUS_KEY_EXISTS:
+		return "key_exists"
+	case STATUS_AUTH_FAILURE:
+		return "auth_failure"
+	case STATUS_RATE_LIMITED:
+		return "rate_limited"
+	case STATUS_OUT_OF_MEMORY:
+		return "out_of_memory"
+	case STATUS_VERSION_MISMATCH:
+		return "version_mismatch"
+	case STATUS_UNKNOWN_COMMAND:
+		return "unknown_command"
+	case STATUS_INVALID_REQUEST:
+		return "invalid_request"
+	case STATUS_BUSY:
+		return "busy"
+	case STATUS_SESSION_EXPIRED:
+		return "session_expired"
+	case STATUS_SUITE_REFUSED:
+		return "suite_refused"
+	case STATUS_NOT_MODIFIED:
+		return "not_modified"
+	default:
+		return "unknown"
+	}
+}
+
+func IsError(status byte) bool {
+	return status >= STATUS_ERROR && status < STATUS_NOT_MODIFIED
 }
 
 type ResponseDTO struct {
-	Status byte
-	Value  []byte
+	Status    byte
+	RequestID uint32
+	Version   uint64
+	Value     []byte
 }
 
 func NewResponseDTO(status byte, value []byte) ResponseDTO {
@@ -154,11 +408,45 @@ func NewResponseDTO(status byte, value []byte) ResponseDTO {
 	}
 }
 
+func NewVersionedResponseDTO(status byte, version uint64, value []byte) ResponseDTO {
+	return ResponseDTO{
+		Status:  status,
+		Version: version,
+		Value:   value,
+	}
+}
+
+// NewBusyResponseDTO tells a client that the request was not run for lack of
+// capacity and when it is worth sending again. The delay travels in the value
+// as decimal milliseconds, which trailing-zero trimming cannot shorten.
+func NewBusyResponseDTO(retryAfter time.Duration) ResponseDTO {
+	return NewResponseDTO(STATUS_BUSY, []byte(strconv.FormatInt(retryAfter.Milliseconds(), 10)))
+}
+
+// RetryAfter returns the delay carried by a STATUS_BUSY response, or zero.
+func RetryAfter(dto ResponseDTO) time.Duration {
+	if dto.Status != STATUS_BUSY {
+		return 0
+	}
+	ms, err := strconv.ParseUint(string(dto.Value), 10, 32)
+	if err != nil {
+		return 0
+	}
+	return time.Duration(ms) * time.Millisecond
+}
+
 func ResponseDTOToFrame(dto ResponseDTO) []byte {
-	frame := make([]byte, FrameSize)
+	return AppendResponseFrame(make([]byte, 0, FrameSize), dto)
+}
+
+// AppendResponseFrame is the AppendFrame of responses.
+func AppendResponseFrame(dst []byte, dto ResponseDTO) []byte {
+	dst, frame := grow(dst)
 	frame[0] = dto.Status
-	copy(frame[StatusSize:], dto.Value)
-	return frame
+	putUint32(frame[StatusSize:], dto.RequestID)
+	putUint64(frame[StatusSize+RequestIDSize:], dto.Version)
+	copy(frame[StatusSize+RequestIDSize+VersionSize:], dto.Value)
+	return dst
 }
 
 func FrameToResponseDTO(frame []byte) (ResponseDTO, error) {
@@ -167,10 +455,39 @@ func FrameToResponseDTO(frame []byte) (ResponseDTO, error) {
 	}
 
 	status := frame[0]
-	value := bytes.TrimRight(frame[StatusSize:], "\x00")
+	requestID := getUint32(frame[StatusSize:])
+	version := getUint64(frame[StatusSize+RequestIDSize:])
+	value := bytes.TrimRight(frame[StatusSize+RequestIDSize+VersionSize:], "\x00")
 
 	return ResponseDTO{
-		Status: status,
-		Value:  value,
+		Status:    status,
+		RequestID: requestID,
+		Version:   version,
+		Value:     value,
 	}, nil
 }
+
+func putUint32(b []byte, v uint32) {
+	b[0] = byte(v)
+	b[1] = byte(v >> 8)
+	b[2] = byte(v >> 16)
+	b[3] = byte(v >> 24)
+}
+
+func getUint32(b []byte) uint32 {
+	return uint32(b[0]) | uint32(b[1])<<8 | uint32(b[2])<<16 | uint32(b[3])<<24
+}
+
+func putUint64(b []byte, v uint64) {
+	for i := range 8 {
+		b[i] = byte(v >> (8 * i))
+	}
+}
+
+func getUint64(b []byte) uint64 {
+	var v uint64
+	for i := range 8 {
+		v |= uint64(b[i]) << (8 * i)
+	}
+	return v
+}
@@ -1,9 +1,11 @@
 package protocol
 
 import (
+	"bytes"
 	"reflect"
 	"strings"
 	"testing"
+	"time"
 )
 
 func TestProtocol(t *testing.T) {
@@ -81,6 +83,14 @@ func TestProtocol(t *testing.T) {
 			cmd:  "exists",
 			key:  "key",
 		},
+		{
+			name: "successful new info without key",
+			cmd:  "info",
+		},
+		{
+			name: "successful new ping without key",
+			cmd:  "ping",
+		},
 		{
 			name:  "failed new set key empty",
 			cmd:   "set",
@@ -126,6 +136,7 @@ func TestProtocol(t *testing.T) {
 				return
 			}
 
+			dto.RequestID = 0xdeadbeef
 			frame := DtoToFrame(dto)
 
 			got, err := FrameToDTO(frame)
@@ -148,3 +159,276 @@ func TestFrameToLarge(t *testing.T) {
 		t.Errorf("frame should return size error")
 	}
 }
+
+func TestNames(t *testing.T) {
+	for cmd, want := range map[byte]string{CMD_SET: "set", CMD_GET: "get", CMD_DELETE: "delete", CMD_EXISTS: "exists", CMD_INFO: "info", CMD_PING: "ping", CMD_SCAN: "scan", CMD_HANDSHAKE: "handshake", 200: "unknown"} {
+		if got := CommandName(cmd); got != want {
+			t.Errorf("CommandName(%d) = %q, want %q", cmd, got, want)
+		}
+	}
+
+	for status, want := range map[byte]string{
+		STATUS_OK:               "ok",
+		STATUS_NOT_FOUND:        "not_found",
+		STATUS_ERROR:            "error",
+		STATUS_WRONG_TYPE:       "wrong_type",
+		STATUS_VALUE_TOO_LARGE:  "value_too_large",
+		STATUS_KEY_EXISTS:       "key_exists",
+		STATUS_AUTH_FAILURE:     "auth_failure",
+		STATUS_RATE_LIMITED:     "rate_limited",
+		STATUS_OUT_OF_MEMORY:    "out_of_memory",
+		STATUS_VERSION_MISMATCH: "version_mismatch",
+		STATUS_UNKNOWN_COMMAND:  "unknown_command",
+		STATUS_INVALID_REQUEST:  "invalid_request",
+		STATUS_BUSY:             "busy",
+		STATUS_SESSION_EXPIRED:  "session_expired",
+		STATUS_SUITE_REFUSED:    "suite_refused",
+		STATUS_NOT_MODIFIED:     "not_modified",
+		200:                     "unknown",
+	} {
+		if got := StatusName(status); got != want {
+			t.Errorf("StatusName(%d) = %q, want %q", status, got, want)
+		}
+	}
+}
+
+func TestIsError(t *testing.T) {
+	for _, status := range []byte{STATUS_OK, STATUS_NOT_FOUND, STATUS_NOT_MODIFIED} {
+		if IsError(status) {
+			t.Errorf("IsError(%s) = true, want false", StatusName(status))
+		}
+	}
+
+	for _, status := range []byte{STATUS_ERROR, STATUS_KEY_EXISTS, STATUS_RATE_LIMITED, STATUS_INVALID_REQUEST, STATUS_BUSY, STATUS_SESSION_EXPIRED, STATUS_SUITE_REFUSED} {
+		if !IsError(status) {
+			t.Errorf("IsError(%s) = false, want true", StatusName(status))
+		}
+	}
+}
+
+func TestResponseFrameRoundTrip(t *testing.T) {
+	tests := []struct {
+		name string
+		dto  ResponseDTO
+	}{
+		{
+			name: "ok with version",
+			dto:  NewVersionedResponseDTO(STATUS_OK, 1<<40|7, []byte("value")),
+		},
+		{
+			name: "request id echoed",
+			dto:  ResponseDTO{Status: STATUS_OK, RequestID: 0xfeedface, Version: 2, Value: []byte("v")},
+		},
+		{
+			name: "not found",
+			dto:  NewResponseDTO(STATUS_NOT_FOUND, []byte{}),
+		},
+		{
+			name: "max size value",
+			dto:  NewVersionedResponseDTO(STATUS_OK, 3, []byte(strings.Repeat("v", ResponseValueSize))),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			frame := ResponseDTOToFrame(tt.dto)
+			if len(frame) != FrameSize {
+				t.Fatalf("frame size: want %d, got %d", FrameSize, len(frame))
+			}
+
+			got, err := FrameToResponseDTO(frame)
+			if err != nil {
+				t.Fatalf("failed to parse response frame: %v", err)
+			}
+
+			if !reflect.DeepEqual(tt.dto, got) {
+				t.Errorf("got %+v, want %+v", got, tt.dto)
+			}
+		})
+	}
+}
+
+func TestResponseFrameInvalidSize(t *testing.T) {
+	if _, err := FrameToResponseDTO(make([]byte, FrameSize-1)); err == nil {
+		t.Errorf("response frame should return size error")
+	}
+}
+
+func TestIfVersionRoundTrip(t *testing.T) {
+	for _, version := range []uint64{1, 0x100, 1 << 56, ^uint64(0)} {
+		dto := FrameDTO{Cmd: CMD_GET, RequestID: 7, Key: "key", IfVersion: version}
+
+		got, err := FrameToDTO(DtoToFrame(dto))
+		if err != nil {
+			t.Fatalf("failed to parse frame: %v", err)
+		}
+
+		if !reflect.DeepEqual(dto, got) {
+			t.Errorf("got %+v, want %+v", got, dto)
+		}
+	}
+}
+
+func TestPackKeys(t *testing.T) {
+	keys := make([]string, 20)
+	for i := range keys {
+		keys[i] = strings.Repeat(string(rune('a'+i)), 100)
+	}
+
+	packed, n := PackKeys(keys)
+	if n != ResponseValueSize/101 {
+		t.Errorf("want %d keys to fit, got %d", ResponseValueSize/101, n)
+	}
+
+	got, err := UnpackKeys(packed)
+	if err != nil {
+		t.Fatalf("unpack: %v", err)
+	}
+	if !reflect.DeepEqual(got, keys[:n]) {
+		t.Errorf("round trip mismatch: got %d keys", len(got))
+	}
+
+	if _, err := UnpackKeys([]byte{5, 'a'}); err == nil {
+		t.Errorf("want error for truncated key list")
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	tests := []struct {
+		name     string
+		response ResponseDTO
+		want     time.Duration
+	}{
+		{name: "busy", response: NewBusyResponseDTO(20 * time.Millisecond), want: 20 * time.Millisecond},
+		{name: "round number survives trimming", response: NewBusyResponseDTO(100 * time.Millisecond), want: 100 * time.Millisecond},
+		{name: "other status", response: NewResponseDTO(STATUS_OK, []byte("20")), want: 0},
+		{name: "garbage", response: NewResponseDTO(STATUS_BUSY, []byte("soon")), want: 0},
+	}
+
+	for _, tt := range tests {
+		decoded, err := FrameToResponseDTO(ResponseDTOToFrame(tt.response))
+		if err != nil {
+			t.Fatalf("%s: decode: %v", tt.name, err)
+		}
+		if got := RetryAfter(decoded); got != tt.want {
+			t.Errorf("%s: want %v, got %v", tt.name, tt.want, got)
+		}
+	}
+}
+
+func TestHandshakeValues(t *testing.T) {
+	// Keys ending in zero bytes lose them to trimming on the wire.
+	public := append(bytes.Repeat([]byte{9}, PublicKeySize-2), 0, 0)
+
+	request, err := FrameToDTO(DtoToFrame(FrameDTO{Cmd: CMD_HANDSHAKE, Value: public}))
+	if err != nil {
+		t.Fatalf("decode request: %v", err)
+	}
+	if got, err := UnpackPublicKey(request.Value); err != nil || !bytes.Equal(got, public) {
+		t.Errorf("want the public key back, got %x, %v", got, err)
+	}
+
+	response, err := FrameToResponseDTO(ResponseDTOToFrame(NewResponseDTO(STATUS_OK, PackSession(public, 7, time.Hour))))
+	if err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	gotPublic, id, lifetime, err := UnpackSession(response.Value)
+	if err != nil || !bytes.Equal(gotPublic, public) || id != 7 || lifetime != time.Hour {
+		t.Errorf("want the session back, got %x, %d, %v, %v", gotPublic, id, lifetime, err)
+	}
+
+	if _, err := UnpackPublicKey(make([]byte, PublicKeySize+1)); err == nil {
+		t.Error("want an oversized public key refused")
+	}
+	if _, _, _, err := UnpackSession(make([]byte, PublicKeySize+9)); err == nil {
+		t.Error("want an oversized session refused")
+	}
+}
+
+func TestAppendFrameReusesBuffer(t *testing.T) {
+	request := FrameDTO{Cmd: CMD_SET, RequestID: 9, Key: "cat", Value: []byte("jack"), Overwrite: true}
+	response := NewVersionedResponseDTO(STATUS_OK, 4, []byte("jack"))
+
+	// A buffer left dirty by a longer frame must not leak into the next one.
+	dirty := bytes.Repeat([]byte{0xff}, FrameSize)
+	if got := AppendFrame(dirty[:0], request); !bytes.Equal(got, DtoToFrame(request)) {
+		t.Error("request frame differs after reusing a dirty buffer")
+	}
+	if got := AppendResponseFrame(dirty[:0], response); !bytes.Equal(got, ResponseDTOToFrame(response)) {
+		t.Error("response frame differs after reusing a dirty buffer")
+	}
+
+	if got := AppendFrame([]byte("prefix"), request); !bytes.Equal(got[6:], DtoToFrame(request)) || string(got[:6]) != "prefix" {
+		t.Error("want the frame appended after the prefix")
+	}
+
+	allocs := testing.AllocsPerRun(100, func() {
+		buf := GetBuffer()
+		*buf = AppendFrame(*buf, request)
+		*buf = AppendResponseFrame((*buf)[:0], response)
+		PutBuffer(buf)
+	})
+	if allocs != 0 {
+		t.Errorf("want no allocations with a pooled buffer, got %v", allocs)
+	}
+}
+
+func TestParseFrame(t *testing.T) {
+	request := FrameDTO{Cmd: CMD_SET, RequestID: 9, Key: "cat", Value: []byte("jack"), Overwrite: true}
+	frame := DtoToFrame(request)
+
+	dto, key, err := ParseFrame(frame)
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if string(key) != "cat" || dto.Key != "" || string(dto.Value) != "jack" || dto.RequestID != 9 || !dto.Overwrite {
+		t.Errorf("unexpected parse: %+v, key %q", dto, key)
+	}
+	if full, err := FrameToDTO(frame); err != nil || full.Key != "cat" {
+		t.Errorf("want FrameToDTO to fill in the key, got %q, %v", full.Key, err)
+	}
+
+	allocs := testing.AllocsPerRun(100, func() {
+		_, _, _ = ParseFrame(frame)
+	})
+	if allocs != 0 {
+		t.Errorf("want no allocations, got %v", allocs)
+	}
+}
+
+// sink keeps benchmarked frames from being optimised onto the stack.
+var sink []byte
+
+func BenchmarkFrameEncoding(b *testing.B) {
+	request := FrameDTO{Cmd: CMD_SET, Key: "cat", Value: []byte("jack"), Overwrite: true}
+	response := NewVersionedResponseDTO(STATUS_OK, 4, []byte("jack"))
+
+	b.Run("DtoToFrame", func(b *testing.B) {
+		b.ReportAllocs()
+		for b.Loop() {
+			sink = DtoToFrame(request)
+		}
+	})
+	b.Run("AppendFrame", func(b *testing.B) {
+		b.ReportAllocs()
+		for b.Loop() {
+			buf := GetBuffer()
+			*buf = AppendFrame(*buf, request)
+			PutBuffer(buf)
+		}
+	})
+	b.Run("ResponseDTOToFrame", func(b *testing.B) {
+		b.ReportAllocs()
+		for b.Loop() {
+			sink = ResponseDTOToFrame(response)
+		}
+	})
+	b.Run("AppendResponseFrame", func(b *testing.B) {
+		b.ReportAllocs()
+		for b.Loop() {
+			buf := GetBuffer()
+			*buf = AppendResponseFrame(*buf, response)
+			PutBuffer(buf)
+		}
+	})
+}
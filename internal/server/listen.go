@@ -0,0 +1,32 @@
+package server
+
+import (
+	"context"
+	"net"
+)
+
+// listen binds n UDP sockets to addr. With more than one, every socket sets
+// SO_REUSEPORT and the kernel spreads incoming datagrams across them by
+// source address, so each reader sees a fixed share of the clients.
+func listen(addr string, n int) ([]*net.UDPConn, error) {
+	var lc net.ListenConfig
+	if n > 1 {
+		lc.Control = reusePort
+	}
+
+	conns := make([]*net.UDPConn, 0, n)
+	for range n {
+		c, err := lc.ListenPacket(context.Background(), "udp", addr)
+		if err != nil {
+			for _, c := range conns {
+				_ = c.Close()
+			}
+			return nil, err
+		}
+		conns = append(conns, c.(*net.UDPConn))
+		// Later sockets must share the port the first one was given when
+		// addr asks for any free port.
+		addr = c.LocalAddr().String()
+	}
+	return conns, nil
+}
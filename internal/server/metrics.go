@@ -0,0 +1,95 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/thesimpledev/skvs/internal/metrics"
+	"github.com/thesimpledev/skvs/internal/skvs"
+)
+
+type serverMetrics struct {
+	registry         *metrics.Registry
+	requests         *metrics.CounterVec
+	latency          *metrics.HistogramVec
+	decryptFailures  *metrics.Counter
+	dropped          *metrics.Counter
+	readErrors       *metrics.Counter
+	snapshots        *metrics.Counter
+	snapshotFailures *metrics.Counter
+}
+
+func (s *Server) newMetrics() *serverMetrics {
+	r := metrics.NewRegistry()
+	m := &serverMetrics{
+		registry:         r,
+		requests:         r.NewCounterVec("skvs_requests_total", "Requests processed, by command and response status.", "command", "status"),
+		latency:          r.NewHistogramVec("skvs_request_duration_seconds", "Time spent handling a request, from decrypt to response write.", nil, "command"),
+		decryptFailures:  r.NewCounter("skvs_decrypt_failures_total", "Datagrams that could not be decrypted."),
+		dropped:          r.NewCounter("skvs_requests_dropped_total", "Requests answered BUSY because max_concurrency was reached."),
+		readErrors:       r.NewCounter("skvs_read_errors_total", "Non-timeout errors returned while reading from the UDP socket."),
+		snapshots:        r.NewCounter("skvs_snapshots_total", "Snapshots written to disk."),
+		snapshotFailures: r.NewCounter("skvs_snapshot_failures_total", "Snapshots that could not be written."),
+	}
+
+	r.NewGaugeFunc("skvs_handlers_in_flight", "Requests queued or being handled.", func() float64 {
+		return float64(s.inFlight.Load())
+	})
+	r.NewGaugeFunc("skvs_handlers_capacity", "Requests that may be queued or handled at once.", func() float64 {
+		return float64(s.cfg.MaxConcurrency)
+	})
+	r.NewGaugeFunc("skvs_queue_depth", "Requests waiting for a worker.", func() float64 {
+		return float64(len(s.queue))
+	})
+	r.NewGaugeFunc("skvs_workers", "Workers handling requests.", func() float64 {
+		return float64(s.workers)
+	})
+	r.NewGaugeFunc("skvs_sessions", "Session keys held, including expired ones not yet swept.", func() float64 {
+		return float64(s.sessions.len())
+	})
+	r.NewGaugeFunc("skvs_keys", "Keys currently stored.", func() float64 {
+		return float64(s.app.Len())
+	})
+	r.NewGaugeFunc("skvs_memory_bytes", "Key and value bytes currently stored.", func() float64 {
+		return float64(s.app.Bytes())
+	})
+
+	return m
+}
+
+func (s *Server) stats() skvs.ServerStats {
+	return skvs.ServerStats{
+		InFlight:      int(s.inFlight.Load()),
+		Capacity:      s.cfg.MaxConcurrency,
+		Dropped:       s.metrics.dropped.Value(),
+		DecryptErrors: s.metrics.decryptFailures.Value(),
+	}
+}
+
+// MetricsHandler serves the Prometheus metrics, for callers that want them
+// on their own HTTP server instead of metrics_addr.
+func (s *Server) MetricsHandler() http.Handler {
+	return s.metrics.registry.Handler()
+}
+
+func (s *Server) serveMetrics() {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", s.MetricsHandler())
+
+	srv := &http.Server{
+		Addr:              s.cfg.MetricsAddr,
+		Handler:           mux,
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+
+	go func() {
+		<-s.quit
+		_ = srv.Close()
+	}()
+
+	s.log.Info("serving metrics", "addr", s.cfg.MetricsAddr)
+	if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		s.log.Error("metrics server failed", "err", err)
+	}
+}
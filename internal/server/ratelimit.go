@@ -0,0 +1,99 @@
+package server
+
+import (
+	"net/netip"
+	"sync"
+	"time"
+)
+
+// sweepInterval is how often buckets that have refilled completely are
+// forgotten, so the map only holds recently active sources.
+const sweepInterval = time.Minute
+
+// rateLimited is the value of RATE_LIMITED answers. Response values are only
+// read, so it is shared.
+var rateLimited = []byte("rate limit exceeded")
+
+// rateLimiter keeps one token bucket per source IP. A rate of zero disables
+// it. Ports are ignored so a client cannot dodge the limit by opening more
+// sockets.
+type rateLimiter struct {
+	mu        sync.Mutex
+	rate      float64
+	burst     float64
+	buckets   map[netip.Addr]*bucket
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+func newRateLimiter() *rateLimiter {
+	return &rateLimiter{buckets: make(map[netip.Addr]*bucket), now: time.Now}
+}
+
+func (l *rateLimiter) setLimit(rate float64, burst int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.rate = rate
+	l.burst = float64(burst)
+	if rate == 0 {
+		clear(l.buckets)
+	}
+}
+
+// allow takes a token from addr's bucket and reports whether there was one.
+func (l *rateLimiter) allow(addr netip.Addr) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.rate == 0 {
+		return true
+	}
+
+	now := l.now()
+	if now.Sub(l.lastSweep) > sweepInterval {
+		l.sweep(now)
+	}
+
+	b, ok := l.buckets[addr]
+	if !ok {
+		b = &bucket{tokens: l.burst, last: now}
+		l.buckets[addr] = b
+	}
+	b.tokens = min(l.burst, b.tokens+now.Sub(b.last).Seconds()*l.rate)
+	b.last = now
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// exhausted reports whether addr has used up its bucket, without creating a
+// bucket or taking a token, so it is safe to ask before the request is
+// authenticated.
+func (l *rateLimiter) exhausted(addr netip.Addr) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.rate == 0 {
+		return false
+	}
+	b, ok := l.buckets[addr]
+	if !ok {
+		return false
+	}
+	return b.tokens+l.now().Sub(b.last).Seconds()*l.rate < 1
+}
+
+func (l *rateLimiter) sweep(now time.Time) {
+	full := time.Duration(l.burst / l.rate * float64(time.Second))
+	for addr, b := range l.buckets {
+		if now.Sub(b.last) >= full {
+			delete(l.buckets, addr)
+		}
+	}
+	l.lastSweep = now
+}
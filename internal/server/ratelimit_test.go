@@ -0,0 +1,69 @@
+package server
+
+import (
+	"net/netip"
+	"testing"
+	"time"
+)
+
+func TestRateLimiter(t *testing.T) {
+	now := time.Unix(0, 0)
+	l := newRateLimiter()
+	l.now = func() time.Time { return now }
+	l.setLimit(10, 2)
+
+	a := netip.MustParseAddr("10.0.0.1")
+	b := netip.MustParseAddr("10.0.0.2")
+
+	steps := []struct {
+		name    string
+		advance time.Duration
+		addr    netip.Addr
+		want    bool
+	}{
+		{name: "burst 1", addr: a, want: true},
+		{name: "burst 2", addr: a, want: true},
+		{name: "empty", addr: a, want: false},
+		{name: "other source has its own bucket", addr: b, want: true},
+		{name: "half a token", advance: 50 * time.Millisecond, addr: a, want: false},
+		{name: "refilled one", advance: 50 * time.Millisecond, addr: a, want: true},
+		{name: "refill capped at burst", advance: time.Hour, addr: a, want: true},
+		{name: "second of burst", addr: a, want: true},
+		{name: "burst used", addr: a, want: false},
+	}
+	for _, tt := range steps {
+		now = now.Add(tt.advance)
+		if got := l.allow(tt.addr); got != tt.want {
+			t.Errorf("%s: want %v, got %v", tt.name, tt.want, got)
+		}
+	}
+
+	if _, ok := l.buckets[b]; ok {
+		t.Error("want idle bucket swept")
+	}
+
+	c := netip.MustParseAddr("10.0.0.3")
+	if l.exhausted(c) {
+		t.Error("want a source without a bucket not exhausted")
+	}
+	if _, ok := l.buckets[c]; ok {
+		t.Error("want exhausted not to create a bucket")
+	}
+	if !l.exhausted(a) {
+		t.Error("want an empty bucket exhausted")
+	}
+	now = now.Add(100 * time.Millisecond)
+	if l.exhausted(a) {
+		t.Error("want a refilled bucket not exhausted")
+	}
+	if !l.allow(a) {
+		t.Error("want exhausted not to take the refilled token")
+	}
+
+	l.setLimit(0, 2)
+	for range 10 {
+		if !l.allow(a) {
+			t.Fatal("want no limit with a zero rate")
+		}
+	}
+}
@@ -0,0 +1,52 @@
+package server
+
+import (
+	"time"
+
+	"github.com/thesimpledev/skvs/internal/config"
+	"github.com/thesimpledev/skvs/internal/skvs"
+)
+
+// applyHot applies the settings that can change while the server runs.
+func (s *Server) applyHot(cfg config.Config) {
+	level, _ := cfg.Level()
+	s.level.Set(level)
+	s.readTimeout.Store(int64(cfg.ReadTimeout))
+	s.snapshotInterval.Store(int64(cfg.SnapshotInterval))
+	s.shutdownTimeout.Store(int64(cfg.ShutdownTimeout))
+	s.busyRetryAfter.Store(int64(cfg.BusyRetryAfter))
+	s.sessionTTL.Store(int64(cfg.SessionTTL))
+	s.requireSession.Store(cfg.RequireSession)
+	s.app.SetLimits(cfg.MaxKeys, cfg.MaxMemoryBytes)
+	s.limiter.setLimit(cfg.RateLimit, cfg.RateBurst)
+	s.app.SetQuotas(skvs.Quotas{Separator: cfg.TenantSeparator, MaxKeys: cfg.TenantMaxKeys, MaxBytes: cfg.TenantMaxBytes})
+}
+
+// Reload applies the hot settings in next at once. Changes to the others are
+// logged and wait for a restart.
+func (s *Server) Reload(next config.Config) error {
+	if err := next.Validate(); err != nil {
+		s.log.Error("configuration reload rejected", "err", err)
+		return err
+	}
+	if cold := s.cfg.ColdChanges(next); len(cold) > 0 {
+		s.log.Warn("configuration changes need a restart", "settings", cold)
+	}
+	s.applyHot(next)
+
+	s.log.Info("configuration reloaded",
+		"log_level", next.LogLevel,
+		"read_timeout", time.Duration(next.ReadTimeout),
+		"snapshot_interval", time.Duration(next.SnapshotInterval),
+		"shutdown_timeout", time.Duration(next.ShutdownTimeout),
+		"busy_retry_after", time.Duration(next.BusyRetryAfter),
+		"session_ttl", time.Duration(next.SessionTTL),
+		"require_session", next.RequireSession,
+		"max_keys", next.MaxKeys,
+		"max_memory_bytes", next.MaxMemoryBytes,
+		"rate_limit", next.RateLimit,
+		"rate_burst", next.RateBurst,
+		"tenant_max_keys", next.TenantMaxKeys,
+		"tenant_max_bytes", next.TenantMaxBytes)
+	return nil
+}
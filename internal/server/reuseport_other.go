@@ -0,0 +1,12 @@
+//go:build !unix
+
+package server
+
+import (
+	"errors"
+	"syscall"
+)
+
+func reusePort(_, _ string, _ syscall.RawConn) error {
+	return errors.New("more than one reader needs SO_REUSEPORT, which this platform lacks")
+}
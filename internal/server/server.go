@@ -0,0 +1,340 @@
+// Package server runs the encrypted UDP front end of the store. It is used by
+// cmd/server and can also be started in-process, for example by tests or by
+// programs that embed a store.
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"os"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/thesimpledev/skvs/internal/config"
+	"github.com/thesimpledev/skvs/internal/encryption"
+	"github.com/thesimpledev/skvs/internal/protocol"
+	"github.com/thesimpledev/skvs/internal/skvs"
+)
+
+// ErrServerClosed is returned by ListenAndServe after Shutdown is called.
+var ErrServerClosed = errors.New("server closed")
+
+type Server struct {
+	log     *slog.Logger
+	level   *slog.LevelVar
+	keyring *encryption.Keyring
+	conns   []*net.UDPConn
+	app     *skvs.App
+	limiter *rateLimiter
+	metrics *serverMetrics
+
+	// psk is the pre-shared key, keyID its ID on the wire. Requests with
+	// any other key ID are looked up in sessions.
+	psk              []byte
+	keyID            uint32
+	sessions         *sessionTable
+	unopenedLimiter  *rateLimiter
+	handshakeLimiter *rateLimiter
+
+	// Requests flow from the readers through queue to the workers in
+	// preallocated packets that are recycled through free. inFlight counts
+	// packets accepted and not yet answered and is capped at max_concurrency.
+	queue    chan *packet
+	free     chan *packet
+	inFlight atomic.Int64
+	workers  int
+	handle   func(*packet)
+
+	// cfg is the configuration the server was created with and is never
+	// modified. Hot settings live in the atomics below and in the logger
+	// level and store limits, which Reload updates.
+	cfg              config.Config
+	readTimeout      atomic.Int64
+	snapshotInterval atomic.Int64
+	shutdownTimeout  atomic.Int64
+	busyRetryAfter   atomic.Int64
+	sessionTTL       atomic.Int64
+	requireSession   atomic.Bool
+
+	started time.Time
+	served  atomic.Uint64
+
+	startOnce    sync.Once
+	shutdownOnce sync.Once
+	quit         chan struct{}
+	readers      sync.WaitGroup
+	workersDone  chan struct{}
+	shutdownErr  error
+}
+
+type Option func(*Server)
+
+// WithLogOutput sends the server's text logs to w. The default is stdout;
+// tests usually pass io.Discard.
+func WithLogOutput(w io.Writer) Option {
+	return func(s *Server) {
+		s.log = slog.New(slog.NewTextHandler(w, &slog.HandlerOptions{Level: s.level}))
+	}
+}
+
+// New validates cfg and builds a server. Nothing is bound until Start or
+// ListenAndServe.
+func New(cfg config.Config, opts ...Option) (*Server, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid configuration: %w", err)
+	}
+
+	suites, err := encryption.ParseSuites(cfg.CipherSuites)
+	if err != nil {
+		return nil, fmt.Errorf("parse cipher suites: %w", err)
+	}
+	key, err := cfg.KeySource().Load()
+	if err != nil {
+		return nil, fmt.Errorf("load key: %w", err)
+	}
+	keyring, err := encryption.NewKeyring(key, suites...)
+	if err != nil {
+		return nil, fmt.Errorf("create keyring: %w", err)
+	}
+
+	s := &Server{
+		level:            &slog.LevelVar{},
+		keyring:          keyring,
+		psk:              key,
+		keyID:            encryption.KeyID(key),
+		sessions:         newSessionTable(),
+		unopenedLimiter:  newRateLimiter(),
+		handshakeLimiter: newRateLimiter(),
+		cfg:              cfg,
+		limiter:          newRateLimiter(),
+		workers:          cfg.Workers,
+		quit:             make(chan struct{}),
+		workersDone:      make(chan struct{}),
+	}
+	if s.workers == 0 {
+		s.workers = runtime.GOMAXPROCS(0)
+	}
+	s.unopenedLimiter.setLimit(unopenedRate, unopenedBurst)
+	s.handshakeLimiter.setLimit(handshakeRate, handshakeBurst)
+	s.handle = s.respond
+	s.newPackets()
+	WithLogOutput(os.Stdout)(s)
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	s.app = skvs.New(s.log)
+	s.applyHot(cfg)
+	s.metrics = s.newMetrics()
+	s.app.SetServerStats(s.stats)
+	return s, nil
+}
+
+// Start restores the snapshot, binds the UDP socket and serves in the
+// background until Shutdown is called. It may only be called once.
+func (s *Server) Start() error {
+	err := errors.New("server already started")
+	s.startOnce.Do(func() { err = s.start() })
+	return err
+}
+
+func (s *Server) start() error {
+	if err := s.restoreSnapshot(); err != nil {
+		return fmt.Errorf("restore snapshot %s: %w", s.cfg.SnapshotPath, err)
+	}
+
+	conns, err := listen(s.cfg.Addr, s.cfg.Readers)
+	if err != nil {
+		return err
+	}
+	s.conns = conns
+
+	s.started = time.Now()
+	s.log.Info("listening", "addr", s.Addr(), "readers", len(s.conns), "workers", s.workers,
+		"max_concurrency", s.cfg.MaxConcurrency, "snapshot_path", s.cfg.SnapshotPath)
+
+	if s.cfg.MetricsAddr != "" {
+		go s.serveMetrics()
+	}
+	if s.cfg.SnapshotPath != "" {
+		go s.snapshotLoop()
+	}
+	s.serve()
+	return nil
+}
+
+// ListenAndServe starts the server and blocks until ctx is cancelled, then
+// shuts down within the configured shutdown timeout. If Shutdown is called
+// instead, it returns ErrServerClosed straight away and Shutdown does the
+// waiting.
+func (s *Server) ListenAndServe(ctx context.Context) error {
+	if err := s.Start(); err != nil {
+		return err
+	}
+
+	select {
+	case <-ctx.Done():
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), time.Duration(s.shutdownTimeout.Load()))
+		defer cancel()
+		return s.Shutdown(shutdownCtx)
+	case <-s.quit:
+		return ErrServerClosed
+	}
+}
+
+// Addr is the address the sockets are bound to, which tells callers the port
+// picked when the configured address ends in ":0". It is nil before Start.
+func (s *Server) Addr() net.Addr {
+	if len(s.conns) == 0 {
+		return nil
+	}
+	return s.conns[0].LocalAddr()
+}
+
+// Logger is the server's logger, whose level follows the log_level setting.
+func (s *Server) Logger() *slog.Logger {
+	return s.log
+}
+
+// App is the store behind the server.
+func (s *Server) App() *skvs.App {
+	return s.app
+}
+
+// respond decrypts and runs the request in p and leaves the encrypted
+// response in p.out, which stays empty if there is nothing to send back.
+// Every step writes into the packet's own buffers.
+func (s *Server) respond(p *packet) {
+	start := time.Now()
+	p.out = p.out[:0]
+
+	e, payload, err := s.decrypt(p)
+	if err != nil {
+		s.metrics.decryptFailures.Inc()
+		switch {
+		case errors.Is(err, errSessionExpired):
+			s.unopened(p, protocol.STATUS_SESSION_EXPIRED, []byte(err.Error()))
+			return
+		case errors.Is(err, encryption.ErrSuiteRefused):
+			s.unopened(p, protocol.STATUS_SUITE_REFUSED, []byte(err.Error()))
+			return
+		}
+		s.log.Error("Decrypt failed", "Err", err)
+		return
+	}
+
+	// DecryptInto only returns whole frames, so the command byte is there.
+	command := protocol.CommandName(payload[0])
+	defer func() {
+		s.metrics.latency.WithLabelValues(command).Observe(time.Since(start).Seconds())
+	}()
+
+	var response []byte
+	switch {
+	case !s.limiter.allow(sourceIP(p.addr)):
+		response, err = refuse(p.frame[:0], payload, protocol.NewResponseDTO(protocol.STATUS_RATE_LIMITED, rateLimited))
+	case payload[0] == protocol.CMD_HANDSHAKE || (s.requireSession.Load() && e.KeyID() == s.keyID):
+		response, err = s.processSessionless(p.frame[:0], e, payload, p.addr)
+	default:
+		response, err = skvs.ProcessMessageTo(p.frame[:0], s.app, payload)
+	}
+	if err != nil {
+		s.log.Error("failed to process message", "err", err)
+		response = protocol.AppendResponseFrame(p.frame[:0], protocol.NewResponseDTO(protocol.STATUS_INVALID_REQUEST, []byte("failed to process message")))
+	}
+	p.frame = response
+	s.metrics.requests.WithLabelValues(command, protocol.StatusName(response[0])).Inc()
+	s.served.Add(1)
+
+	encryptedResponse, err := e.EncryptTo(p.out, encryption.Response, response)
+	if err != nil {
+		s.log.Error("Encryption failed", "Err", err)
+		return
+	}
+	p.out = encryptedResponse
+}
+
+// processSessionless answers a handshake, or refuses a request sealed with
+// the pre-shared key when require_session is set.
+func (s *Server) processSessionless(dst []byte, e encryption.Encryptor, payload []byte, addr net.Addr) ([]byte, error) {
+	request, err := protocol.FrameToDTO(payload)
+	if err != nil {
+		return nil, err
+	}
+	response := protocol.NewResponseDTO(protocol.STATUS_AUTH_FAILURE, []byte("session required"))
+	if request.Cmd == protocol.CMD_HANDSHAKE {
+		response = s.handshake(e, request, addr)
+	}
+	response.RequestID = request.RequestID
+	return protocol.AppendResponseFrame(dst, response), nil
+}
+
+// refuse appends the frame answering the request in payload with response,
+// without running it.
+func refuse(dst, payload []byte, response protocol.ResponseDTO) ([]byte, error) {
+	request, _, err := protocol.ParseFrame(payload)
+	if err != nil {
+		return nil, err
+	}
+	response.RequestID = request.RequestID
+	return protocol.AppendResponseFrame(dst, response), nil
+}
+
+// reject answers a request with response without running it. It runs on a
+// reader, so a request turned away costs a decrypt and an encrypt but never
+// a place in the queue.
+func (s *Server) reject(p *packet, response protocol.ResponseDTO) {
+	e, payload, err := s.decrypt(p)
+	if err != nil {
+		s.metrics.decryptFailures.Inc()
+		return
+	}
+	request, err := protocol.FrameToDTO(payload)
+	if err != nil {
+		return
+	}
+	s.metrics.requests.WithLabelValues(protocol.CommandName(request.Cmd), protocol.StatusName(response.Status)).Inc()
+
+	response.RequestID = request.RequestID
+	p.frame = protocol.AppendResponseFrame(p.frame[:0], response)
+	encryptedResponse, err := e.EncryptTo(p.out[:0], encryption.Response, p.frame)
+	if err != nil {
+		s.log.Error("Encryption failed", "Err", err)
+		return
+	}
+	p.out = encryptedResponse
+	s.log.Debug("request rejected", "addr", p.addr, "status", protocol.StatusName(response.Status))
+	if _, err := p.conn.WriteTo(encryptedResponse, nil, p.addr); err != nil {
+		s.log.Error("failed to write response", "err", err)
+	}
+}
+
+// decrypt opens the request in p with the session or the suite it was
+// sealed with and returns that encryptor, which the response must use too.
+func (s *Server) decrypt(p *packet) (encryption.Encryptor, []byte, error) {
+	h, err := encryption.ParseHeader(p.buf[:p.n])
+	if err != nil {
+		return nil, nil, err
+	}
+	var e encryption.Encryptor
+	if h.KeyID == s.keyID {
+		e, err = s.keyring.For(p.buf[:p.n])
+	} else {
+		e, err = s.sessions.get(h.KeyID, time.Now())
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	payload, err := e.DecryptInto(p.plain[:0], encryption.Request, p.buf[:p.n])
+	if err != nil {
+		return nil, nil, err
+	}
+	p.plain = payload
+	return e, payload, nil
+}
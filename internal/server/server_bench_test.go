@@ -0,0 +1,165 @@
+package server
+
+import (
+	"context"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/thesimpledev/skvs/internal/client"
+	"github.com/thesimpledev/skvs/internal/encryption"
+	"github.com/thesimpledev/skvs/internal/protocol"
+)
+
+// serveGoroutinePerPacket is the design the worker pool replaced: one read
+// at a time into a fresh buffer and a goroutine per request. It is kept here
+// so the two can be compared.
+func serveGoroutinePerPacket(s *Server, conn *net.UDPConn) {
+	for {
+		buf := make([]byte, protocol.EncryptedFrameSize)
+		n, addr, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			return
+		}
+		go func() {
+			p := &packet{buf: buf, n: n}
+			if s.respond(p); len(p.out) > 0 {
+				_, _ = conn.WriteToUDP(p.out, addr)
+			}
+		}()
+	}
+}
+
+func BenchmarkServer(b *testing.B) {
+	designs := []struct {
+		name  string
+		start func(b *testing.B) string
+	}{
+		{
+			name: "goroutine-per-packet",
+			start: func(b *testing.B) string {
+				s, err := New(testConfig(), WithLogOutput(io.Discard))
+				if err != nil {
+					b.Fatalf("new server: %v", err)
+				}
+				conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+				if err != nil {
+					b.Fatalf("listen: %v", err)
+				}
+				b.Cleanup(func() { _ = conn.Close() })
+				go serveGoroutinePerPacket(s, conn)
+				return conn.LocalAddr().String()
+			},
+		},
+		{
+			name: "worker-pool",
+			start: func(b *testing.B) string {
+				s, err := New(testConfig(), WithLogOutput(io.Discard))
+				if err != nil {
+					b.Fatalf("new server: %v", err)
+				}
+				if err := s.Start(); err != nil {
+					b.Fatalf("start: %v", err)
+				}
+				b.Cleanup(func() { _ = s.Shutdown(context.Background()) })
+				return s.Addr().String()
+			},
+		},
+	}
+
+	for _, d := range designs {
+		b.Run(d.name, func(b *testing.B) {
+			p, err := client.NewPipeline(d.start(b), []byte(testKey), 0)
+			if err != nil {
+				b.Fatalf("new pipeline: %v", err)
+			}
+			defer p.Close()
+
+			// One deadline for the whole run: a context per request would
+			// count its own allocations against the pipeline.
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+			defer cancel()
+			dto := protocol.FrameDTO{Cmd: protocol.CMD_SET, Key: "cat", Value: []byte("jack"), Overwrite: true}
+			b.ReportAllocs()
+			for b.Loop() {
+				if _, err := p.Go(ctx, dto); err != nil {
+					b.Fatalf("send: %v", err)
+				}
+			}
+			if err := p.Flush(ctx); err != nil {
+				b.Fatalf("flush: %v", err)
+			}
+		})
+	}
+}
+
+// respondCases run in order against one server, so the set makes the get
+// a hit.
+var respondCases = []struct {
+	name       string
+	dto        protocol.FrameDTO
+	wantAllocs float64
+}{
+	// A set stores copies of the key and the value; they must outlive the
+	// packet, so these are the only allocations left in respond.
+	{name: "set", dto: protocol.FrameDTO{Cmd: protocol.CMD_SET, Key: "cat", Value: []byte("jack"), Overwrite: true}, wantAllocs: 2},
+	{name: "get", dto: protocol.FrameDTO{Cmd: protocol.CMD_GET, Key: "cat"}},
+	{name: "get missing", dto: protocol.FrameDTO{Cmd: protocol.CMD_GET, Key: "dog"}},
+	{name: "exists", dto: protocol.FrameDTO{Cmd: protocol.CMD_EXISTS, Key: "cat"}},
+	{name: "ping", dto: protocol.FrameDTO{Cmd: protocol.CMD_PING}},
+}
+
+// requestPacket returns a packet holding dto sealed with the test key, as a
+// reader would have left it.
+func requestPacket(tb testing.TB, dto protocol.FrameDTO) *packet {
+	tb.Helper()
+	e, err := encryption.New([]byte(testKey))
+	if err != nil {
+		tb.Fatalf("new encryptor: %v", err)
+	}
+	request, err := e.Encrypt(encryption.Request, protocol.DtoToFrame(dto))
+	if err != nil {
+		tb.Fatalf("encrypt: %v", err)
+	}
+	p := newPacket()
+	p.n = copy(p.buf, request)
+	return p
+}
+
+// BenchmarkRespond measures one request through decrypt, the store and
+// encrypt, without the network.
+func BenchmarkRespond(b *testing.B) {
+	s, err := New(testConfig(), WithLogOutput(io.Discard))
+	if err != nil {
+		b.Fatalf("new server: %v", err)
+	}
+	for _, tt := range respondCases {
+		b.Run(tt.name, func(b *testing.B) {
+			p := requestPacket(b, tt.dto)
+			b.ReportAllocs()
+			for b.Loop() {
+				s.respond(p)
+			}
+		})
+	}
+}
+
+func TestRespondAllocs(t *testing.T) {
+	s, err := New(testConfig(), WithLogOutput(io.Discard))
+	if err != nil {
+		t.Fatalf("new server: %v", err)
+	}
+	for _, tt := range respondCases {
+		t.Run(tt.name, func(t *testing.T) {
+			p := requestPacket(t, tt.dto)
+			s.respond(p)
+			if len(p.out) == 0 {
+				t.Fatal("want a response")
+			}
+			if got := testing.AllocsPerRun(100, func() { s.respond(p) }); got != tt.wantAllocs {
+				t.Errorf("want %v allocations, got %v", tt.wantAllocs, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,609 @@
+package server
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/thesimpledev/skvs/internal/client"
+	"github.com/thesimpledev/skvs/internal/config"
+	"github.com/thesimpledev/skvs/internal/encryption"
+	"github.com/thesimpledev/skvs/internal/protocol"
+	"github.com/thesimpledev/skvs/internal/skvs"
+)
+
+const testKey = "12345678901234567890123456789012"
+
+func testConfig() config.Config {
+	cfg := config.Default()
+	cfg.Addr = "127.0.0.1:0"
+	cfg.MetricsAddr = ""
+	cfg.EncryptionKey = testKey
+	cfg.ReadTimeout = config.Duration(10 * time.Millisecond)
+	return cfg
+}
+
+// startServer runs a server on a free loopback port until the test ends.
+func startServer(t *testing.T, cfg config.Config, opts ...Option) *Server {
+	t.Helper()
+	s, err := New(cfg, append([]Option{WithLogOutput(io.Discard)}, opts...)...)
+	if err != nil {
+		t.Fatalf("new server: %v", err)
+	}
+	if err := s.Start(); err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	t.Cleanup(func() { _ = s.Shutdown(context.Background()) })
+	return s
+}
+
+// holdRequests makes every worker wait for release before handling a request.
+func holdRequests(release <-chan struct{}) Option {
+	return func(s *Server) {
+		handle := s.handle
+		s.handle = func(p *packet) {
+			<-release
+			handle(p)
+		}
+	}
+}
+
+func newClient(t *testing.T, s *Server, key string) *client.Client {
+	t.Helper()
+	c, err := client.New(s.Addr().String(), []byte(key),
+		client.WithRetryPolicy(client.RetryPolicy{MaxAttempts: 3, AttemptTimeout: 200 * time.Millisecond}))
+	if err != nil {
+		t.Fatalf("new client: %v", err)
+	}
+	t.Cleanup(c.Close)
+	return c
+}
+
+func send(t *testing.T, c *client.Client, dto protocol.FrameDTO) (client.Result, error) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	return c.Send(ctx, dto)
+}
+
+func TestCommands(t *testing.T) {
+	s := startServer(t, testConfig())
+	c := newClient(t, s, testKey)
+
+	tests := []struct {
+		name    string
+		dto     protocol.FrameDTO
+		want    client.Result
+		wantErr error
+	}{
+		{
+			name: "set new key",
+			dto:  protocol.FrameDTO{Cmd: protocol.CMD_SET, Key: "cat", Value: []byte("jack")},
+			want: client.Result{Value: "jack", Found: true, Version: 1},
+		},
+		{
+			name: "set without overwrite keeps value",
+			dto:  protocol.FrameDTO{Cmd: protocol.CMD_SET, Key: "cat", Value: []byte("tom")},
+			want: client.Result{Value: "jack", Found: true, Version: 1},
+		},
+		{
+			name: "overwrite returning old",
+			dto:  protocol.FrameDTO{Cmd: protocol.CMD_SET, Key: "cat", Value: []byte("tom"), Overwrite: true, Old: true},
+			want: client.Result{Value: "jack", Found: true, Previous: "jack", Version: 2},
+		},
+		{
+			name: "get",
+			dto:  protocol.FrameDTO{Cmd: protocol.CMD_GET, Key: "cat"},
+			want: client.Result{Value: "tom", Found: true, Version: 2},
+		},
+		{
+			name: "get if version",
+			dto:  protocol.FrameDTO{Cmd: protocol.CMD_GET, Key: "cat", IfVersion: 2},
+			want: client.Result{Found: true, Version: 2, NotModified: true},
+		},
+		{
+			name: "exists",
+			dto:  protocol.FrameDTO{Cmd: protocol.CMD_EXISTS, Key: "cat"},
+			want: client.Result{Value: "1", Found: true, Version: 2},
+		},
+		{
+			name: "delete",
+			dto:  protocol.FrameDTO{Cmd: protocol.CMD_DELETE, Key: "cat"},
+			want: client.Result{Value: "tom", Found: true, Previous: "tom", Version: 2},
+		},
+		{
+			name:    "get deleted",
+			dto:     protocol.FrameDTO{Cmd: protocol.CMD_GET, Key: "cat"},
+			wantErr: client.ErrNotFound,
+		},
+		{
+			name: "ping",
+			dto:  protocol.FrameDTO{Cmd: protocol.CMD_PING},
+			want: client.Result{Value: "PONG", Found: true},
+		},
+	}
+
+	for _, tt := range tests {
+		got, err := send(t, c, tt.dto)
+		if !errors.Is(err, tt.wantErr) {
+			t.Fatalf("%s: want error %v, got %v", tt.name, tt.wantErr, err)
+		}
+		if got != tt.want {
+			t.Errorf("%s: want %+v, got %+v", tt.name, tt.want, got)
+		}
+	}
+}
+
+func TestScan(t *testing.T) {
+	s := startServer(t, testConfig())
+	c := newClient(t, s, testKey)
+
+	for _, k := range []string{"b", "a", "c"} {
+		if _, err := send(t, c, protocol.FrameDTO{Cmd: protocol.CMD_SET, Key: k, Value: []byte(k)}); err != nil {
+			t.Fatalf("set %s: %v", k, err)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	keys, err := c.Scan(ctx, "a")
+	if err != nil {
+		t.Fatalf("scan: %v", err)
+	}
+	if strings.Join(keys, ",") != "b,c" {
+		t.Errorf("want b,c, got %v", keys)
+	}
+}
+
+func TestConcurrentClients(t *testing.T) {
+	tests := []struct {
+		name    string
+		readers int
+		workers int
+	}{
+		{name: "one reader", readers: 1},
+		{name: "one worker", readers: 1, workers: 1},
+		{name: "reuseport readers", readers: 4, workers: 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig()
+			cfg.Readers = tt.readers
+			cfg.Workers = tt.workers
+			s := startServer(t, cfg)
+			if len(s.conns) != tt.readers {
+				t.Fatalf("want %d sockets, got %d", tt.readers, len(s.conns))
+			}
+
+			const clients, perClient = 8, 50
+			var wg sync.WaitGroup
+			errs := make(chan error, clients)
+			for w := range clients {
+				c := newClient(t, s, testKey)
+				wg.Go(func() {
+					for i := range perClient {
+						key := fmt.Sprintf("w%d:%d", w, i)
+						if _, err := send(t, c, protocol.FrameDTO{Cmd: protocol.CMD_SET, Key: key, Value: []byte(key)}); err != nil {
+							errs <- fmt.Errorf("set %s: %w", key, err)
+							return
+						}
+						got, err := send(t, c, protocol.FrameDTO{Cmd: protocol.CMD_GET, Key: key})
+						if err != nil || got.Value != key {
+							errs <- fmt.Errorf("get %s: got %q, %v", key, got.Value, err)
+							return
+						}
+					}
+				})
+			}
+			wg.Wait()
+			close(errs)
+			for err := range errs {
+				t.Error(err)
+			}
+
+			if n := s.App().Len(); n != clients*perClient {
+				t.Errorf("want %d keys, got %d", clients*perClient, n)
+			}
+		})
+	}
+}
+
+func TestPipeline(t *testing.T) {
+	s := startServer(t, testConfig())
+
+	p, err := client.NewPipeline(s.Addr().String(), []byte(testKey), 0)
+	if err != nil {
+		t.Fatalf("new pipeline: %v", err)
+	}
+	defer p.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	const n = 500
+	for i := range n {
+		if _, err := p.Go(ctx, protocol.FrameDTO{Cmd: protocol.CMD_SET, Key: fmt.Sprint(i), Value: []byte("v")}); err != nil {
+			t.Fatalf("go %d: %v", i, err)
+		}
+	}
+	if err := p.Flush(ctx); err != nil {
+		t.Fatalf("flush: %v", err)
+	}
+	if got := s.App().Len(); got != n {
+		t.Errorf("want %d keys, got %d", n, got)
+	}
+}
+
+func TestWrongKey(t *testing.T) {
+	s := startServer(t, testConfig())
+	c := newClient(t, s, "abcdefghijklmnopqrstuvwxyz123456")
+
+	if _, err := send(t, c, protocol.FrameDTO{Cmd: protocol.CMD_PING}); err == nil {
+		t.Fatal("want an error from a client with the wrong key")
+	}
+	if got := s.metrics.decryptFailures.Value(); got == 0 {
+		t.Error("want decrypt failures to be counted")
+	}
+}
+
+func TestReflectedResponse(t *testing.T) {
+	s := startServer(t, testConfig())
+	e, err := encryption.New([]byte(testKey))
+	if err != nil {
+		t.Fatalf("new encryptor: %v", err)
+	}
+	conn, err := net.Dial("udp", s.Addr().String())
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer conn.Close()
+
+	request, err := e.Encrypt(encryption.Request, protocol.DtoToFrame(protocol.FrameDTO{Cmd: protocol.CMD_PING, RequestID: 1}))
+	if err != nil {
+		t.Fatalf("encrypt: %v", err)
+	}
+	buf := make([]byte, protocol.EncryptedFrameSize)
+	_ = conn.SetReadDeadline(time.Now().Add(time.Second))
+	if _, err := conn.Write(request); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	n, err := conn.Read(buf)
+	if err != nil {
+		t.Fatalf("want an answer to the request, got %v", err)
+	}
+
+	// Sent back unchanged, the response is authentic but points the wrong way.
+	_ = conn.SetReadDeadline(time.Now().Add(200 * time.Millisecond))
+	if _, err := conn.Write(buf[:n]); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if _, err := conn.Read(buf); err == nil {
+		t.Error("want a reflected response to go unanswered")
+	}
+	if got := s.metrics.decryptFailures.Value(); got != 1 {
+		t.Errorf("want one decrypt failure, got %v", got)
+	}
+}
+
+func TestKeySources(t *testing.T) {
+	key := encryption.GenerateKey()
+	file := filepath.Join(t.TempDir(), "skvs.key")
+	if err := os.WriteFile(file, []byte(base64.StdEncoding.EncodeToString(key)), 0o600); err != nil {
+		t.Fatalf("write key file: %v", err)
+	}
+	params, err := encryption.NewKDFParams("scrypt")
+	if err != nil {
+		t.Fatalf("kdf params: %v", err)
+	}
+	derived, err := params.DeriveKey("hunter2")
+	if err != nil {
+		t.Fatalf("derive: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		source func(*config.Config)
+		key    []byte
+	}{
+		{name: "key file", source: func(c *config.Config) { c.KeyFile = file }, key: key},
+		{name: "passphrase", source: func(c *config.Config) { c.Passphrase, c.KDF = "hunter2", params.String() }, key: derived},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig()
+			cfg.EncryptionKey = ""
+			tt.source(&cfg)
+			s := startServer(t, cfg)
+
+			if _, err := send(t, newClient(t, s, string(tt.key)), protocol.FrameDTO{Cmd: protocol.CMD_PING}); err != nil {
+				t.Errorf("ping with the loaded key: %v", err)
+			}
+		})
+	}
+}
+
+func TestCipherSuites(t *testing.T) {
+	cfg := testConfig()
+	cfg.CipherSuites = "aes-256-gcm,xchacha20-poly1305"
+	s := startServer(t, cfg)
+
+	tests := []struct {
+		suite   encryption.Suite
+		wantErr error
+	}{
+		{suite: encryption.AES256GCM},
+		{suite: encryption.XChaCha20Poly1305},
+		{suite: encryption.ChaCha20Poly1305, wantErr: client.ErrSuiteRefused},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.suite.String(), func(t *testing.T) {
+			c, err := client.New(s.Addr().String(), []byte(testKey), client.WithCipherSuite(tt.suite),
+				client.WithRetryPolicy(client.RetryPolicy{MaxAttempts: 1, AttemptTimeout: 100 * time.Millisecond}))
+			if err != nil {
+				t.Fatalf("new client: %v", err)
+			}
+			defer c.Close()
+
+			_, err = send(t, c, protocol.FrameDTO{Cmd: protocol.CMD_PING})
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("want %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestLimitsAndReload(t *testing.T) {
+	cfg := testConfig()
+	cfg.MaxKeys = 1
+	s := startServer(t, cfg)
+	c := newClient(t, s, testKey)
+
+	set := func(key string) error {
+		_, err := send(t, c, protocol.FrameDTO{Cmd: protocol.CMD_SET, Key: key, Value: []byte("v")})
+		return err
+	}
+	if err := set("a"); err != nil {
+		t.Fatalf("first set: %v", err)
+	}
+	var serverErr *client.ServerError
+	if err := set("b"); !errors.As(err, &serverErr) || serverErr.Status != protocol.STATUS_OUT_OF_MEMORY {
+		t.Fatalf("want out of memory, got %v", err)
+	}
+
+	bad := cfg
+	bad.MaxKeys = -1
+	if err := s.Reload(bad); err == nil {
+		t.Error("want invalid reload to be rejected")
+	}
+
+	cfg.MaxKeys = 2
+	if err := s.Reload(cfg); err != nil {
+		t.Fatalf("reload: %v", err)
+	}
+	if err := set("b"); err != nil {
+		t.Errorf("set after raising the limit: %v", err)
+	}
+}
+
+func TestMetricsHandler(t *testing.T) {
+	s := startServer(t, testConfig())
+	c := newClient(t, s, testKey)
+	if _, err := send(t, c, protocol.FrameDTO{Cmd: protocol.CMD_PING}); err != nil {
+		t.Fatalf("ping: %v", err)
+	}
+
+	rec := httptest.NewRecorder()
+	s.MetricsHandler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	want := `skvs_requests_total{command="ping",status="ok"} 1`
+	if !strings.Contains(rec.Body.String(), want) {
+		t.Errorf("want %q in metrics, got:\n%s", want, rec.Body.String())
+	}
+}
+
+func TestSnapshotAcrossRestart(t *testing.T) {
+	cfg := testConfig()
+	cfg.SnapshotPath = filepath.Join(t.TempDir(), "skvs.snap")
+	cfg.SnapshotInterval = config.Duration(time.Hour)
+
+	first := startServer(t, cfg)
+	c := newClient(t, first, testKey)
+	if _, err := send(t, c, protocol.FrameDTO{Cmd: protocol.CMD_SET, Key: "cat", Value: []byte("jack")}); err != nil {
+		t.Fatalf("set: %v", err)
+	}
+	if err := first.Shutdown(context.Background()); err != nil {
+		t.Fatalf("shutdown: %v", err)
+	}
+
+	second := startServer(t, cfg)
+	got, err := send(t, newClient(t, second, testKey), protocol.FrameDTO{Cmd: protocol.CMD_GET, Key: "cat"})
+	if err != nil {
+		t.Fatalf("get after restart: %v", err)
+	}
+	if got.Value != "jack" || got.Version != 1 {
+		t.Errorf("want jack at version 1, got %+v", got)
+	}
+}
+
+func TestSnapshotAfterDelete(t *testing.T) {
+	cfg := testConfig()
+	cfg.SnapshotPath = filepath.Join(t.TempDir(), "skvs.snap")
+	cfg.SnapshotInterval = config.Duration(10 * time.Millisecond)
+	s := startServer(t, cfg)
+	c := newClient(t, s, testKey)
+
+	waitForSnapshots := func(n uint64) {
+		t.Helper()
+		deadline := time.Now().Add(2 * time.Second)
+		for s.metrics.snapshots.Value() < n {
+			if time.Now().After(deadline) {
+				t.Fatalf("want %d snapshots, got %d", n, s.metrics.snapshots.Value())
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+	}
+
+	if _, err := send(t, c, protocol.FrameDTO{Cmd: protocol.CMD_SET, Key: "cat", Value: []byte("jack")}); err != nil {
+		t.Fatalf("set: %v", err)
+	}
+	waitForSnapshots(1)
+	if _, err := send(t, c, protocol.FrameDTO{Cmd: protocol.CMD_DELETE, Key: "cat"}); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	waitForSnapshots(2)
+
+	restored := skvs.New(slog.New(slog.NewTextHandler(io.Discard, nil)))
+	if err := restored.LoadSnapshot(cfg.SnapshotPath); err != nil {
+		t.Fatalf("load snapshot: %v", err)
+	}
+	if restored.Len() != 0 {
+		t.Errorf("want the delete saved, got %d keys", restored.Len())
+	}
+}
+
+func TestShutdown(t *testing.T) {
+	t.Run("listen and serve stops on cancel", func(t *testing.T) {
+		s, err := New(testConfig(), WithLogOutput(io.Discard))
+		if err != nil {
+			t.Fatalf("new: %v", err)
+		}
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan error, 1)
+		go func() { done <- s.ListenAndServe(ctx) }()
+
+		cancel()
+		select {
+		case err := <-done:
+			if err != nil {
+				t.Errorf("want nil after cancel, got %v", err)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatal("ListenAndServe did not return")
+		}
+		if err := s.Start(); err == nil {
+			t.Error("want an error starting a shut down server")
+		}
+	})
+
+	t.Run("abandons handlers at the deadline", func(t *testing.T) {
+		release := make(chan struct{})
+		defer close(release)
+		s := startServer(t, testConfig(), holdRequests(release))
+		c := newClient(t, s, testKey)
+		go func() { _, _ = send(t, c, protocol.FrameDTO{Cmd: protocol.CMD_PING}) }()
+		for s.inFlight.Load() == 0 {
+			time.Sleep(time.Millisecond)
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		err := s.Shutdown(ctx)
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("want deadline exceeded, got %v", err)
+		}
+		if again := s.Shutdown(context.Background()); again != err {
+			t.Errorf("second shutdown: want %v, got %v", err, again)
+		}
+	})
+}
+
+func TestRateLimitAndQuotas(t *testing.T) {
+	cfg := testConfig()
+	cfg.RateLimit = 0.001
+	cfg.RateBurst = 3
+	cfg.TenantMaxKeys = 1
+	s := startServer(t, cfg)
+	c := newClient(t, s, testKey)
+
+	// Datagrams that fail to decrypt, as from a spoofed source, neither
+	// create a bucket nor spend the client's.
+	conn, err := net.Dial("udp", s.Addr().String())
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer conn.Close()
+	forged := forgedRequest(encryption.ProtocolVersion, encryption.Request, encryption.AES256GCM.MessageSize())
+	binary.LittleEndian.PutUint32(forged[3:], encryption.KeyID([]byte(testKey)))
+	for range 2 * cfg.RateBurst {
+		if _, err := conn.Write(forged); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+	}
+	for deadline := time.Now().Add(time.Second); s.metrics.decryptFailures.Value() < uint64(2*cfg.RateBurst); {
+		if time.Now().After(deadline) {
+			t.Fatalf("want %d decrypt failures, got %d", 2*cfg.RateBurst, s.metrics.decryptFailures.Value())
+		}
+		time.Sleep(time.Millisecond)
+	}
+	s.limiter.mu.Lock()
+	buckets := len(s.limiter.buckets)
+	s.limiter.mu.Unlock()
+	if buckets != 0 {
+		t.Errorf("want no buckets for undecryptable datagrams, got %d", buckets)
+	}
+
+	set := func(key string) error {
+		_, err := send(t, c, protocol.FrameDTO{Cmd: protocol.CMD_SET, Key: key, Value: []byte("v")})
+		return err
+	}
+	if err := set("acme:a"); err != nil {
+		t.Fatalf("first set: %v", err)
+	}
+	if err := set("acme:b"); !errors.Is(err, client.ErrOutOfMemory) || !strings.Contains(err.Error(), `tenant "acme"`) {
+		t.Errorf("over quota: want out of memory for tenant acme, got %v", err)
+	}
+	if err := set("beta:a"); err != nil {
+		t.Errorf("other tenant: %v", err)
+	}
+	if err := set("beta:b"); !errors.Is(err, client.ErrRateLimited) {
+		t.Errorf("over rate: want rate limited, got %v", err)
+	}
+	if s.App().Len() != 2 {
+		t.Errorf("want the rate limited set not applied, got %d keys", s.App().Len())
+	}
+}
+
+func TestBusy(t *testing.T) {
+	cfg := testConfig()
+	cfg.MaxConcurrency = 1
+	cfg.BusyRetryAfter = config.Duration(20 * time.Millisecond)
+	s := startServer(t, cfg)
+	s.inFlight.Add(1) // every handler slot taken
+
+	once, err := client.New(s.Addr().String(), []byte(testKey), client.WithRetryPolicy(client.RetryPolicy{MaxAttempts: 1}))
+	if err != nil {
+		t.Fatalf("new client: %v", err)
+	}
+	defer once.Close()
+	_, err = send(t, once, protocol.FrameDTO{Cmd: protocol.CMD_PING})
+	var serverErr *client.ServerError
+	if !errors.As(err, &serverErr) || !errors.Is(err, client.ErrBusy) || serverErr.RetryAfter != 20*time.Millisecond {
+		t.Fatalf("want busy with a 20ms hint, got %v", err)
+	}
+
+	time.AfterFunc(50*time.Millisecond, func() { s.inFlight.Add(-1) })
+	c, err := client.New(s.Addr().String(), []byte(testKey), client.WithRetryPolicy(client.RetryPolicy{MaxAttempts: 10}))
+	if err != nil {
+		t.Fatalf("new client: %v", err)
+	}
+	defer c.Close()
+	if _, err := send(t, c, protocol.FrameDTO{Cmd: protocol.CMD_SET, Key: "cat", Value: []byte("jack"), Old: true}); err != nil {
+		t.Errorf("want the set to go through once a slot frees, got %v", err)
+	}
+	if got := s.metrics.dropped.Value(); got < 2 {
+		t.Errorf("want busy answers counted, got %d", got)
+	}
+}
@@ -0,0 +1,213 @@
+package server
+
+import (
+	"errors"
+	"math/rand/v2"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/thesimpledev/skvs/internal/encryption"
+	"github.com/thesimpledev/skvs/internal/protocol"
+)
+
+// maxSessions bounds the session table. Opening a session takes a
+// handshake sealed with the pre-shared key, but a broken client could open
+// one per request, and a captured handshake can be replayed by anyone.
+const maxSessions = 1 << 16
+
+// SESSION_EXPIRED and SUITE_REFUSED answers are sent without authenticating
+// the request, so they are limited per source IP on their own, whatever
+// rate_limit says. Handshakes cost an X25519 exchange and may be replays, so
+// they are too.
+const (
+	unopenedRate   = 10
+	unopenedBurst  = 64
+	handshakeRate  = 10
+	handshakeBurst = 100
+)
+
+var (
+	errSessionExpired  = errors.New("unknown or expired session")
+	errTooManySessions = errors.New("too many sessions")
+)
+
+type session struct {
+	encryptor encryption.Encryptor
+	expires   time.Time
+}
+
+// answered is the reply to a handshake, kept for as long as the session it
+// opened so that a replay of the handshake gets the same reply.
+type answered struct {
+	value   []byte
+	expires time.Time
+}
+
+// sessionTable maps session IDs, which requests carry in place of the key
+// ID, to their encryptors, and the client public key of every handshake to
+// its reply. Expired entries are swept when a session is added, at most once
+// a minute unless the table is full.
+type sessionTable struct {
+	mu         sync.RWMutex
+	byID       map[uint32]session
+	handshakes map[[protocol.PublicKeySize]byte]answered
+	nextSweep  time.Time
+}
+
+func newSessionTable() *sessionTable {
+	return &sessionTable{
+		byID:       make(map[uint32]session),
+		handshakes: make(map[[protocol.PublicKeySize]byte]answered),
+	}
+}
+
+func (t *sessionTable) get(id uint32, now time.Time) (encryption.Encryptor, error) {
+	t.mu.RLock()
+	s, ok := t.byID[id]
+	t.mu.RUnlock()
+	if !ok || now.After(s.expires) {
+		return nil, errSessionExpired
+	}
+	return s.encryptor, nil
+}
+
+// answer returns the reply already given to a handshake from clientPublic.
+func (t *sessionTable) answer(clientPublic []byte, now time.Time) ([]byte, bool) {
+	t.mu.RLock()
+	a, ok := t.handshakes[[protocol.PublicKeySize]byte(clientPublic)]
+	t.mu.RUnlock()
+	if !ok || now.After(a.expires) {
+		return nil, false
+	}
+	return a.value, true
+}
+
+// add registers e under its key ID until expires, as opened by a handshake
+// from clientPublic that was answered with value. It reports false if the ID
+// is already taken.
+func (t *sessionTable) add(e encryption.Encryptor, clientPublic, value []byte, expires, now time.Time) (bool, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if now.After(t.nextSweep) || len(t.byID) >= maxSessions {
+		for id, s := range t.byID {
+			if now.After(s.expires) {
+				delete(t.byID, id)
+			}
+		}
+		for key, a := range t.handshakes {
+			if now.After(a.expires) {
+				delete(t.handshakes, key)
+			}
+		}
+		t.nextSweep = now.Add(time.Minute)
+	}
+	if len(t.byID) >= maxSessions {
+		return false, errTooManySessions
+	}
+	if _, taken := t.byID[e.KeyID()]; taken {
+		return false, nil
+	}
+	t.byID[e.KeyID()] = session{encryptor: e, expires: expires}
+	t.handshakes[[protocol.PublicKeySize]byte(clientPublic)] = answered{value: value, expires: expires}
+	return true, nil
+}
+
+func (t *sessionTable) len() int {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return len(t.byID)
+}
+
+// handshake answers a CMD_HANDSHAKE opened with e from addr. It completes
+// the client's X25519 exchange with a fresh key pair and registers a session
+// under a random ID for the suite the client used. A handshake from a client
+// key seen within the session lifetime is a retry or a replay: it gets the
+// first reply again and opens nothing, which is of no use without the
+// client's private key.
+func (s *Server) handshake(e encryption.Encryptor, request protocol.FrameDTO, addr net.Addr) protocol.ResponseDTO {
+	if e.KeyID() != s.keyID {
+		return protocol.NewResponseDTO(protocol.STATUS_AUTH_FAILURE, []byte("handshake must be sealed with the pre-shared key"))
+	}
+	if !s.handshakeLimiter.allow(sourceIP(addr)) {
+		return protocol.NewResponseDTO(protocol.STATUS_RATE_LIMITED, []byte("too many handshakes"))
+	}
+	clientPublic, err := protocol.UnpackPublicKey(request.Value)
+	if err != nil {
+		return protocol.NewResponseDTO(protocol.STATUS_INVALID_REQUEST, []byte(err.Error()))
+	}
+	now := time.Now()
+	if value, ok := s.sessions.answer(clientPublic, now); ok {
+		return protocol.NewResponseDTO(protocol.STATUS_OK, value)
+	}
+	h, err := encryption.NewHandshake()
+	if err != nil {
+		s.log.Error("handshake failed", "err", err)
+		return protocol.NewResponseDTO(protocol.STATUS_ERROR, []byte("handshake failed"))
+	}
+
+	ttl := time.Duration(s.sessionTTL.Load())
+	for {
+		id := rand.Uint32()
+		if id == s.keyID {
+			continue
+		}
+		key, err := h.SessionKey(s.psk, clientPublic, h.PublicKey(), id)
+		if err != nil {
+			return protocol.NewResponseDTO(protocol.STATUS_INVALID_REQUEST, []byte(err.Error()))
+		}
+		session, err := encryption.NewSession(e.Suite(), key, id)
+		if err != nil {
+			s.log.Error("handshake failed", "err", err)
+			return protocol.NewResponseDTO(protocol.STATUS_ERROR, []byte("handshake failed"))
+		}
+		value := protocol.PackSession(h.PublicKey(), id, ttl)
+		added, err := s.sessions.add(session, clientPublic, value, now.Add(ttl), now)
+		if err != nil {
+			return protocol.NewResponseDTO(protocol.STATUS_ERROR, []byte(err.Error()))
+		}
+		if added {
+			s.log.Debug("session started", "session", id, "suite", e.Suite(), "ttl", ttl)
+			return protocol.NewResponseDTO(protocol.STATUS_OK, value)
+		}
+	}
+}
+
+// unopened answers a request the server cannot open with status: one sealed
+// under a session it does not have, so the client knows to handshake again,
+// or under a suite it does not accept, so the client knows to pick another,
+// rather than wait out its timeout. The answer is sealed with the pre-shared
+// key under the suite the request named, or AES-256-GCM if that is not
+// accepted; the request ID comes from its header, as the request itself
+// cannot be opened.
+//
+// Anyone can forge such a request, so the server only answers one the size
+// of a real request, which the answer is never larger than, and at most
+// unopenedRate a second per source. Anything else is dropped.
+func (s *Server) unopened(p *packet, status byte, reason []byte) {
+	message := p.buf[:p.n]
+	h, err := encryption.ParseHeader(message)
+	if err != nil || h.Version != encryption.ProtocolVersion || h.Direction != encryption.Request || len(message) != h.Suite.MessageSize() {
+		return
+	}
+	if !s.unopenedLimiter.allow(sourceIP(p.addr)) {
+		return
+	}
+	e, ok := s.keyring.Suite(h.Suite)
+	if !ok {
+		if e, ok = s.keyring.Suite(encryption.AES256GCM); !ok {
+			return
+		}
+	}
+
+	response := protocol.NewResponseDTO(status, reason)
+	response.RequestID = h.RequestID
+	p.frame = protocol.AppendResponseFrame(p.frame[:0], response)
+	encryptedResponse, err := e.EncryptTo(p.out[:0], encryption.Response, p.frame)
+	if err != nil {
+		s.log.Error("Encryption failed", "Err", err)
+		return
+	}
+	p.out = encryptedResponse
+	s.metrics.requests.WithLabelValues("unknown", protocol.StatusName(status)).Inc()
+}
@@ -0,0 +1,393 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/thesimpledev/skvs/internal/client"
+	"github.com/thesimpledev/skvs/internal/config"
+	"github.com/thesimpledev/skvs/internal/encryption"
+	"github.com/thesimpledev/skvs/internal/protocol"
+)
+
+func newSessionClient(t *testing.T, s *Server, opts ...client.Option) *client.Client {
+	t.Helper()
+	opts = append([]client.Option{client.WithSessions(),
+		client.WithRetryPolicy(client.RetryPolicy{MaxAttempts: 3, AttemptTimeout: 200 * time.Millisecond})}, opts...)
+	c, err := client.New(s.Addr().String(), []byte(testKey), opts...)
+	if err != nil {
+		t.Fatalf("new client: %v", err)
+	}
+	t.Cleanup(c.Close)
+	return c
+}
+
+// forgetSessions drops every session, as a restart would.
+func forgetSessions(s *Server) {
+	s.sessions.mu.Lock()
+	defer s.sessions.mu.Unlock()
+	clear(s.sessions.byID)
+	clear(s.sessions.handshakes)
+}
+
+func TestSessions(t *testing.T) {
+	cfg := testConfig()
+	cfg.RequireSession = true
+	s := startServer(t, cfg)
+
+	tests := []struct {
+		name    string
+		client  *client.Client
+		wantErr error
+	}{
+		{name: "pre-shared key refused", client: newClient(t, s, testKey), wantErr: client.ErrAuthFailure},
+		{name: "aes-256-gcm session", client: newSessionClient(t, s)},
+		{name: "xchacha20-poly1305 session", client: newSessionClient(t, s, client.WithCipherSuite(encryption.XChaCha20Poly1305))},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := send(t, tt.client, protocol.FrameDTO{Cmd: protocol.CMD_SET, Key: tt.name, Value: []byte("v"), Overwrite: true})
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("set: want %v, got %v", tt.wantErr, err)
+			}
+			if tt.wantErr != nil {
+				return
+			}
+			if got, err := send(t, tt.client, protocol.FrameDTO{Cmd: protocol.CMD_GET, Key: tt.name}); err != nil || got.Value != "v" {
+				t.Errorf("get: want v, got %q, %v", got.Value, err)
+			}
+		})
+	}
+
+	if got := s.sessions.len(); got != 2 {
+		t.Errorf("want one session per session client, got %d", got)
+	}
+}
+
+func TestSessionRekey(t *testing.T) {
+	cfg := testConfig()
+	cfg.SessionTTL = config.Duration(2 * time.Second)
+	s := startServer(t, cfg)
+	c := newSessionClient(t, s)
+
+	if _, err := send(t, c, protocol.FrameDTO{Cmd: protocol.CMD_PING}); err != nil {
+		t.Fatalf("ping: %v", err)
+	}
+	time.Sleep(time.Second + 100*time.Millisecond)
+	if _, err := send(t, c, protocol.FrameDTO{Cmd: protocol.CMD_PING}); err != nil {
+		t.Fatalf("ping after half the lifetime: %v", err)
+	}
+	if got := s.sessions.len(); got != 2 {
+		t.Errorf("want a second session after rekeying, got %d", got)
+	}
+}
+
+func TestSessionLost(t *testing.T) {
+	cfg := testConfig()
+	cfg.RequireSession = true
+	s := startServer(t, cfg)
+	c := newSessionClient(t, s)
+
+	if _, err := send(t, c, protocol.FrameDTO{Cmd: protocol.CMD_PING}); err != nil {
+		t.Fatalf("ping: %v", err)
+	}
+	forgetSessions(s)
+	if _, err := send(t, c, protocol.FrameDTO{Cmd: protocol.CMD_SET, Key: "cat", Value: []byte("jack")}); err != nil {
+		t.Fatalf("set after the server lost the session: %v", err)
+	}
+	if got := s.metrics.requests.WithLabelValues("unknown", "session_expired").Value(); got != 1 {
+		t.Errorf("want one session_expired answer, got %v", got)
+	}
+	if got := s.sessions.len(); got != 1 {
+		t.Errorf("want a new session, got %d", got)
+	}
+}
+
+func TestPipelineSessions(t *testing.T) {
+	cfg := testConfig()
+	cfg.RequireSession = true
+	s := startServer(t, cfg)
+
+	p, err := client.NewPipeline(s.Addr().String(), []byte(testKey), 16, client.WithSessions())
+	if err != nil {
+		t.Fatalf("new pipeline: %v", err)
+	}
+	defer p.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	const n = 200
+	for i := range n {
+		if i == n/2 {
+			forgetSessions(s)
+		}
+		if _, err := p.Go(ctx, protocol.FrameDTO{Cmd: protocol.CMD_SET, Key: fmt.Sprint(i), Value: []byte("v")}); err != nil {
+			t.Fatalf("go %d: %v", i, err)
+		}
+	}
+	if err := p.Flush(ctx); err != nil {
+		t.Fatalf("flush: %v", err)
+	}
+	if got := s.App().Len(); got != n {
+		t.Errorf("want %d keys, got %d", n, got)
+	}
+	if got := s.metrics.requests.WithLabelValues("unknown", "session_expired").Value(); got == 0 {
+		t.Error("want requests sealed under the lost session to be answered session_expired")
+	}
+	if got := s.sessions.len(); got != 1 {
+		t.Errorf("want one new session, got %d", got)
+	}
+}
+
+// forgedRequest is a datagram that names session 0xdeadbeef without knowing
+// any key: a header padded with zeros to size bytes.
+func forgedRequest(version byte, dir encryption.Direction, size int) []byte {
+	message := make([]byte, max(size, encryption.HeaderSize))
+	message[0] = byte(encryption.AES256GCM)
+	message[1] = version
+	message[2] = byte(dir)
+	binary.LittleEndian.PutUint32(message[3:], 0xdeadbeef)
+	binary.LittleEndian.PutUint32(message[7:], 42)
+	return message[:size]
+}
+
+func TestSessionExpiredForgeries(t *testing.T) {
+	s := startServer(t, testConfig())
+	e, err := encryption.New([]byte(testKey))
+	if err != nil {
+		t.Fatalf("new encryptor: %v", err)
+	}
+	conn, err := net.Dial("udp", s.Addr().String())
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer conn.Close()
+	size := encryption.AES256GCM.MessageSize()
+
+	tests := []struct {
+		name      string
+		message   []byte
+		wantReply bool
+	}{
+		{name: "short forged header", message: forgedRequest(encryption.ProtocolVersion, encryption.Request, encryption.HeaderSize)},
+		{name: "one byte short", message: forgedRequest(encryption.ProtocolVersion, encryption.Request, size-1)},
+		{name: "response direction", message: forgedRequest(encryption.ProtocolVersion, encryption.Response, size)},
+		{name: "unknown version", message: forgedRequest(encryption.ProtocolVersion+1, encryption.Request, size)},
+		{name: "full-size request", message: forgedRequest(encryption.ProtocolVersion, encryption.Request, size), wantReply: true},
+	}
+
+	buf := make([]byte, protocol.EncryptedFrameSize)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_ = conn.SetReadDeadline(time.Now().Add(200 * time.Millisecond))
+			if _, err := conn.Write(tt.message); err != nil {
+				t.Fatalf("write: %v", err)
+			}
+			n, err := conn.Read(buf)
+			if !tt.wantReply {
+				if err == nil {
+					t.Errorf("want no reply, got %d bytes", n)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("want a reply, got %v", err)
+			}
+			if n > len(tt.message) {
+				t.Errorf("want a reply no larger than the request, got %d bytes for %d", n, len(tt.message))
+			}
+			plain, err := e.Decrypt(encryption.Response, buf[:n])
+			if err != nil {
+				t.Fatalf("decrypt: %v", err)
+			}
+			response, err := protocol.FrameToResponseDTO(plain)
+			if err != nil || response.Status != protocol.STATUS_SESSION_EXPIRED || response.RequestID != 42 {
+				t.Errorf("want session_expired for request 42, got %+v, %v", response, err)
+			}
+		})
+	}
+
+	// Past the burst, forged requests from one source go unanswered.
+	flood := forgedRequest(encryption.ProtocolVersion, encryption.Request, size)
+	for range 2 * unopenedBurst {
+		if _, err := conn.Write(flood); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+	}
+	replies := 0
+	for {
+		_ = conn.SetReadDeadline(time.Now().Add(200 * time.Millisecond))
+		if _, err := conn.Read(buf); err != nil {
+			break
+		}
+		replies++
+	}
+	if replies >= 2*unopenedBurst-unopenedRate {
+		t.Errorf("want replies limited to about %d, got %d", unopenedBurst, replies)
+	}
+}
+
+func TestHandshakeReplay(t *testing.T) {
+	s := startServer(t, testConfig())
+	e, err := encryption.New([]byte(testKey))
+	if err != nil {
+		t.Fatalf("new encryptor: %v", err)
+	}
+	conn, err := net.Dial("udp", s.Addr().String())
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer conn.Close()
+
+	buf := make([]byte, protocol.EncryptedFrameSize)
+	handshake := func(message []byte) protocol.ResponseDTO {
+		t.Helper()
+		_ = conn.SetReadDeadline(time.Now().Add(time.Second))
+		if _, err := conn.Write(message); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+		n, err := conn.Read(buf)
+		if err != nil {
+			t.Fatalf("read: %v", err)
+		}
+		plain, err := e.Decrypt(encryption.Response, buf[:n])
+		if err != nil {
+			t.Fatalf("decrypt: %v", err)
+		}
+		response, err := protocol.FrameToResponseDTO(plain)
+		if err != nil {
+			t.Fatalf("parse: %v", err)
+		}
+		return response
+	}
+	newHandshake := func() []byte {
+		t.Helper()
+		h, err := encryption.NewHandshake()
+		if err != nil {
+			t.Fatalf("new handshake: %v", err)
+		}
+		message, err := e.Encrypt(encryption.Request, protocol.DtoToFrame(protocol.FrameDTO{Cmd: protocol.CMD_HANDSHAKE, Value: h.PublicKey()}))
+		if err != nil {
+			t.Fatalf("encrypt: %v", err)
+		}
+		return message
+	}
+
+	// A captured handshake replayed any number of times opens one session.
+	captured := newHandshake()
+	first := handshake(captured)
+	if first.Status != protocol.STATUS_OK {
+		t.Fatalf("want ok, got %+v", first)
+	}
+	replays := handshakeBurst / 2
+	for range replays {
+		if got := handshake(captured); got.Status != protocol.STATUS_OK || !bytes.Equal(got.Value, first.Value) {
+			t.Fatalf("want the first answer again, got %+v", got)
+		}
+	}
+	if got := s.sessions.len(); got != 1 {
+		t.Errorf("want 1 session after %d replays, got %d", replays, got)
+	}
+
+	// Past the burst, handshakes from one source are refused.
+	limited := 0
+	for range handshakeBurst {
+		if handshake(newHandshake()).Status == protocol.STATUS_RATE_LIMITED {
+			limited++
+		}
+	}
+	if limited == 0 {
+		t.Error("want handshakes past the burst refused, got none")
+	}
+	if got := s.sessions.len(); got > handshakeBurst {
+		t.Errorf("want at most %d sessions, got %d", handshakeBurst, got)
+	}
+}
+
+// expireAfterRunning makes the server run the first n requests sealed under
+// a session and then answer each of them SESSION_EXPIRED, as a forged answer
+// racing the real one would.
+func expireAfterRunning(n int) Option {
+	return func(s *Server) {
+		handle := s.handle
+		var expired atomic.Int64
+		s.handle = func(p *packet) {
+			handle(p)
+			h, err := encryption.ParseHeader(p.buf[:p.n])
+			if err != nil || h.KeyID == s.keyID || expired.Add(1) > int64(n) {
+				return
+			}
+			s.unopened(p, protocol.STATUS_SESSION_EXPIRED, []byte(errSessionExpired.Error()))
+		}
+	}
+}
+
+func TestSessionExpiredAfterRunning(t *testing.T) {
+	tests := []struct {
+		name        string
+		dto         protocol.FrameDTO
+		policy      client.RetryPolicy
+		wantErr     error
+		wantApplied uint64
+	}{
+		{
+			name:        "set old is not resent",
+			dto:         protocol.FrameDTO{Cmd: protocol.CMD_SET, Key: "cat", Value: []byte("jack"), Overwrite: true, Old: true},
+			policy:      client.RetryPolicy{MaxAttempts: 3, AttemptTimeout: 200 * time.Millisecond},
+			wantErr:     client.ErrSessionExpired,
+			wantApplied: 1,
+		},
+		{
+			name:        "set old is resent when allowed",
+			dto:         protocol.FrameDTO{Cmd: protocol.CMD_SET, Key: "cat", Value: []byte("jack"), Overwrite: true, Old: true},
+			policy:      client.RetryPolicy{MaxAttempts: 3, AttemptTimeout: 200 * time.Millisecond, RetryNonIdempotent: true},
+			wantApplied: 2,
+		},
+		{
+			name:        "idempotent set is resent",
+			dto:         protocol.FrameDTO{Cmd: protocol.CMD_SET, Key: "cat", Value: []byte("jack"), Overwrite: true},
+			policy:      client.RetryPolicy{MaxAttempts: 3, AttemptTimeout: 200 * time.Millisecond},
+			wantApplied: 2,
+		},
+	}
+
+	for _, tt := range tests {
+		for _, pipelined := range []bool{false, true} {
+			t.Run(fmt.Sprintf("%s/pipelined=%v", tt.name, pipelined), func(t *testing.T) {
+				s := startServer(t, testConfig(), expireAfterRunning(1))
+				ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+				defer cancel()
+
+				var err error
+				if pipelined {
+					p, perr := client.NewPipeline(s.Addr().String(), []byte(testKey), 4, client.WithSessions(), client.WithRetryPolicy(tt.policy))
+					if perr != nil {
+						t.Fatalf("new pipeline: %v", perr)
+					}
+					defer p.Close()
+					var f *client.Future
+					if f, err = p.Go(ctx, tt.dto); err == nil {
+						_, err = f.Wait(ctx)
+					}
+				} else {
+					_, err = send(t, newSessionClient(t, s, client.WithRetryPolicy(tt.policy)), tt.dto)
+				}
+
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("want %v, got %v", tt.wantErr, err)
+				}
+				if got := s.App().Version(); got != tt.wantApplied {
+					t.Errorf("want the set applied %d times, got %d", tt.wantApplied, got)
+				}
+			})
+		}
+	}
+}
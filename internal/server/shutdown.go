@@ -0,0 +1,67 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Shutdown stops reading, waits for queued and in-flight requests until ctx
+// is done, writes a final snapshot and closes the sockets. Requests still running when
+// ctx ends are abandoned and their clients will retry. Calling Shutdown more
+// than once returns the result of the first call.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.shutdownOnce.Do(func() {
+		// A server that was never started cannot be started afterwards.
+		s.startOnce.Do(func() {})
+		close(s.quit)
+		if len(s.conns) == 0 {
+			return
+		}
+		s.shutdownErr = s.shutdown(ctx)
+	})
+	return s.shutdownErr
+}
+
+func (s *Server) shutdown(ctx context.Context) error {
+	s.readers.Wait()
+	close(s.queue)
+
+	start := time.Now()
+	s.log.Info("shutting down", "in_flight", s.inFlight.Load())
+
+	var err error
+	abandoned := 0
+	select {
+	case <-s.workersDone:
+	case <-ctx.Done():
+		abandoned = int(s.inFlight.Load())
+		err = fmt.Errorf("abandoned %d in-flight requests: %w", abandoned, ctx.Err())
+		s.log.Warn("shutdown deadline reached, abandoning requests", "in_flight", abandoned)
+	}
+
+	snapshot := "disabled"
+	if s.cfg.SnapshotPath != "" {
+		snapshot = "saved"
+		if snapErr := s.saveSnapshot(); snapErr != nil {
+			snapshot = "failed"
+			if err == nil {
+				err = snapErr
+			}
+		}
+	}
+
+	for _, conn := range s.conns {
+		_ = conn.Close()
+	}
+
+	s.log.Info("shutdown complete",
+		"uptime", time.Since(s.started).Round(time.Second),
+		"served", s.served.Load(),
+		"dropped", s.metrics.dropped.Value(),
+		"abandoned", abandoned,
+		"keys", s.app.Len(),
+		"snapshot", snapshot,
+		"drain", time.Since(start))
+	return err
+}
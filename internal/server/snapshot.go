@@ -0,0 +1,58 @@
+package server
+
+import (
+	"errors"
+	"os"
+	"time"
+)
+
+func (s *Server) restoreSnapshot() error {
+	path := s.cfg.SnapshotPath
+	if path == "" {
+		return nil
+	}
+
+	start := time.Now()
+	err := s.app.LoadSnapshot(path)
+	if errors.Is(err, os.ErrNotExist) {
+		s.log.Info("no snapshot found, starting empty", "path", path)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	s.log.Info("restored snapshot", "path", path, "keys", s.app.Len(), "duration", time.Since(start))
+	return nil
+}
+
+// snapshotLoop saves the store whenever it changed since the last save. The
+// interval is re-read after every tick so reloads apply to the next one.
+func (s *Server) snapshotLoop() {
+	saved := s.app.Version()
+	for {
+		select {
+		case <-s.quit:
+			return
+		case <-time.After(time.Duration(s.snapshotInterval.Load())):
+		}
+
+		if v := s.app.Version(); v != saved {
+			if err := s.saveSnapshot(); err != nil {
+				continue
+			}
+			saved = v
+		}
+	}
+}
+
+func (s *Server) saveSnapshot() error {
+	start := time.Now()
+	if err := s.app.SaveSnapshot(s.cfg.SnapshotPath); err != nil {
+		s.metrics.snapshotFailures.Inc()
+		s.log.Error("snapshot failed", "path", s.cfg.SnapshotPath, "err", err)
+		return err
+	}
+	s.metrics.snapshots.Inc()
+	s.log.Debug("snapshot saved", "path", s.cfg.SnapshotPath, "keys", s.app.Len(), "duration", time.Since(start))
+	return nil
+}
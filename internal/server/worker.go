@@ -0,0 +1,212 @@
+package server
+
+import (
+	"errors"
+	"net"
+	"net/netip"
+	"sync"
+	"time"
+
+	"golang.org/x/net/ipv4"
+
+	"github.com/thesimpledev/skvs/internal/protocol"
+)
+
+// batchSize is how many datagrams a reader takes per recvmmsg and a worker
+// answers per sendmmsg.
+const batchSize = 32
+
+// packet carries one request from a reader to a worker and its response
+// back out. Packets are allocated once in New and recycled, so the hot path
+// does not allocate a buffer per datagram. buf holds the datagram as read,
+// plain the decrypted request, frame the response and out the encrypted
+// response to send.
+type packet struct {
+	conn  *ipv4.PacketConn
+	addr  net.Addr
+	buf   []byte
+	n     int
+	plain []byte
+	frame []byte
+	out   []byte
+}
+
+func newPacket() *packet {
+	return &packet{
+		buf:   make([]byte, protocol.EncryptedFrameSize),
+		plain: make([]byte, 0, protocol.FrameSize),
+		frame: make([]byte, 0, protocol.FrameSize),
+		out:   make([]byte, 0, protocol.EncryptedFrameSize),
+	}
+}
+
+// newPackets allocates the packet pool: one batch per reader plus
+// max_concurrency, which is as many as can be queued or in a worker at once,
+// so a reader never waits for a free packet.
+func (s *Server) newPackets() {
+	s.queue = make(chan *packet, s.cfg.MaxConcurrency)
+	s.free = make(chan *packet, s.cfg.MaxConcurrency+s.cfg.Readers*batchSize)
+	for range cap(s.free) {
+		s.free <- newPacket()
+	}
+}
+
+// serve starts one reader per socket and the worker pool.
+func (s *Server) serve() {
+	var workers sync.WaitGroup
+	for range s.workers {
+		workers.Go(s.work)
+	}
+	go func() {
+		workers.Wait()
+		close(s.workersDone)
+	}()
+
+	for _, conn := range s.conns {
+		s.readers.Go(func() { s.read(conn) })
+	}
+
+	// Wake blocked reads as soon as Shutdown is called instead of waiting
+	// for the read timeout.
+	go func() {
+		<-s.quit
+		for _, conn := range s.conns {
+			_ = conn.SetReadDeadline(time.Now())
+		}
+	}()
+}
+
+// read receives datagrams in batches and queues them for the workers.
+// Requests over the rate limit or beyond max_concurrency are answered from
+// here without queueing.
+func (s *Server) read(conn *net.UDPConn) {
+	pc := ipv4.NewPacketConn(conn)
+	msgs := make([]ipv4.Message, batchSize)
+	slots := make([]*packet, batchSize)
+	for i := range msgs {
+		slots[i] = <-s.free
+		msgs[i].Buffers = [][]byte{slots[i].buf}
+	}
+	defer func() {
+		for _, p := range slots {
+			s.free <- p
+		}
+	}()
+
+	for {
+		select {
+		case <-s.quit:
+			return
+		default:
+		}
+
+		_ = conn.SetReadDeadline(time.Now().Add(time.Duration(s.readTimeout.Load())))
+		n, err := pc.ReadBatch(msgs, 0)
+		if err != nil {
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				continue
+			}
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			s.metrics.readErrors.Inc()
+			s.log.Error("failed to read UDP packets", "err", err)
+			continue
+		}
+
+		for i := range n {
+			p := slots[i]
+			p.conn, p.addr, p.n = pc, msgs[i].Addr, msgs[i].N
+
+			// Buckets are charged once a request has been authenticated;
+			// here a source that has already used its bucket is turned away
+			// before it takes a handler slot.
+			if s.limiter.exhausted(sourceIP(p.addr)) {
+				s.reject(p, protocol.NewResponseDTO(protocol.STATUS_RATE_LIMITED, rateLimited))
+				continue
+			}
+			if s.inFlight.Add(1) > int64(s.cfg.MaxConcurrency) {
+				s.inFlight.Add(-1)
+				s.metrics.dropped.Inc()
+				s.reject(p, protocol.NewBusyResponseDTO(time.Duration(s.busyRetryAfter.Load())))
+				continue
+			}
+
+			s.queue <- p
+			slots[i] = <-s.free
+			msgs[i].Buffers[0] = slots[i].buf
+		}
+	}
+}
+
+// work answers queued requests until the queue is closed. After taking one
+// request it takes whatever else is already queued, up to a batch, so the
+// responses go out in a single sendmmsg under load.
+func (s *Server) work() {
+	batch := make([]*packet, 0, batchSize)
+	msgs := make([]ipv4.Message, batchSize)
+	for i := range msgs {
+		msgs[i].Buffers = make([][]byte, 1)
+	}
+
+	for p := range s.queue {
+		batch = append(batch[:0], p)
+	fill:
+		for len(batch) < batchSize {
+			select {
+			case p, ok := <-s.queue:
+				if !ok {
+					break fill
+				}
+				batch = append(batch, p)
+			default:
+				break fill
+			}
+		}
+
+		for _, p := range batch {
+			s.handle(p)
+		}
+		s.writeBatch(batch, msgs)
+
+		for _, p := range batch {
+			p.out = p.out[:0]
+			s.inFlight.Add(-1)
+			s.free <- p
+		}
+	}
+}
+
+// writeBatch sends the responses in batch, one sendmmsg per run of packets
+// that arrived on the same socket.
+func (s *Server) writeBatch(batch []*packet, msgs []ipv4.Message) {
+	for len(batch) > 0 {
+		conn := batch[0].conn
+		n := 0
+		for len(batch) > 0 && batch[0].conn == conn {
+			if len(batch[0].out) > 0 {
+				msgs[n].Buffers[0] = batch[0].out
+				msgs[n].Addr = batch[0].addr
+				n++
+			}
+			batch = batch[1:]
+		}
+
+		for sent := 0; sent < n; {
+			written, err := conn.WriteBatch(msgs[sent:n], 0)
+			if err != nil {
+				s.log.Error("failed to write responses", "err", err)
+				break
+			}
+			sent += written
+		}
+	}
+}
+
+func sourceIP(addr net.Addr) netip.Addr {
+	if udp, ok := addr.(*net.UDPAddr); ok {
+		return udp.AddrPort().Addr().Unmap()
+	}
+	return netip.Addr{}
+}
@@ -2,69 +2,165 @@ package skvs
 
 import (
 	"bytes"
+	"fmt"
+	"strings"
+	"time"
 
 	"github.com/thesimpledev/skvs/internal/protocol"
 )
 
-func commandRouting(app SKVS, frame protocol.FrameDTO) protocol.ResponseDTO {
+// Fixed response values. Response values are only read, so these are shared.
+var (
+	pong     = []byte("PONG")
+	existing = []byte("1")
+	missing  = []byte("0")
+)
+
+// commandRouting runs frame against app. key is the frame's key; it and
+// frame.Value point into the request and are only valid during the call, so
+// the store copies what it keeps. Response values may point into the store
+// or the request, and are copied into the response frame straight away.
+func commandRouting(app SKVS, frame protocol.FrameDTO, key []byte) protocol.ResponseDTO {
 	switch frame.Cmd {
 	case protocol.CMD_SET:
-		return app.set(frame.Key, frame.Value, frame.Overwrite, frame.Old)
+		return app.set(key, frame.Value, frame.Overwrite, frame.Old)
 	case protocol.CMD_GET:
-		return app.get(frame.Key)
+		return app.get(key, frame.IfVersion)
 	case protocol.CMD_DELETE:
-		return app.del(frame.Key)
+		return app.del(key)
 	case protocol.CMD_EXISTS:
-		return app.exists(frame.Key)
+		return app.exists(key)
+	case protocol.CMD_INFO:
+		return app.info()
+	case protocol.CMD_PING:
+		return protocol.NewResponseDTO(protocol.STATUS_OK, pong)
+	case protocol.CMD_SCAN:
+		return app.scan(key)
 	default:
-		return protocol.NewResponseDTO(protocol.STATUS_ERROR, []byte("unknown command"))
+		return protocol.NewResponseDTO(protocol.STATUS_UNKNOWN_COMMAND, []byte("unknown command"))
 	}
 }
 
-func (app *App) set(key string, value []byte, overwrite, old bool) protocol.ResponseDTO {
-	var returnValue []byte
-	var exists bool
+// set stores copies of key and value, the only allocations a request makes
+// in the store. Stored values are never modified, only replaced, so callers
+// may read them without holding the lock.
+func (app *App) set(key, value []byte, overwrite, old bool) protocol.ResponseDTO {
 	app.mu.Lock()
 	defer app.mu.Unlock()
 
-	if returnValue, exists = app.skvs[key]; !exists || overwrite {
+	current, exists := app.skvs[string(key)]
+	returnValue := current.value
+	if !exists || overwrite {
+		name := string(key)
+		growth := int64(len(value)) - int64(len(current.value))
+		newKeys := 0
+		if !exists {
+			growth += int64(len(key))
+			newKeys = 1
+		}
+		if !exists && app.maxKeys > 0 && len(app.skvs) >= app.maxKeys {
+			return protocol.NewResponseDTO(protocol.STATUS_OUT_OF_MEMORY, []byte("key limit reached"))
+		}
+		if growth > 0 && app.maxBytes > 0 && app.bytes+growth > app.maxBytes {
+			return protocol.NewResponseDTO(protocol.STATUS_OUT_OF_MEMORY, []byte("memory limit reached"))
+		}
+		if msg := app.quotaExceeded(name, newKeys, growth); msg != "" {
+			return protocol.NewResponseDTO(protocol.STATUS_OUT_OF_MEMORY, []byte(msg))
+		}
+		app.bytes += growth
+		app.account(name, newKeys, growth)
 		if !old {
 			returnValue = value
 		}
-		app.skvs[key] = bytes.Clone(value)
-	}
-	if returnValue == nil {
-		returnValue = []byte("")
+		app.version++
+		current = entry{value: bytes.Clone(value), version: app.version}
+		app.skvs[name] = current
+		if !exists {
+			app.index.insert(name)
+		}
 	}
-	return protocol.NewResponseDTO(protocol.STATUS_OK, bytes.Clone(returnValue))
+	return protocol.NewVersionedResponseDTO(protocol.STATUS_OK, current.version, returnValue)
 }
 
-func (app *App) get(key string) protocol.ResponseDTO {
+// get answers STATUS_NOT_MODIFIED, without the value, when ifVersion is set
+// and the key is still at that version.
+func (app *App) get(key []byte, ifVersion uint64) protocol.ResponseDTO {
 	app.mu.RLock()
 	defer app.mu.RUnlock()
-	value, exists := app.skvs[key]
+	current, exists := app.skvs[string(key)]
 	if !exists {
 		return protocol.NewResponseDTO(protocol.STATUS_NOT_FOUND, nil)
 	}
-	return protocol.NewResponseDTO(protocol.STATUS_OK, bytes.Clone(value))
+	if ifVersion != 0 && current.version == ifVersion {
+		return protocol.NewVersionedResponseDTO(protocol.STATUS_NOT_MODIFIED, current.version, nil)
+	}
+	return protocol.NewVersionedResponseDTO(protocol.STATUS_OK, current.version, current.value)
 }
 
-func (app *App) del(key string) protocol.ResponseDTO {
+func (app *App) del(key []byte) protocol.ResponseDTO {
 	app.mu.Lock()
 	defer app.mu.Unlock()
-	value, exists := app.skvs[key]
-	delete(app.skvs, key)
+	current, exists := app.skvs[string(key)]
 	if !exists {
 		return protocol.NewResponseDTO(protocol.STATUS_NOT_FOUND, nil)
 	}
-	return protocol.NewResponseDTO(protocol.STATUS_OK, bytes.Clone(value))
+	name := string(key)
+	delete(app.skvs, name)
+	app.index.remove(name)
+	app.bytes -= int64(len(key) + len(current.value))
+	app.account(name, -1, -int64(len(key)+len(current.value)))
+	app.version++
+	return protocol.NewVersionedResponseDTO(protocol.STATUS_OK, current.version, current.value)
 }
 
-func (app *App) exists(key string) protocol.ResponseDTO {
+func (app *App) exists(key []byte) protocol.ResponseDTO {
 	app.mu.RLock()
 	defer app.mu.RUnlock()
-	if _, exists := app.skvs[key]; exists {
-		return protocol.NewResponseDTO(protocol.STATUS_OK, []byte("1"))
+	if current, exists := app.skvs[string(key)]; exists {
+		return protocol.NewVersionedResponseDTO(protocol.STATUS_OK, current.version, existing)
 	}
-	return protocol.NewResponseDTO(protocol.STATUS_OK, []byte("0"))
+	return protocol.NewResponseDTO(protocol.STATUS_OK, missing)
+}
+
+func (app *App) info() protocol.ResponseDTO {
+	uptime := time.Since(app.started)
+	ops := app.ops.Load()
+
+	var stats ServerStats
+	if app.serverStats != nil {
+		stats = app.serverStats()
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "uptime_seconds:%d\n", int64(uptime.Seconds()))
+	fmt.Fprintf(&b, "keys:%d\n", app.Len())
+	fmt.Fprintf(&b, "memory_bytes:%d\n", app.Bytes())
+	fmt.Fprintf(&b, "total_ops:%d\n", ops)
+	fmt.Fprintf(&b, "ops_per_sec:%.2f\n", float64(ops)/max(uptime.Seconds(), 1))
+	fmt.Fprintf(&b, "handlers_in_flight:%d\n", stats.InFlight)
+	fmt.Fprintf(&b, "handlers_capacity:%d\n", stats.Capacity)
+	fmt.Fprintf(&b, "dropped_packets:%d\n", stats.Dropped)
+	fmt.Fprintf(&b, "decrypt_errors:%d\n", stats.DecryptErrors)
+
+	return protocol.NewResponseDTO(protocol.STATUS_OK, []byte(b.String()))
+}
+
+// scan returns, in key order, the next page of keys after cursor. The page
+// is empty once the cursor has passed the last key. Keys written during a
+// scan may or may not be seen, but no key present throughout is skipped.
+func (app *App) scan(cursor []byte) protocol.ResponseDTO {
+	app.mu.RLock()
+	var keys []string
+	size := 0
+	for key := range app.index.after(string(cursor)) {
+		if size += 1 + len(key); size > protocol.ResponseValueSize {
+			break
+		}
+		keys = append(keys, key)
+	}
+	version := app.version
+	app.mu.RUnlock()
+
+	packed, _ := protocol.PackKeys(keys)
+	return protocol.NewVersionedResponseDTO(protocol.STATUS_OK, version, packed)
 }
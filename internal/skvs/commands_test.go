@@ -2,37 +2,50 @@ package skvs
 
 import (
 	"bytes"
+	"fmt"
 	"io"
 	"log/slog"
+	"reflect"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/thesimpledev/skvs/internal/protocol"
 )
 
 type testApp struct{}
 
-func (app *testApp) set(_ string, _ []byte, _, _ bool) protocol.ResponseDTO {
+func (app *testApp) set(_, _ []byte, _, _ bool) protocol.ResponseDTO {
 	return protocol.NewResponseDTO(protocol.STATUS_OK, []byte("set"))
 }
 
-func (app *testApp) get(_ string) protocol.ResponseDTO {
+func (app *testApp) get(_ []byte, _ uint64) protocol.ResponseDTO {
 	return protocol.NewResponseDTO(protocol.STATUS_OK, []byte("get"))
 }
 
-func (app *testApp) del(_ string) protocol.ResponseDTO {
+func (app *testApp) del(_ []byte) protocol.ResponseDTO {
 	return protocol.NewResponseDTO(protocol.STATUS_OK, []byte("del"))
 }
 
-func (app *testApp) exists(_ string) protocol.ResponseDTO {
+func (app *testApp) exists(_ []byte) protocol.ResponseDTO {
 	return protocol.NewResponseDTO(protocol.STATUS_OK, []byte("exists"))
 }
 
+func (app *testApp) scan(_ []byte) protocol.ResponseDTO {
+	return protocol.ResponseDTO{}
+}
+
+func (app *testApp) info() protocol.ResponseDTO {
+	return protocol.NewResponseDTO(protocol.STATUS_OK, []byte("info"))
+}
+
 func newTestApp() *App {
 	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
 
 	app := &App{
-		log:  logger,
-		skvs: make(map[string][]byte),
+		log:     logger,
+		skvs:    make(map[string]entry),
+		started: time.Now(),
 	}
 
 	return app
@@ -77,13 +90,29 @@ func TestCommandrouting(t *testing.T) {
 			wantValue:  []byte("exists"),
 			wantStatus: protocol.STATUS_OK,
 		},
+		{
+			name: "info command",
+			frame: protocol.FrameDTO{
+				Cmd: protocol.CMD_INFO,
+			},
+			wantValue:  []byte("info"),
+			wantStatus: protocol.STATUS_OK,
+		},
+		{
+			name: "ping command",
+			frame: protocol.FrameDTO{
+				Cmd: protocol.CMD_PING,
+			},
+			wantValue:  []byte("PONG"),
+			wantStatus: protocol.STATUS_OK,
+		},
 		{
 			name: "unknown command",
 			frame: protocol.FrameDTO{
 				Cmd: ';',
 			},
 			wantValue:  []byte("unknown command"),
-			wantStatus: protocol.STATUS_ERROR,
+			wantStatus: protocol.STATUS_UNKNOWN_COMMAND,
 		},
 	}
 
@@ -91,7 +120,7 @@ func TestCommandrouting(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			app := &testApp{}
 
-			got := commandRouting(app, tt.frame)
+			got := commandRouting(app, tt.frame, []byte(tt.frame.Key))
 
 			if got.Status != tt.wantStatus {
 				t.Errorf("status: want %v, got %v", tt.wantStatus, got.Status)
@@ -191,14 +220,14 @@ func TestSet(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			app := newTestApp()
 			if tt.initial != nil {
-				_ = app.set(tt.key, tt.initial, false, false)
+				_ = app.set([]byte(tt.key), tt.initial, false, false)
 			}
-			got := app.set(tt.key, tt.value, tt.overwrite, tt.old)
+			got := app.set([]byte(tt.key), tt.value, tt.overwrite, tt.old)
 
 			if string(got.Value) != string(tt.wantReturn) {
 				t.Errorf("set() = %v, want %v", string(got.Value), string(tt.wantReturn))
 			}
-			gotMap := app.get(tt.key)
+			gotMap := app.get([]byte(tt.key), 0)
 			if string(gotMap.Value) != string(tt.wantMap) {
 				t.Errorf("get() = %v, want %v", string(gotMap.Value), string(tt.wantMap))
 			}
@@ -211,9 +240,9 @@ func TestGet(t *testing.T) {
 
 	want := []byte("Jack")
 
-	_ = app.set("cat", want, false, false)
+	_ = app.set([]byte("cat"), want, false, false)
 
-	got := app.get("cat")
+	got := app.get([]byte("cat"), 0)
 
 	if !bytes.Equal(got.Value, want) {
 		t.Errorf("expected %v, got %v", want, got.Value)
@@ -225,15 +254,15 @@ func TestDel(t *testing.T) {
 
 	want := []byte("Jack")
 
-	_ = app.set("cat", want, false, false)
+	_ = app.set([]byte("cat"), want, false, false)
 
-	got := app.del("cat")
+	got := app.del([]byte("cat"))
 
 	if !bytes.Equal(want, got.Value) {
 		t.Errorf("delete return - want %v, got %v", want, got.Value)
 	}
 
-	gotAfterDel := app.get("cat")
+	gotAfterDel := app.get([]byte("cat"), 0)
 	if gotAfterDel.Status != protocol.STATUS_NOT_FOUND {
 		t.Errorf("get after delete - want STATUS_NOT_FOUND, got status %v", gotAfterDel.Status)
 	}
@@ -264,10 +293,10 @@ func TestExists(t *testing.T) {
 			app := newTestApp()
 
 			if tt.value != nil {
-				_ = app.set(tt.key, tt.value, false, false)
+				_ = app.set([]byte(tt.key), tt.value, false, false)
 			}
 
-			got := app.exists(tt.key)
+			got := app.exists([]byte(tt.key))
 
 			if !bytes.Equal(tt.want, got.Value) {
 				t.Errorf("want %v, got %v", tt.want, got.Value)
@@ -275,3 +304,129 @@ func TestExists(t *testing.T) {
 		})
 	}
 }
+
+func TestInfo(t *testing.T) {
+	app := newTestApp()
+	app.SetServerStats(func() ServerStats {
+		return ServerStats{InFlight: 3, Capacity: 1000, Dropped: 7, DecryptErrors: 2}
+	})
+
+	_ = app.set([]byte("cat"), []byte("jack"), false, false)
+
+	got := app.info()
+	if got.Status != protocol.STATUS_OK {
+		t.Fatalf("status: want %v, got %v", protocol.STATUS_OK, got.Status)
+	}
+
+	for _, line := range []string{
+		"keys:1",
+		"memory_bytes:7",
+		"handlers_in_flight:3",
+		"handlers_capacity:1000",
+		"dropped_packets:7",
+		"decrypt_errors:2",
+	} {
+		if !strings.Contains(string(got.Value), line+"\n") {
+			t.Errorf("info missing %q:\n%s", line, got.Value)
+		}
+	}
+}
+
+func TestInfoWithoutServerStats(t *testing.T) {
+	app := newTestApp()
+
+	got := app.info()
+
+	if !strings.Contains(string(got.Value), "handlers_capacity:0\n") {
+		t.Errorf("expected zero server stats:\n%s", got.Value)
+	}
+}
+
+func TestVersions(t *testing.T) {
+	app := newTestApp()
+
+	first := app.set([]byte("cat"), []byte("jack"), false, false)
+	if first.Version == 0 {
+		t.Fatalf("set: want non-zero version")
+	}
+
+	unchanged := app.set([]byte("cat"), []byte("ignored"), false, false)
+	if unchanged.Version != first.Version {
+		t.Errorf("set without overwrite: want version %d, got %d", first.Version, unchanged.Version)
+	}
+
+	second := app.set([]byte("cat"), []byte("jackson"), true, false)
+	if second.Version <= first.Version {
+		t.Errorf("overwrite: want version greater than %d, got %d", first.Version, second.Version)
+	}
+
+	if got := app.get([]byte("cat"), 0); got.Version != second.Version {
+		t.Errorf("get: want version %d, got %d", second.Version, got.Version)
+	}
+
+	if got := app.exists([]byte("cat")); got.Version != second.Version {
+		t.Errorf("exists: want version %d, got %d", second.Version, got.Version)
+	}
+
+	if got := app.del([]byte("cat")); got.Version != second.Version {
+		t.Errorf("delete: want version %d, got %d", second.Version, got.Version)
+	}
+
+	if got := app.get([]byte("cat"), 0); got.Version != 0 {
+		t.Errorf("get after delete: want version 0, got %d", got.Version)
+	}
+}
+
+func TestGetIfVersion(t *testing.T) {
+	app := newTestApp()
+
+	first := app.set([]byte("cat"), []byte("jack"), false, false)
+
+	got := app.get([]byte("cat"), first.Version)
+	if got.Status != protocol.STATUS_NOT_MODIFIED || got.Value != nil || got.Version != first.Version {
+		t.Errorf("same version: want not_modified without value, got %+v", got)
+	}
+
+	second := app.set([]byte("cat"), []byte("jackson"), true, false)
+	got = app.get([]byte("cat"), first.Version)
+	if got.Status != protocol.STATUS_OK || string(got.Value) != "jackson" || got.Version != second.Version {
+		t.Errorf("newer version: want full value, got %+v", got)
+	}
+
+	app.del([]byte("cat"))
+	if got := app.get([]byte("cat"), second.Version); got.Status != protocol.STATUS_NOT_FOUND {
+		t.Errorf("deleted key: want not_found, got %s", protocol.StatusName(got.Status))
+	}
+}
+
+func TestScan(t *testing.T) {
+	app := newTestApp()
+	var want []string
+	for i := range 30 {
+		key := fmt.Sprintf("key-%02d-%s", i, strings.Repeat("x", 60))
+		want = append(want, key)
+		app.set([]byte(key), []byte("v"), false, false)
+	}
+
+	var got []string
+	cursor := ""
+	for pages := 0; ; pages++ {
+		if pages > len(want) {
+			t.Fatalf("scan did not finish")
+		}
+		response := app.scan([]byte(cursor))
+		keys, err := protocol.UnpackKeys(response.Value)
+		if err != nil {
+			t.Fatalf("unpack: %v", err)
+		}
+		if len(keys) == 0 {
+			break
+		}
+		got = append(got, keys...)
+		cursor = keys[len(keys)-1]
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("want all %d keys in order, got %d: %v", len(want), len(got), got)
+	}
+}
@@ -0,0 +1,107 @@
+package skvs
+
+import (
+	"iter"
+	"slices"
+	"strings"
+)
+
+// maxBlock is the most keys a block of the index holds before it is split.
+const maxBlock = 512
+
+// keyIndex keeps every key in order for SCAN, as a list of sorted blocks of
+// at most maxBlock keys. Inserting or removing a key moves at most a block's
+// worth of strings, and finding where a page starts is two binary searches.
+// The zero value is empty and ready to use; the caller provides locking.
+type keyIndex struct {
+	blocks [][]string
+}
+
+func newKeyIndex(keys []string) keyIndex {
+	slices.Sort(keys)
+	var x keyIndex
+	for chunk := range slices.Chunk(keys, maxBlock/2) {
+		x.blocks = append(x.blocks, slices.Clip(chunk))
+	}
+	return x
+}
+
+// block returns the index of the block that key belongs in: the last one
+// whose first key is not after it.
+func (x *keyIndex) block(key string) int {
+	i, found := slices.BinarySearchFunc(x.blocks, key, func(b []string, key string) int {
+		return strings.Compare(b[0], key)
+	})
+	if found || i == 0 {
+		return i
+	}
+	return i - 1
+}
+
+func (x *keyIndex) insert(key string) {
+	if len(x.blocks) == 0 {
+		x.blocks = [][]string{{key}}
+		return
+	}
+	i := x.block(key)
+	b := x.blocks[i]
+	j, found := slices.BinarySearch(b, key)
+	if found {
+		return
+	}
+	b = slices.Insert(b, j, key)
+	if len(b) <= maxBlock {
+		x.blocks[i] = b
+		return
+	}
+	half := len(b) / 2
+	x.blocks[i] = slices.Clip(b[:half])
+	x.blocks = slices.Insert(x.blocks, i+1, slices.Clone(b[half:]))
+}
+
+func (x *keyIndex) remove(key string) {
+	if len(x.blocks) == 0 {
+		return
+	}
+	i := x.block(key)
+	b := x.blocks[i]
+	j, found := slices.BinarySearch(b, key)
+	if !found {
+		return
+	}
+	b = slices.Delete(b, j, j+1)
+	if len(b) == 0 {
+		x.blocks = slices.Delete(x.blocks, i, i+1)
+		return
+	}
+	x.blocks[i] = b
+}
+
+// after yields the keys greater than cursor, in order.
+func (x *keyIndex) after(cursor string) iter.Seq[string] {
+	return func(yield func(string) bool) {
+		if len(x.blocks) == 0 {
+			return
+		}
+		i := x.block(cursor)
+		j, found := slices.BinarySearch(x.blocks[i], cursor)
+		if found {
+			j++
+		}
+		for ; i < len(x.blocks); i, j = i+1, 0 {
+			for _, key := range x.blocks[i][j:] {
+				if !yield(key) {
+					return
+				}
+			}
+		}
+	}
+}
+
+func (x *keyIndex) len() int {
+	n := 0
+	for _, b := range x.blocks {
+		n += len(b)
+	}
+	return n
+}
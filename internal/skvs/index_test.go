@@ -0,0 +1,83 @@
+package skvs
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"slices"
+	"testing"
+)
+
+func TestKeyIndex(t *testing.T) {
+	var x keyIndex
+	present := make(map[string]bool)
+	rng := rand.New(rand.NewPCG(1, 2))
+
+	// Enough keys to split blocks, and enough removals to empty some.
+	for range 20000 {
+		key := fmt.Sprintf("k%05d", rng.IntN(3000))
+		if rng.IntN(3) == 0 {
+			x.remove(key)
+			delete(present, key)
+		} else {
+			x.insert(key)
+			present[key] = true
+		}
+	}
+
+	want := make([]string, 0, len(present))
+	for key := range present {
+		want = append(want, key)
+	}
+	slices.Sort(want)
+	if x.len() != len(want) {
+		t.Fatalf("want %d keys, got %d", len(want), x.len())
+	}
+	for _, b := range x.blocks {
+		if len(b) == 0 || len(b) > maxBlock {
+			t.Fatalf("want blocks of 1 to %d keys, got %d", maxBlock, len(b))
+		}
+	}
+
+	tests := []struct {
+		name   string
+		cursor string
+	}{
+		{name: "from the start", cursor: ""},
+		{name: "present key", cursor: want[len(want)/2]},
+		{name: "missing key", cursor: want[len(want)/3] + "0"},
+		{name: "last key", cursor: want[len(want)-1]},
+		{name: "past the end", cursor: "z"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			i, found := slices.BinarySearch(want, tt.cursor)
+			if found {
+				i++
+			}
+			if got := slices.Collect(x.after(tt.cursor)); !slices.Equal(got, want[i:]) {
+				t.Errorf("want %d keys after %q, got %d", len(want[i:]), tt.cursor, len(got))
+			}
+		})
+	}
+
+	rebuilt := newKeyIndex(slices.Clone(want))
+	rebuilt.insert("k00000x")
+	rebuilt.remove(want[0])
+	wantRebuilt := slices.Insert(slices.Clone(want[1:]), 0, "k00000x")
+	slices.Sort(wantRebuilt)
+	if got := slices.Collect(rebuilt.after("")); !slices.Equal(got, wantRebuilt) {
+		t.Error("want a rebuilt index to stay ordered through inserts and removals")
+	}
+}
+
+func BenchmarkScan(b *testing.B) {
+	app := newTestApp()
+	for i := range 200000 {
+		app.set(fmt.Appendf(nil, "key-%07d", i), []byte("v"), false, false)
+	}
+	cursor := []byte("key-0100000")
+	b.ReportAllocs()
+	for b.Loop() {
+		app.scan(cursor)
+	}
+}
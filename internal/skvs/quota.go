@@ -0,0 +1,105 @@
+package skvs
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Quotas cap what each tenant may store. A key's tenant is the part before
+// the first Separator; keys without one belong to the tenant "". Zero limits
+// are unlimited.
+type Quotas struct {
+	Separator string
+	MaxKeys   int
+	MaxBytes  int64
+}
+
+func (q Quotas) enabled() bool {
+	return q.Separator != "" && (q.MaxKeys > 0 || q.MaxBytes > 0)
+}
+
+func (q Quotas) tenant(key string) string {
+	tenant, _, found := strings.Cut(key, q.Separator)
+	if !found {
+		return ""
+	}
+	return tenant
+}
+
+type usage struct {
+	keys  int
+	bytes int64
+}
+
+// SetQuotas replaces the per-tenant quotas. Usage is only tracked while
+// quotas are enabled, so turning them on or changing the separator recounts
+// every key under the write lock.
+func (app *App) SetQuotas(q Quotas) {
+	app.mu.Lock()
+	defer app.mu.Unlock()
+
+	recount := q.enabled() && (app.tenants == nil || q.Separator != app.quotas.Separator)
+	app.quotas = q
+	switch {
+	case !q.enabled():
+		app.tenants = nil
+	case recount:
+		app.recountTenants()
+	}
+}
+
+// TenantUsage returns the keys and bytes stored for tenant, or zeros while
+// quotas are disabled.
+func (app *App) TenantUsage(tenant string) (int, int64) {
+	app.mu.RLock()
+	defer app.mu.RUnlock()
+	u := app.tenants[tenant]
+	return u.keys, u.bytes
+}
+
+// recountTenants rebuilds usage from the stored keys. The caller holds the
+// write lock.
+func (app *App) recountTenants() {
+	if !app.quotas.enabled() {
+		app.tenants = nil
+		return
+	}
+	app.tenants = make(map[string]usage)
+	for key, e := range app.skvs {
+		app.account(key, 1, int64(len(key)+len(e.value)))
+	}
+}
+
+// quotaExceeded reports why a write adding keys and growth bytes under key
+// is refused, or "" if it fits. The caller holds the write lock.
+func (app *App) quotaExceeded(key string, keys int, growth int64) string {
+	if app.tenants == nil {
+		return ""
+	}
+	tenant := app.quotas.tenant(key)
+	u := app.tenants[tenant]
+	if keys > 0 && app.quotas.MaxKeys > 0 && u.keys+keys > app.quotas.MaxKeys {
+		return fmt.Sprintf("key quota reached for tenant %q", tenant)
+	}
+	if growth > 0 && app.quotas.MaxBytes > 0 && u.bytes+growth > app.quotas.MaxBytes {
+		return fmt.Sprintf("byte quota reached for tenant %q", tenant)
+	}
+	return ""
+}
+
+// account adds keys and bytes to key's tenant. The caller holds the write
+// lock.
+func (app *App) account(key string, keys int, bytes int64) {
+	if app.tenants == nil {
+		return
+	}
+	tenant := app.quotas.tenant(key)
+	u := app.tenants[tenant]
+	u.keys += keys
+	u.bytes += bytes
+	if u.keys == 0 {
+		delete(app.tenants, tenant)
+		return
+	}
+	app.tenants[tenant] = u
+}
@@ -0,0 +1,58 @@
+package skvs
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/thesimpledev/skvs/internal/protocol"
+)
+
+func TestQuotas(t *testing.T) {
+	app := newTestApp()
+	app.set([]byte("acme:a"), []byte("1"), false, false)
+	app.SetQuotas(Quotas{Separator: ":", MaxKeys: 2, MaxBytes: 30})
+
+	tests := []struct {
+		name       string
+		key        string
+		value      string
+		overwrite  bool
+		wantStatus byte
+		wantMsg    string
+	}{
+		{name: "counts keys stored before quotas", key: "acme:b", value: "2", wantStatus: protocol.STATUS_OK},
+		{name: "key quota", key: "acme:c", value: "3", wantStatus: protocol.STATUS_OUT_OF_MEMORY, wantMsg: `key quota reached for tenant "acme"`},
+		{name: "other tenant unaffected", key: "beta:a", value: "1", wantStatus: protocol.STATUS_OK},
+		{name: "keys without separator share a tenant", key: "plain", value: "1", wantStatus: protocol.STATUS_OK},
+		{name: "byte quota", key: "beta:a", value: strings.Repeat("x", 30), overwrite: true, wantStatus: protocol.STATUS_OUT_OF_MEMORY, wantMsg: `byte quota reached for tenant "beta"`},
+		{name: "overwrite within quota", key: "acme:a", value: "longer", overwrite: true, wantStatus: protocol.STATUS_OK},
+	}
+
+	for _, tt := range tests {
+		got := app.set([]byte(tt.key), []byte(tt.value), tt.overwrite, false)
+		if got.Status != tt.wantStatus {
+			t.Errorf("%s: want %s, got %s", tt.name, protocol.StatusName(tt.wantStatus), protocol.StatusName(got.Status))
+		}
+		if tt.wantMsg != "" && !bytes.Equal(got.Value, []byte(tt.wantMsg)) {
+			t.Errorf("%s: want message %q, got %q", tt.name, tt.wantMsg, got.Value)
+		}
+	}
+
+	if keys, size := app.TenantUsage("acme"); keys != 2 || size != int64(len("acme:a")+len("longer")+len("acme:b")+1) {
+		t.Errorf("acme usage: got %d keys, %d bytes", keys, size)
+	}
+
+	app.del([]byte("acme:a"))
+	if got := app.set([]byte("acme:c"), []byte("3"), false, false); got.Status != protocol.STATUS_OK {
+		t.Errorf("after delete: want ok, got %s", protocol.StatusName(got.Status))
+	}
+
+	app.SetQuotas(Quotas{})
+	if keys, _ := app.TenantUsage("acme"); keys != 0 {
+		t.Errorf("disabled quotas: want no usage tracked, got %d keys", keys)
+	}
+	if got := app.set([]byte("acme:d"), []byte("4"), false, false); got.Status != protocol.STATUS_OK {
+		t.Errorf("disabled quotas: want ok, got %s", protocol.StatusName(got.Status))
+	}
+}
@@ -5,35 +5,112 @@ import (
 	"fmt"
 	"log/slog"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/thesimpledev/skvs/internal/protocol"
 )
 
 type SKVS interface {
-	set(key string, value []byte, overwrite, old bool) protocol.ResponseDTO
-	get(key string) protocol.ResponseDTO
-	del(key string) protocol.ResponseDTO
-	exists(key string) protocol.ResponseDTO
+	set(key, value []byte, overwrite, old bool) protocol.ResponseDTO
+	get(key []byte, ifVersion uint64) protocol.ResponseDTO
+	del(key []byte) protocol.ResponseDTO
+	exists(key []byte) protocol.ResponseDTO
+	info() protocol.ResponseDTO
+	scan(cursor []byte) protocol.ResponseDTO
+}
+
+// ServerStats holds transport-level counters that only the server can see.
+// They are reported alongside the store's own numbers by the INFO command.
+type ServerStats struct {
+	InFlight      int
+	Capacity      int
+	Dropped       uint64
+	DecryptErrors uint64
+}
+
+// entry is a stored value together with the version assigned when it was
+// last written. Versions come from a single store-wide counter, so they only
+// ever increase.
+type entry struct {
+	value   []byte
+	version uint64
 }
 
 type App struct {
-	log  *slog.Logger
-	skvs map[string][]byte
-	mu   sync.RWMutex
+	log         *slog.Logger
+	skvs        map[string]entry
+	index       keyIndex
+	bytes       int64
+	version     uint64
+	mu          sync.RWMutex
+	started     time.Time
+	ops         atomic.Uint64
+	serverStats func() ServerStats
+	maxKeys     int
+	maxBytes    int64
+	quotas      Quotas
+	tenants     map[string]usage
 }
 
 func New(log *slog.Logger) *App {
 	return &App{
-		log:  log,
-		skvs: make(map[string][]byte, 0),
+		log:     log,
+		skvs:    make(map[string]entry, 0),
+		started: time.Now(),
 	}
 }
 
+// SetServerStats registers the callback INFO uses to report server counters.
+func (app *App) SetServerStats(fn func() ServerStats) {
+	app.serverStats = fn
+}
+
+// SetLimits caps the number of keys and the key and value bytes stored; zero
+// means unlimited. Writes that would exceed a limit are refused with
+// STATUS_OUT_OF_MEMORY. Data already stored is kept when limits shrink.
+func (app *App) SetLimits(maxKeys int, maxBytes int64) {
+	app.mu.Lock()
+	defer app.mu.Unlock()
+	app.maxKeys = maxKeys
+	app.maxBytes = maxBytes
+}
+
+// Version returns the version of the most recent write, so callers can tell
+// whether anything changed since they last looked.
+func (app *App) Version() uint64 {
+	app.mu.RLock()
+	defer app.mu.RUnlock()
+	return app.version
+}
+
+// Len returns the number of keys currently stored.
+func (app *App) Len() int {
+	app.mu.RLock()
+	defer app.mu.RUnlock()
+	return len(app.skvs)
+}
+
+// Bytes returns the number of key and value bytes currently stored.
+func (app *App) Bytes() int64 {
+	app.mu.RLock()
+	defer app.mu.RUnlock()
+	return app.bytes
+}
+
 func ProcessMessage(app *App, frame []byte) ([]byte, error) {
-	frameDTO, err := protocol.FrameToDTO(frame)
+	return ProcessMessageTo(nil, app, frame)
+}
+
+// ProcessMessageTo runs the request in frame and appends the response frame
+// to dst, so callers that keep a buffer per request can reuse it.
+func ProcessMessageTo(dst []byte, app *App, frame []byte) ([]byte, error) {
+	frameDTO, key, err := protocol.ParseFrame(frame)
 	if err != nil {
 		return nil, fmt.Errorf("unable to parse frame: %v", err)
 	}
-	responseDTO := commandRouting(app, frameDTO)
-	return protocol.ResponseDTOToFrame(responseDTO), nil
+	app.ops.Add(1)
+	responseDTO := commandRouting(app, frameDTO, key)
+	responseDTO.RequestID = frameDTO.RequestID
+	return protocol.AppendResponseFrame(dst, responseDTO), nil
 }
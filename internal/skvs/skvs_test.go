@@ -47,3 +47,47 @@ func TestProcessMessage(t *testing.T) {
 		})
 	}
 }
+
+func TestLenAndBytes(t *testing.T) {
+	app := newTestApp()
+
+	_ = app.set([]byte("cat"), []byte("jack"), false, false)
+	_ = app.set([]byte("dog"), []byte("rex"), false, false)
+	_ = app.set([]byte("cat"), []byte("jackson"), true, false)
+	_ = app.set([]byte("dog"), []byte("ignored"), false, false)
+
+	if got := app.Len(); got != 2 {
+		t.Errorf("Len() = %d, want 2", got)
+	}
+	if got := app.Bytes(); got != int64(len("cat")+len("jackson")+len("dog")+len("rex")) {
+		t.Errorf("Bytes() = %d, want %d", got, len("cat")+len("jackson")+len("dog")+len("rex"))
+	}
+
+	_ = app.del([]byte("cat"))
+	_ = app.del([]byte("missing"))
+
+	if got := app.Len(); got != 1 {
+		t.Errorf("Len() after delete = %d, want 1", got)
+	}
+	if got := app.Bytes(); got != int64(len("dog")+len("rex")) {
+		t.Errorf("Bytes() after delete = %d, want %d", got, len("dog")+len("rex"))
+	}
+}
+
+func TestProcessMessageEchoesRequestID(t *testing.T) {
+	app := newTestApp()
+	frame := protocol.DtoToFrame(protocol.FrameDTO{Cmd: protocol.CMD_GET, RequestID: 42, Key: "key"})
+
+	response, err := ProcessMessage(app, frame)
+	if err != nil {
+		t.Fatalf("ProcessMessage() error = %v", err)
+	}
+
+	got, err := protocol.FrameToResponseDTO(response)
+	if err != nil {
+		t.Fatalf("FrameToResponseDTO() error = %v", err)
+	}
+	if got.RequestID != 42 {
+		t.Errorf("request id: want 42, got %d", got.RequestID)
+	}
+}
@@ -0,0 +1,139 @@
+package skvs
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// A snapshot is a header followed by one record per key:
+//
+//	"SKVSSNAP\x01" | store version (8 B) | key count (8 B)
+//	key length (1 B) | value length (2 B) | version (8 B) | key | value
+//
+// All integers are little-endian. Versions are kept so that clients holding
+// a version from before a restart are not told a changed key is unmodified.
+var snapshotMagic = []byte("SKVSSNAP\x01")
+
+type snapshotRecord struct {
+	key string
+	entry
+}
+
+// WriteSnapshot writes every key to w. Entries are copied under the read
+// lock and encoded after it is released, so writes are only held up for the
+// copy.
+func (app *App) WriteSnapshot(w io.Writer) error {
+	app.mu.RLock()
+	version := app.version
+	records := make([]snapshotRecord, 0, len(app.skvs))
+	for key, e := range app.skvs {
+		records = append(records, snapshotRecord{key: key, entry: e})
+	}
+	app.mu.RUnlock()
+
+	bw := bufio.NewWriter(w)
+	header := binary.LittleEndian.AppendUint64(bytes.Clone(snapshotMagic), version)
+	header = binary.LittleEndian.AppendUint64(header, uint64(len(records)))
+	if _, err := bw.Write(header); err != nil {
+		return err
+	}
+
+	// bufio.Writer keeps the first error and returns it from Flush, so the
+	// record writes need not be checked one by one.
+	for _, r := range records {
+		var rh [11]byte
+		rh[0] = byte(len(r.key))
+		binary.LittleEndian.PutUint16(rh[1:], uint16(len(r.value)))
+		binary.LittleEndian.PutUint64(rh[3:], r.version)
+		_, _ = bw.Write(rh[:])
+		_, _ = bw.WriteString(r.key)
+		_, _ = bw.Write(r.value)
+	}
+	return bw.Flush()
+}
+
+// ReadSnapshot replaces the store's contents with the snapshot in r.
+func (app *App) ReadSnapshot(r io.Reader) error {
+	br := bufio.NewReader(r)
+
+	header := make([]byte, len(snapshotMagic)+16)
+	if _, err := io.ReadFull(br, header); err != nil {
+		return fmt.Errorf("read snapshot header: %w", err)
+	}
+	if !bytes.Equal(header[:len(snapshotMagic)], snapshotMagic) {
+		return fmt.Errorf("not a snapshot")
+	}
+	version := binary.LittleEndian.Uint64(header[len(snapshotMagic):])
+	count := binary.LittleEndian.Uint64(header[len(snapshotMagic)+8:])
+
+	data := make(map[string]entry)
+	keys := make([]string, 0, min(count, 1<<20))
+	var size int64
+	for i := range count {
+		var rh [11]byte
+		if _, err := io.ReadFull(br, rh[:]); err != nil {
+			return fmt.Errorf("read record %d: %w", i, err)
+		}
+		buf := make([]byte, int(rh[0])+int(binary.LittleEndian.Uint16(rh[1:])))
+		if _, err := io.ReadFull(br, buf); err != nil {
+			return fmt.Errorf("read record %d: %w", i, err)
+		}
+		key := string(buf[:rh[0]])
+		if _, dup := data[key]; !dup {
+			keys = append(keys, key)
+		}
+		data[key] = entry{value: buf[rh[0]:], version: binary.LittleEndian.Uint64(rh[3:])}
+		size += int64(len(buf))
+	}
+
+	app.mu.Lock()
+	defer app.mu.Unlock()
+	app.skvs = data
+	app.index = newKeyIndex(keys)
+	app.bytes = size
+	app.version = version
+	app.recountTenants()
+	return nil
+}
+
+// SaveSnapshot writes a snapshot to path atomically: it is written to a
+// temporary file in the same directory and renamed into place.
+func (app *App) SaveSnapshot(path string) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return fmt.Errorf("create snapshot: %w", err)
+	}
+	defer func() { _ = os.Remove(tmp.Name()) }()
+
+	if err := app.WriteSnapshot(tmp); err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("write snapshot: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("sync snapshot: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("close snapshot: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("rename snapshot: %w", err)
+	}
+	return nil
+}
+
+// LoadSnapshot restores the store from path. A missing file is reported as
+// an error matching os.ErrNotExist so callers can treat it as a first start.
+func (app *App) LoadSnapshot(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return app.ReadSnapshot(f)
+}
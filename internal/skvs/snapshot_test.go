@@ -0,0 +1,91 @@
+package skvs
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/thesimpledev/skvs/internal/protocol"
+)
+
+func TestSnapshotRoundTrip(t *testing.T) {
+	app := newTestApp()
+	app.set([]byte("cat"), []byte("jack"), false, false)
+	app.set([]byte("dog"), []byte{0x00, 0xff, 0x01}, false, false)
+	app.set([]byte("cat"), []byte("jackson"), true, false)
+	app.del([]byte("dog"))
+	app.set([]byte("bird"), []byte("tweety"), false, false)
+
+	path := filepath.Join(t.TempDir(), "skvs.snap")
+	if err := app.SaveSnapshot(path); err != nil {
+		t.Fatalf("save: %v", err)
+	}
+
+	restored := newTestApp()
+	if err := restored.LoadSnapshot(path); err != nil {
+		t.Fatalf("load: %v", err)
+	}
+
+	if restored.Len() != app.Len() || restored.Bytes() != app.Bytes() || restored.Version() != app.Version() {
+		t.Errorf("want len %d bytes %d version %d, got %d %d %d",
+			app.Len(), app.Bytes(), app.Version(), restored.Len(), restored.Bytes(), restored.Version())
+	}
+	for _, key := range []string{"cat", "bird"} {
+		want, got := app.get([]byte(key), 0), restored.get([]byte(key), 0)
+		if !bytes.Equal(want.Value, got.Value) || want.Version != got.Version {
+			t.Errorf("%s: want %+v, got %+v", key, want, got)
+		}
+	}
+	if got, want := restored.scan(nil).Value, app.scan(nil).Value; !bytes.Equal(got, want) {
+		t.Errorf("want the restored keys indexed for scan, got %q, want %q", got, want)
+	}
+
+	// New writes continue from the restored version.
+	if got := restored.set([]byte("fish"), []byte("nemo"), false, false); got.Version <= app.Version() {
+		t.Errorf("want version above %d after restore, got %d", app.Version(), got.Version)
+	}
+}
+
+func TestSnapshotErrors(t *testing.T) {
+	app := newTestApp()
+
+	if err := app.LoadSnapshot(filepath.Join(t.TempDir(), "missing")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("missing file: want os.ErrNotExist, got %v", err)
+	}
+	if err := app.ReadSnapshot(bytes.NewReader([]byte("SKVSDUMP\x01................"))); err == nil {
+		t.Errorf("want error for wrong magic")
+	}
+
+	var buf bytes.Buffer
+	app.set([]byte("cat"), []byte("jack"), false, false)
+	_ = app.WriteSnapshot(&buf)
+	truncated := buf.Bytes()[:buf.Len()-2]
+	if err := newTestApp().ReadSnapshot(bytes.NewReader(truncated)); err == nil {
+		t.Errorf("want error for truncated snapshot")
+	}
+}
+
+func TestLimits(t *testing.T) {
+	app := newTestApp()
+	app.SetLimits(2, 20)
+
+	app.set([]byte("a"), []byte("1"), false, false)
+	app.set([]byte("b"), []byte("2"), false, false)
+	if got := app.set([]byte("c"), []byte("3"), false, false); got.Status != protocol.STATUS_OUT_OF_MEMORY {
+		t.Errorf("third key: want out_of_memory, got %s", protocol.StatusName(got.Status))
+	}
+
+	if got := app.set([]byte("a"), []byte("a value that is too long"), true, false); got.Status != protocol.STATUS_OUT_OF_MEMORY {
+		t.Errorf("growth past byte limit: want out_of_memory, got %s", protocol.StatusName(got.Status))
+	}
+	if got := app.set([]byte("a"), []byte("fits"), true, false); got.Status != protocol.STATUS_OK {
+		t.Errorf("overwrite within limits: want ok, got %s", protocol.StatusName(got.Status))
+	}
+
+	app.SetLimits(0, 0)
+	if got := app.set([]byte("c"), []byte("3"), false, false); got.Status != protocol.STATUS_OK {
+		t.Errorf("no limits: want ok, got %s", protocol.StatusName(got.Status))
+	}
+}
@@ -0,0 +1,142 @@
+package skvs
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// CacheStats counts near cache activity. Hits were answered without the
+// network, Revalidations needed a round trip but no value transfer, and
+// Misses fetched the value. Evictions counts entries dropped to stay within
+// the size bound.
+type CacheStats struct {
+	Hits          uint64
+	Misses        uint64
+	Revalidations uint64
+	Evictions     uint64
+	Size          int
+}
+
+// nearCache is a size-bounded LRU of Get results. Entries past their TTL are
+// kept so their version can be revalidated with the server.
+//
+// generation counts invalidations. Get reads it before asking the server and
+// hands it to store or revalidated, which do nothing if a Set or Delete has
+// invalidated a key since: the answer may predate that write.
+type nearCache struct {
+	mu         sync.Mutex
+	size       int
+	ttl        time.Duration
+	order      *list.List
+	items      map[string]*list.Element
+	now        func() time.Time
+	generation uint64
+
+	hits, misses, revalidations, evictions uint64
+}
+
+type cacheEntry struct {
+	key     string
+	result  Result
+	expires time.Time
+}
+
+func newNearCache(size int, ttl time.Duration) *nearCache {
+	return &nearCache{
+		size:  size,
+		ttl:   ttl,
+		order: list.New(),
+		items: make(map[string]*list.Element, size),
+		now:   time.Now,
+	}
+}
+
+// lookup returns the cached result for key and whether it is still fresh. A
+// fresh result counts as a hit; anything else is settled by revalidated or
+// store once the server has answered.
+func (c *nearCache) lookup(key string) (result Result, fresh, ok bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.items[key]
+	if !ok {
+		return Result{}, false, false
+	}
+	entry := el.Value.(*cacheEntry)
+	if c.now().Before(entry.expires) {
+		c.order.MoveToFront(el)
+		c.hits++
+		return entry.result, true, true
+	}
+	return entry.result, false, true
+}
+
+// current returns the generation to pass to store or revalidated.
+func (c *nearCache) current() uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.generation
+}
+
+func (c *nearCache) revalidated(key string, generation uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.revalidations++
+	if generation != c.generation {
+		return
+	}
+	if el, ok := c.items[key]; ok {
+		el.Value.(*cacheEntry).expires = c.now().Add(c.ttl)
+		c.order.MoveToFront(el)
+	}
+}
+
+func (c *nearCache) store(key string, result Result, generation uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.misses++
+	if generation != c.generation {
+		return
+	}
+	entry := &cacheEntry{key: key, result: result, expires: c.now().Add(c.ttl)}
+	if el, ok := c.items[key]; ok {
+		el.Value = entry
+		c.order.MoveToFront(el)
+		return
+	}
+
+	c.items[key] = c.order.PushFront(entry)
+	for c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.items, oldest.Value.(*cacheEntry).key)
+		c.evictions++
+	}
+}
+
+func (c *nearCache) invalidate(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.generation++
+	if el, ok := c.items[key]; ok {
+		c.order.Remove(el)
+		delete(c.items, key)
+	}
+}
+
+func (c *nearCache) stats() CacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return CacheStats{
+		Hits:          c.hits,
+		Misses:        c.misses,
+		Revalidations: c.revalidations,
+		Evictions:     c.evictions,
+		Size:          c.order.Len(),
+	}
+}
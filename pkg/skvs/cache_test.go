@@ -0,0 +1,185 @@
+package skvs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestNearCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	c := newNearCache(2, time.Minute)
+
+	c.store("a", Result{Value: "1", Found: true, Version: 1}, c.current())
+	c.store("b", Result{Value: "2", Found: true, Version: 2}, c.current())
+	c.lookup("a")
+	c.store("c", Result{Value: "3", Found: true, Version: 3}, c.current())
+
+	if _, _, ok := c.lookup("b"); ok {
+		t.Errorf("b was least recently used and should have been evicted")
+	}
+	for _, key := range []string{"a", "c"} {
+		if _, fresh, _ := c.lookup(key); !fresh {
+			t.Errorf("%s should still be cached", key)
+		}
+	}
+
+	want := CacheStats{Hits: 3, Misses: 3, Evictions: 1, Size: 2}
+	if got := c.stats(); got != want {
+		t.Errorf("want stats %+v, got %+v", want, got)
+	}
+}
+
+func TestNearCacheExpiry(t *testing.T) {
+	now := time.Unix(0, 0)
+	c := newNearCache(4, time.Second)
+	c.now = func() time.Time { return now }
+
+	c.store("a", Result{Value: "1", Found: true, Version: 7}, c.current())
+
+	now = now.Add(2 * time.Second)
+	got, fresh, ok := c.lookup("a")
+	if !ok || fresh {
+		t.Fatalf("want expired entry kept for revalidation, got fresh=%v ok=%v", fresh, ok)
+	}
+	if got.Version != 7 {
+		t.Errorf("want cached version 7, got %d", got.Version)
+	}
+
+	c.revalidated("a", c.current())
+	if _, fresh, _ := c.lookup("a"); !fresh {
+		t.Errorf("revalidation should restart the ttl")
+	}
+
+	c.invalidate("a")
+	if _, _, ok := c.lookup("a"); ok {
+		t.Errorf("invalidated entry should be gone")
+	}
+}
+
+func TestClientNearCacheOverUDP(t *testing.T) {
+	addr := startTestServer(t)
+	ctx := context.Background()
+
+	c, err := New(addr, testKey, WithTimeout(2*time.Second), WithPoolSize(1), WithNearCache(16, time.Hour))
+	if err != nil {
+		t.Fatalf("new: %v", err)
+	}
+	defer func() { _ = c.Close() }()
+
+	other, err := New(addr, testKey, WithTimeout(2*time.Second), WithPoolSize(1))
+	if err != nil {
+		t.Fatalf("new: %v", err)
+	}
+	defer func() { _ = other.Close() }()
+
+	if _, err := c.Set(ctx, "cat", "jack", false, false); err != nil {
+		t.Fatalf("set: %v", err)
+	}
+
+	for range 3 {
+		got, err := c.Get(ctx, "cat")
+		if err != nil || got.Value != "jack" {
+			t.Fatalf("get: want jack, got %+v, %v", got, err)
+		}
+	}
+	if stats := c.CacheStats(); stats.Hits != 2 || stats.Misses != 1 {
+		t.Errorf("want 2 hits and 1 miss, got %+v", stats)
+	}
+
+	// Expire the entry: an unchanged key is revalidated, a changed one is
+	// fetched again.
+	c.cache.now = func() time.Time { return time.Now().Add(2 * time.Hour) }
+	got, err := c.Get(ctx, "cat")
+	if err != nil || got.Value != "jack" || got.NotModified {
+		t.Fatalf("revalidate: want jack, got %+v, %v", got, err)
+	}
+	if stats := c.CacheStats(); stats.Revalidations != 1 {
+		t.Errorf("want 1 revalidation, got %+v", stats)
+	}
+
+	if _, err := other.Set(ctx, "cat", "jackson", true, false); err != nil {
+		t.Fatalf("other set: %v", err)
+	}
+	c.cache.now = func() time.Time { return time.Now().Add(4 * time.Hour) }
+	if got, err := c.Get(ctx, "cat"); err != nil || got.Value != "jackson" {
+		t.Errorf("changed key: want jackson, got %+v, %v", got, err)
+	}
+
+	if _, err := c.Delete(ctx, "cat"); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	if _, err := c.Get(ctx, "cat"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("get after local delete: want ErrNotFound, got %v", err)
+	}
+}
+
+// staleGetTransport answers the first get with the value it held when the
+// get arrived, but only once release is closed, as a slow network would.
+type staleGetTransport struct {
+	mu      sync.Mutex
+	value   string
+	version uint64
+	gets    int
+	arrived chan struct{}
+	release chan struct{}
+}
+
+func (t *staleGetTransport) RoundTrip(ctx context.Context, req Request) (Result, error) {
+	t.mu.Lock()
+	switch req.Command {
+	case "set":
+		t.version++
+		t.value = req.Value
+		result := Result{Value: t.value, Found: true, Version: t.version}
+		t.mu.Unlock()
+		return result, nil
+	case "get":
+		t.gets++
+		result := Result{Value: t.value, Found: true, Version: t.version}
+		first := t.gets == 1
+		t.mu.Unlock()
+		if first {
+			close(t.arrived)
+			<-t.release
+		}
+		return result, nil
+	}
+	t.mu.Unlock()
+	return Result{}, fmt.Errorf("unexpected %s", req.Command)
+}
+
+func (t *staleGetTransport) Close() error { return nil }
+
+func TestNearCacheGetRacingSet(t *testing.T) {
+	transport := &staleGetTransport{value: "jack", version: 1, arrived: make(chan struct{}), release: make(chan struct{})}
+	c, err := New("", nil, WithTransport(transport), WithNearCache(16, time.Hour))
+	if err != nil {
+		t.Fatalf("new: %v", err)
+	}
+	ctx := context.Background()
+
+	stale := make(chan Result)
+	go func() {
+		result, _ := c.Get(ctx, "cat")
+		stale <- result
+	}()
+	<-transport.arrived
+	if _, err := c.Set(ctx, "cat", "jackson", true, false); err != nil {
+		t.Fatalf("set: %v", err)
+	}
+	close(transport.release)
+	if got := <-stale; got.Value != "jack" {
+		t.Fatalf("want the racing get to see jack, got %+v", got)
+	}
+
+	got, err := c.Get(ctx, "cat")
+	if err != nil || got.Value != "jackson" {
+		t.Errorf("want the set value after the set returned, got %+v, %v", got, err)
+	}
+	if stats := c.CacheStats(); stats.Hits != 0 {
+		t.Errorf("want the answer that predates the set left uncached, got %+v", stats)
+	}
+}
@@ -0,0 +1,81 @@
+package skvs
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+
+	"github.com/thesimpledev/skvs/internal/client"
+	"github.com/thesimpledev/skvs/internal/protocol"
+	store "github.com/thesimpledev/skvs/internal/skvs"
+)
+
+// NewEmbedded returns a Client backed by a store in this process instead of
+// a server. Requests go through the same frame encoding and command handling
+// as on the server, so results and errors match a client from New and code
+// can switch between the two by changing the constructor. Network options
+// such as retries and pool size have no effect; WithNearCache still applies.
+func NewEmbedded(opts ...Option) *Client {
+	o := defaultOptions()
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	c := &Client{
+		transport: &embeddedTransport{app: store.New(slog.New(slog.DiscardHandler))},
+		timeout:   o.timeout,
+	}
+	if o.cacheSize > 0 {
+		c.cache = newNearCache(o.cacheSize, o.cacheTTL)
+	}
+	return c
+}
+
+type embeddedTransport struct {
+	app *store.App
+
+	mu     sync.RWMutex
+	closed bool
+}
+
+func (t *embeddedTransport) RoundTrip(ctx context.Context, req Request) (Result, error) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	if t.closed {
+		return Result{}, ErrClosed
+	}
+	if err := ctx.Err(); err != nil {
+		return Result{}, err
+	}
+
+	dto, err := protocol.NewFrameDTO(req.Command, req.Key, req.Value, req.Overwrite, req.Old)
+	if err != nil {
+		return Result{}, err
+	}
+	dto.IfVersion = req.IfVersion
+
+	request, response := protocol.GetBuffer(), protocol.GetBuffer()
+	defer protocol.PutBuffer(request)
+	defer protocol.PutBuffer(response)
+
+	*request = protocol.AppendFrame(*request, dto)
+	frame, err := store.ProcessMessageTo(*response, t.app, *request)
+	if err != nil {
+		return Result{}, err
+	}
+	*response = frame
+	responseDTO, err := protocol.FrameToResponseDTO(frame)
+	if err != nil {
+		return Result{}, err
+	}
+
+	result, err := client.NewResult(dto, responseDTO)
+	return Result(result), err
+}
+
+func (t *embeddedTransport) Close() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.closed = true
+	return nil
+}
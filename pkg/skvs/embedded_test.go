@@ -0,0 +1,78 @@
+package skvs
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// TestEmbeddedMatchesUDP runs the same operations against an embedded client
+// and one talking to a server and expects identical results and errors.
+func TestEmbeddedMatchesUDP(t *testing.T) {
+	remote, err := New(startTestServer(t), testKey, WithTimeout(2*time.Second))
+	if err != nil {
+		t.Fatalf("new: %v", err)
+	}
+	defer func() { _ = remote.Close() }()
+	embedded := NewEmbedded()
+	defer func() { _ = embedded.Close() }()
+
+	tests := []struct {
+		name string
+		op   func(c *Client) (Result, error)
+	}{
+		{name: "set", op: func(c *Client) (Result, error) { return c.Set(context.Background(), "cat", "jack", false, false) }},
+		{name: "set existing", op: func(c *Client) (Result, error) { return c.Set(context.Background(), "cat", "tom", false, false) }},
+		{name: "overwrite old", op: func(c *Client) (Result, error) { return c.Set(context.Background(), "cat", "tom", true, true) }},
+		{name: "get", op: func(c *Client) (Result, error) { return c.Get(context.Background(), "cat") }},
+		{name: "get missing", op: func(c *Client) (Result, error) { return c.Get(context.Background(), "dog") }},
+		{name: "delete", op: func(c *Client) (Result, error) { return c.Delete(context.Background(), "cat") }},
+		{name: "delete missing", op: func(c *Client) (Result, error) { return c.Delete(context.Background(), "cat") }},
+		{name: "empty key", op: func(c *Client) (Result, error) { return c.Set(context.Background(), "", "v", false, false) }},
+	}
+
+	for _, tt := range tests {
+		want, wantErr := tt.op(remote)
+		got, err := tt.op(embedded)
+		if got != want {
+			t.Errorf("%s: udp returned %+v, embedded %+v", tt.name, want, got)
+		}
+		if (wantErr == nil) != (err == nil) || (wantErr != nil && wantErr.Error() != err.Error()) {
+			t.Errorf("%s: udp error %v, embedded error %v", tt.name, wantErr, err)
+		}
+	}
+
+	for _, c := range []*Client{remote, embedded} {
+		if ok, err := c.Exists(context.Background(), "cat"); ok || err != nil {
+			t.Errorf("exists after delete: want false, nil got %v, %v", ok, err)
+		}
+	}
+}
+
+func TestEmbeddedNearCache(t *testing.T) {
+	c := NewEmbedded(WithNearCache(8, time.Nanosecond))
+	defer func() { _ = c.Close() }()
+	ctx := context.Background()
+
+	if _, err := c.Set(ctx, "cat", "jack", false, false); err != nil {
+		t.Fatalf("set: %v", err)
+	}
+	for range 2 {
+		if got, err := c.Get(ctx, "cat"); err != nil || got.Value != "jack" {
+			t.Fatalf("get: want jack, got %+v, %v", got, err)
+		}
+	}
+	if stats := c.CacheStats(); stats.Revalidations != 1 {
+		t.Errorf("want the second get revalidated, got %+v", stats)
+	}
+}
+
+func TestEmbeddedClosed(t *testing.T) {
+	c := NewEmbedded()
+	_ = c.Close()
+
+	if _, err := c.Get(context.Background(), "k"); !errors.Is(err, ErrClosed) {
+		t.Errorf("want ErrClosed, got %v", err)
+	}
+}
@@ -0,0 +1,18 @@
+package skvs
+
+import (
+	"github.com/thesimpledev/skvs/internal/encryption"
+)
+
+// ReadKeyFile reads a key file holding the key as hex or base64, such as one
+// written by "client_cli keygen -o file".
+func ReadKeyFile(path string) ([]byte, error) {
+	return encryption.ReadKeyFile(path)
+}
+
+// DeriveKey derives the key from a passphrase and the KDF parameters the
+// server was set up with, as printed by "client_cli keygen --kdf argon2id".
+// It is deliberately slow; derive once and reuse the key.
+func DeriveKey(passphrase, kdf string) ([]byte, error) {
+	return encryption.KeySource{Passphrase: passphrase, KDF: kdf}.Load()
+}
@@ -0,0 +1,119 @@
+package skvs
+
+import (
+	"time"
+
+	"github.com/thesimpledev/skvs/internal/client"
+	"github.com/thesimpledev/skvs/internal/protocol"
+)
+
+const defaultPoolSize = 4
+
+// RetryPolicy, RetryBudget and Attempt configure and observe retries; see
+// WithRetryPolicy.
+type (
+	RetryPolicy = client.RetryPolicy
+	RetryBudget = client.RetryBudget
+	Attempt     = client.Attempt
+)
+
+func DefaultRetryPolicy() RetryPolicy {
+	return client.DefaultRetryPolicy()
+}
+
+// NewRetryBudget returns a budget that can be shared by several clients.
+func NewRetryBudget(maxTokens, ratio float64) *RetryBudget {
+	return client.NewRetryBudget(maxTokens, ratio)
+}
+
+type options struct {
+	timeout   time.Duration
+	retry     RetryPolicy
+	poolSize  int
+	transport Transport
+	cacheSize int
+	cacheTTL  time.Duration
+	suite     string
+	sessions  bool
+}
+
+func defaultOptions() options {
+	return options{
+		timeout:  protocol.Timeout,
+		retry:    DefaultRetryPolicy(),
+		poolSize: defaultPoolSize,
+	}
+}
+
+type Option func(*options)
+
+// WithTimeout sets the deadline applied to calls whose context has none.
+func WithTimeout(d time.Duration) Option {
+	return func(o *options) {
+		if d > 0 {
+			o.timeout = d
+		}
+	}
+}
+
+// WithRetries sets how many times a request is sent before giving up.
+func WithRetries(attempts int) Option {
+	return func(o *options) {
+		o.retry.MaxAttempts = max(attempts, 1)
+	}
+}
+
+// WithRetryPolicy replaces the whole retry policy: backoff, per-attempt
+// timeout, retry budget and the OnAttempt hook.
+func WithRetryPolicy(p RetryPolicy) Option {
+	return func(o *options) {
+		o.retry = p
+	}
+}
+
+// WithPoolSize sets how many sockets the client keeps open. Each socket
+// carries one request at a time, so this bounds concurrent requests.
+func WithPoolSize(n int) Option {
+	return func(o *options) {
+		o.poolSize = max(n, 1)
+	}
+}
+
+// WithTransport replaces the UDP transport, for example with an in-memory
+// one in tests. The address and key passed to New are ignored.
+func WithTransport(t Transport) Option {
+	return func(o *options) {
+		o.transport = t
+	}
+}
+
+// WithNearCache keeps up to size recently read values in process. Within ttl
+// a cached value is returned without contacting the server; after that the
+// next Get asks the server whether the version changed and only transfers
+// the value if it did. Set and Delete through this client drop the key.
+// Writes made by other clients can be missed for at most ttl.
+func WithNearCache(size int, ttl time.Duration) Option {
+	return func(o *options) {
+		o.cacheSize = size
+		o.cacheTTL = ttl
+	}
+}
+
+// WithCipherSuite seals requests with the named suite instead of the default
+// "aes-256-gcm": "chacha20-poly1305" or "xchacha20-poly1305", which are faster
+// on CPUs without AES instructions. The server must accept the suite.
+func WithCipherSuite(name string) Option {
+	return func(o *options) {
+		o.suite = name
+	}
+}
+
+// WithSessions makes each socket run a handshake with the server and seal
+// requests with a per-session key instead of the shared key, so recorded
+// traffic stays private even if the shared key later leaks. Each socket
+// rekeys before its session expires.
+func WithSessions() Option {
+	return func(o *options) {
+		o.sessions = true
+	}
+}
@@ -0,0 +1,179 @@
+// Package skvs is the public Go client for the Simple Key Value Store.
+package skvs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/thesimpledev/skvs/internal/client"
+	"github.com/thesimpledev/skvs/internal/protocol"
+)
+
+// Errors returned by the client. Server-side failures match ErrServer as
+// well as the more specific sentinel for their status code.
+var (
+	ErrNotFound        = client.ErrNotFound
+	ErrServer          = client.ErrServer
+	ErrWrongType       = client.ErrWrongType
+	ErrValueTooLarge   = client.ErrValueTooLarge
+	ErrKeyExists       = client.ErrKeyExists
+	ErrAuthFailure     = client.ErrAuthFailure
+	ErrRateLimited     = client.ErrRateLimited
+	ErrOutOfMemory     = client.ErrOutOfMemory
+	ErrVersionMismatch = client.ErrVersionMismatch
+	ErrUnknownCommand  = client.ErrUnknownCommand
+	ErrInvalidRequest  = client.ErrInvalidRequest
+	ErrBusy            = client.ErrBusy
+	ErrSessionExpired  = client.ErrSessionExpired
+	ErrSuiteRefused    = client.ErrSuiteRefused
+)
+
+// Result is the typed outcome of an operation. Previous holds the replaced
+// or removed value for Set with old and Delete. Version is the key's version
+// after the operation. NotModified is only set by transports, for a get whose
+// IfVersion still matched; Get never returns it.
+type Result struct {
+	Value       string
+	Found       bool
+	Previous    string
+	Version     uint64
+	NotModified bool
+}
+
+// Store is implemented by *Client and by the fakes in skvstest, so code can
+// depend on the interface and swap in a fake for unit tests.
+type Store interface {
+	Set(ctx context.Context, key, value string, overwrite, old bool) (Result, error)
+	Get(ctx context.Context, key string) (Result, error)
+	Delete(ctx context.Context, key string) (Result, error)
+	Exists(ctx context.Context, key string) (bool, error)
+	Close() error
+}
+
+var _ Store = (*Client)(nil)
+
+type Client struct {
+	transport Transport
+	timeout   time.Duration
+	cache     *nearCache
+}
+
+// New connects to the server at addr using the 32-byte encryption key.
+func New(addr string, key []byte, opts ...Option) (*Client, error) {
+	o := defaultOptions()
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	transport := o.transport
+	if transport == nil {
+		t, err := newUDPTransport(addr, key, o)
+		if err != nil {
+			return nil, fmt.Errorf("create client: %w", err)
+		}
+		transport = t
+	}
+
+	c := &Client{transport: transport, timeout: o.timeout}
+	if o.cacheSize > 0 {
+		c.cache = newNearCache(o.cacheSize, o.cacheTTL)
+	}
+	return c, nil
+}
+
+func (c *Client) Set(ctx context.Context, key, value string, overwrite, old bool) (Result, error) {
+	defer c.invalidate(key)
+	return c.do(ctx, Request{Command: "set", Key: key, Value: value, Overwrite: overwrite, Old: old})
+}
+
+// Get returns ErrNotFound when the key does not exist. With a near cache,
+// fresh entries are answered locally and expired ones are revalidated by
+// version, so an unchanged value is not sent again.
+func (c *Client) Get(ctx context.Context, key string) (Result, error) {
+	if c.cache == nil {
+		return c.do(ctx, Request{Command: "get", Key: key})
+	}
+
+	cached, fresh, ok := c.cache.lookup(key)
+	if fresh {
+		return cached, nil
+	}
+
+	generation := c.cache.current()
+	req := Request{Command: "get", Key: key}
+	if ok {
+		req.IfVersion = cached.Version
+	}
+
+	result, err := c.do(ctx, req)
+	switch {
+	case errors.Is(err, ErrNotFound):
+		c.cache.invalidate(key)
+		return result, err
+	case err != nil:
+		return result, err
+	case result.NotModified:
+		c.cache.revalidated(key, generation)
+		return cached, nil
+	}
+
+	c.cache.store(key, result, generation)
+	return result, nil
+}
+
+// Delete returns ErrNotFound when the key does not exist.
+func (c *Client) Delete(ctx context.Context, key string) (Result, error) {
+	defer c.invalidate(key)
+	return c.do(ctx, Request{Command: "delete", Key: key})
+}
+
+func (c *Client) Exists(ctx context.Context, key string) (bool, error) {
+	result, err := c.do(ctx, Request{Command: "exists", Key: key})
+	if err != nil {
+		return false, err
+	}
+	return result.Value == "1", nil
+}
+
+// Info returns the server's INFO report as name:value lines.
+func (c *Client) Info(ctx context.Context) (string, error) {
+	result, err := c.do(ctx, Request{Command: "info"})
+	if err != nil {
+		return "", err
+	}
+	return result.Value, nil
+}
+
+// CacheStats reports near cache activity; it is zero without WithNearCache.
+func (c *Client) CacheStats() CacheStats {
+	if c.cache == nil {
+		return CacheStats{}
+	}
+	return c.cache.stats()
+}
+
+func (c *Client) Close() error {
+	return c.transport.Close()
+}
+
+func (c *Client) invalidate(key string) {
+	if c.cache != nil {
+		c.cache.invalidate(key)
+	}
+}
+
+func (c *Client) do(ctx context.Context, req Request) (Result, error) {
+	if _, err := protocol.NewFrameDTO(req.Command, req.Key, req.Value, req.Overwrite, req.Old); err != nil {
+		return Result{}, fmt.Errorf("%s failed for key %q: %w", req.Command, req.Key, err)
+	}
+
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.timeout)
+		defer cancel()
+	}
+
+	return c.transport.RoundTrip(ctx, req)
+}
@@ -0,0 +1,357 @@
+package skvs
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/thesimpledev/skvs/internal/config"
+	"github.com/thesimpledev/skvs/internal/encryption"
+	"github.com/thesimpledev/skvs/internal/server"
+)
+
+var testKey = []byte("12345678901234567890123456789012")
+
+// startTestServer runs the real server on a free loopback port until the
+// test ends and returns its address. configure, if given, adjusts the
+// configuration first.
+func startTestServer(t *testing.T, configure ...func(*config.Config)) string {
+	t.Helper()
+
+	cfg := config.Default()
+	cfg.Addr = "127.0.0.1:0"
+	cfg.MetricsAddr = ""
+	cfg.EncryptionKey = string(testKey)
+	cfg.ReadTimeout = config.Duration(10 * time.Millisecond)
+	for _, f := range configure {
+		f(&cfg)
+	}
+
+	s, err := server.New(cfg, server.WithLogOutput(io.Discard))
+	if err != nil {
+		t.Fatalf("new server: %v", err)
+	}
+	if err := s.Start(); err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	t.Cleanup(func() { _ = s.Shutdown(context.Background()) })
+	return s.Addr().String()
+}
+
+type stubTransport struct {
+	mu       sync.Mutex
+	requests []Request
+	deadline bool
+	result   Result
+	err      error
+}
+
+func (s *stubTransport) RoundTrip(ctx context.Context, req Request) (Result, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requests = append(s.requests, req)
+	_, s.deadline = ctx.Deadline()
+	return s.result, s.err
+}
+
+func (s *stubTransport) Close() error {
+	return nil
+}
+
+func TestClientBuildsRequests(t *testing.T) {
+	stub := &stubTransport{result: Result{Value: "1", Found: true}}
+	c, err := New("", nil, WithTransport(stub))
+	if err != nil {
+		t.Fatalf("new: %v", err)
+	}
+	ctx := context.Background()
+
+	_, _ = c.Set(ctx, "k", "v", true, true)
+	_, _ = c.Get(ctx, "k")
+	_, _ = c.Delete(ctx, "k")
+	ok, _ := c.Exists(ctx, "k")
+	_, _ = c.Info(ctx)
+
+	want := []Request{
+		{Command: "set", Key: "k", Value: "v", Overwrite: true, Old: true},
+		{Command: "get", Key: "k"},
+		{Command: "delete", Key: "k"},
+		{Command: "exists", Key: "k"},
+		{Command: "info"},
+	}
+	if len(stub.requests) != len(want) {
+		t.Fatalf("want %d requests, got %d", len(want), len(stub.requests))
+	}
+	for i := range want {
+		if stub.requests[i] != want[i] {
+			t.Errorf("request %d: want %+v, got %+v", i, want[i], stub.requests[i])
+		}
+	}
+	if !ok {
+		t.Errorf("exists: want true for value \"1\"")
+	}
+	if !stub.deadline {
+		t.Errorf("client should apply its default timeout when ctx has no deadline")
+	}
+}
+
+func TestClientValidatesBeforeSending(t *testing.T) {
+	stub := &stubTransport{}
+	c, _ := New("", nil, WithTransport(stub))
+
+	if _, err := c.Get(context.Background(), ""); err == nil {
+		t.Errorf("want error for empty key")
+	}
+	if _, err := c.Set(context.Background(), "k", "", false, false); err == nil {
+		t.Errorf("want error for empty value")
+	}
+	if len(stub.requests) != 0 {
+		t.Errorf("invalid requests should not reach the transport")
+	}
+}
+
+func TestNewRejectsBadKey(t *testing.T) {
+	if _, err := New("127.0.0.1:1", []byte("short")); err == nil {
+		t.Errorf("want error for short encryption key")
+	}
+}
+
+func TestKeyHelpers(t *testing.T) {
+	key := encryption.GenerateKey()
+	file := filepath.Join(t.TempDir(), "skvs.key")
+	if err := os.WriteFile(file, []byte(hex.EncodeToString(key)), 0o600); err != nil {
+		t.Fatalf("write key file: %v", err)
+	}
+	if got, err := ReadKeyFile(file); err != nil || !bytes.Equal(got, key) {
+		t.Errorf("read key file: want %x, got %x, %v", key, got, err)
+	}
+
+	kdf := "$scrypt$ln=10,r=8,p=1$c2FsdHNhbHRzYWx0c2FsdA"
+	first, err := DeriveKey("hunter2", kdf)
+	if err != nil {
+		t.Fatalf("derive: %v", err)
+	}
+	if again, _ := DeriveKey("hunter2", kdf); !bytes.Equal(first, again) || len(first) != 32 {
+		t.Error("want the same 32-byte key from the same passphrase")
+	}
+	if _, err := DeriveKey("hunter2", ""); err == nil {
+		t.Error("want an error without KDF parameters")
+	}
+}
+
+func TestClientOverUDP(t *testing.T) {
+	addr := startTestServer(t)
+	c, err := New(addr, testKey, WithTimeout(2*time.Second), WithPoolSize(2))
+	if err != nil {
+		t.Fatalf("new: %v", err)
+	}
+	defer func() { _ = c.Close() }()
+	ctx := context.Background()
+
+	set, err := c.Set(ctx, "cat", "jack", false, false)
+	if err != nil {
+		t.Fatalf("set: %v", err)
+	}
+	if set.Value != "jack" || set.Version == 0 {
+		t.Errorf("set: unexpected result %+v", set)
+	}
+
+	got, err := c.Get(ctx, "cat")
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	if got != (Result{Value: "jack", Found: true, Version: set.Version}) {
+		t.Errorf("get: unexpected result %+v", got)
+	}
+
+	if _, err := c.Get(ctx, "dog"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("get missing: want ErrNotFound, got %v", err)
+	}
+
+	deleted, err := c.Delete(ctx, "cat")
+	if err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	if deleted.Previous != "jack" {
+		t.Errorf("delete: want previous %q, got %q", "jack", deleted.Previous)
+	}
+
+	if ok, err := c.Exists(ctx, "cat"); ok || err != nil {
+		t.Errorf("exists after delete: want false, nil got %v, %v", ok, err)
+	}
+}
+
+func TestClientCipherSuites(t *testing.T) {
+	addr := startTestServer(t)
+
+	for _, suite := range []string{"aes-256-gcm", "chacha20-poly1305", "xchacha20-poly1305"} {
+		t.Run(suite, func(t *testing.T) {
+			c, err := New(addr, testKey, WithTimeout(2*time.Second), WithCipherSuite(suite))
+			if err != nil {
+				t.Fatalf("new: %v", err)
+			}
+			defer func() { _ = c.Close() }()
+
+			if _, err := c.Set(context.Background(), suite, "jack", true, false); err != nil {
+				t.Fatalf("set: %v", err)
+			}
+			got, err := c.Get(context.Background(), suite)
+			if err != nil || got.Value != "jack" {
+				t.Errorf("get: want jack, got %+v, %v", got, err)
+			}
+		})
+	}
+
+	if _, err := New(addr, testKey, WithCipherSuite("rot13")); err == nil {
+		t.Error("want an unknown suite refused")
+	}
+}
+
+func TestClientConcurrentUDP(t *testing.T) {
+	addr := startTestServer(t)
+	c, err := New(addr, testKey, WithTimeout(2*time.Second), WithPoolSize(4))
+	if err != nil {
+		t.Fatalf("new: %v", err)
+	}
+	defer func() { _ = c.Close() }()
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 32)
+	for i := range 32 {
+		wg.Go(func() {
+			key := fmt.Sprintf("key-%d", i)
+			if _, err := c.Set(context.Background(), key, key, false, false); err != nil {
+				errs <- err
+				return
+			}
+			got, err := c.Get(context.Background(), key)
+			if err != nil {
+				errs <- err
+				return
+			}
+			if got.Value != key {
+				errs <- fmt.Errorf("get %s: got value %q", key, got.Value)
+			}
+		})
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		t.Error(err)
+	}
+
+	if stats := c.transport.(*udpTransport).pool.Stats(); stats.Idle != 4 || stats.InFlight != 0 {
+		t.Errorf("want all 4 sockets back in the pool, got %+v", stats)
+	}
+}
+
+func TestClosedClient(t *testing.T) {
+	addr := startTestServer(t)
+	c, err := New(addr, testKey, WithPoolSize(1))
+	if err != nil {
+		t.Fatalf("new: %v", err)
+	}
+	_ = c.Close()
+
+	if _, err := c.Get(context.Background(), "k"); !errors.Is(err, ErrClosed) {
+		t.Errorf("want ErrClosed, got %v", err)
+	}
+}
+
+func TestClientServerLimits(t *testing.T) {
+	tests := []struct {
+		name      string
+		configure func(*config.Config)
+		opts      []Option
+		keys      []string
+		wantErr   error
+	}{
+		{
+			name:      "session required",
+			configure: func(cfg *config.Config) { cfg.RequireSession = true },
+			keys:      []string{"cat"},
+			wantErr:   ErrAuthFailure,
+		},
+		{
+			name:      "session",
+			configure: func(cfg *config.Config) { cfg.RequireSession = true },
+			opts:      []Option{WithSessions()},
+			keys:      []string{"cat", "dog"},
+		},
+		{
+			name:      "rate limited",
+			configure: func(cfg *config.Config) { cfg.RateLimit, cfg.RateBurst = 0.001, 1 },
+			keys:      []string{"cat", "dog"},
+			wantErr:   ErrRateLimited,
+		},
+		{
+			name:      "tenant quota",
+			configure: func(cfg *config.Config) { cfg.TenantMaxKeys = 1 },
+			keys:      []string{"acme:cat", "acme:dog"},
+			wantErr:   ErrOutOfMemory,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := append([]Option{WithTimeout(2 * time.Second), WithRetries(2)}, tt.opts...)
+			c, err := New(startTestServer(t, tt.configure), testKey, opts...)
+			if err != nil {
+				t.Fatalf("new: %v", err)
+			}
+			defer func() { _ = c.Close() }()
+
+			var lastErr error
+			for _, key := range tt.keys {
+				if _, lastErr = c.Set(context.Background(), key, "v", false, false); lastErr != nil {
+					break
+				}
+			}
+			if !errors.Is(lastErr, tt.wantErr) {
+				t.Errorf("want %v, got %v", tt.wantErr, lastErr)
+			}
+		})
+	}
+}
+
+func TestClientBusyServer(t *testing.T) {
+	addr := startTestServer(t, func(cfg *config.Config) {
+		cfg.MaxConcurrency = 1
+		cfg.Workers = 1
+	})
+	c, err := New(addr, testKey, WithTimeout(5*time.Second), WithPoolSize(32), WithRetries(1))
+	if err != nil {
+		t.Fatalf("new: %v", err)
+	}
+	defer func() { _ = c.Close() }()
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	served := 0
+	for i := range 64 {
+		wg.Go(func() {
+			_, err := c.Set(context.Background(), fmt.Sprint(i), "v", true, false)
+			if err != nil && !errors.Is(err, ErrBusy) {
+				t.Errorf("want success or ErrBusy, got %v", err)
+			}
+			if err == nil {
+				mu.Lock()
+				served++
+				mu.Unlock()
+			}
+		})
+	}
+	wg.Wait()
+	if served == 0 {
+		t.Error("want the requests that got in answered")
+	}
+}
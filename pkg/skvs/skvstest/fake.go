@@ -0,0 +1,145 @@
+// Package skvstest provides an in-memory fake of the skvs client for unit
+// tests that should not need a running server.
+package skvstest
+
+import (
+	"context"
+	"sync"
+
+	"github.com/thesimpledev/skvs/pkg/skvs"
+)
+
+var _ skvs.Store = (*Fake)(nil)
+
+// Call records one method invocation on a Fake.
+type Call struct {
+	Method string
+	Key    string
+	Value  string
+}
+
+type entry struct {
+	value   string
+	version uint64
+}
+
+// Fake is a goroutine-safe, in-memory skvs.Store that follows the same
+// set/overwrite/old rules as the server. Set Err to make every call fail.
+type Fake struct {
+	mu      sync.Mutex
+	data    map[string]entry
+	version uint64
+	calls   []Call
+	closed  bool
+
+	Err error
+}
+
+func NewFake() *Fake {
+	return &Fake{data: make(map[string]entry)}
+}
+
+func (f *Fake) Set(_ context.Context, key, value string, overwrite, old bool) (skvs.Result, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.record("Set", key, value)
+	if err := f.check(); err != nil {
+		return skvs.Result{}, err
+	}
+
+	current, exists := f.data[key]
+	returnValue := current.value
+	if !exists || overwrite {
+		if !old {
+			returnValue = value
+		}
+		f.version++
+		current = entry{value: value, version: f.version}
+		f.data[key] = current
+	}
+
+	result := skvs.Result{Value: returnValue, Found: true, Version: current.version}
+	if old {
+		result.Previous = returnValue
+	}
+	return result, nil
+}
+
+func (f *Fake) Get(_ context.Context, key string) (skvs.Result, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.record("Get", key, "")
+	if err := f.check(); err != nil {
+		return skvs.Result{}, err
+	}
+
+	current, exists := f.data[key]
+	if !exists {
+		return skvs.Result{}, skvs.ErrNotFound
+	}
+	return skvs.Result{Value: current.value, Found: true, Version: current.version}, nil
+}
+
+func (f *Fake) Delete(_ context.Context, key string) (skvs.Result, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.record("Delete", key, "")
+	if err := f.check(); err != nil {
+		return skvs.Result{}, err
+	}
+
+	current, exists := f.data[key]
+	if !exists {
+		return skvs.Result{}, skvs.ErrNotFound
+	}
+	delete(f.data, key)
+	return skvs.Result{Value: current.value, Found: true, Previous: current.value, Version: current.version}, nil
+}
+
+func (f *Fake) Exists(_ context.Context, key string) (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.record("Exists", key, "")
+	if err := f.check(); err != nil {
+		return false, err
+	}
+
+	_, exists := f.data[key]
+	return exists, nil
+}
+
+func (f *Fake) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.closed = true
+	return nil
+}
+
+// Calls returns every call made so far, in order.
+func (f *Fake) Calls() []Call {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]Call(nil), f.calls...)
+}
+
+// Data returns a copy of the stored keys and values.
+func (f *Fake) Data() map[string]string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	data := make(map[string]string, len(f.data))
+	for k, e := range f.data {
+		data[k] = e.value
+	}
+	return data
+}
+
+func (f *Fake) record(method, key, value string) {
+	f.calls = append(f.calls, Call{Method: method, Key: key, Value: value})
+}
+
+func (f *Fake) check() error {
+	if f.closed {
+		return skvs.ErrClosed
+	}
+	return f.Err
+}
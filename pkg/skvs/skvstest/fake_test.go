@@ -0,0 +1,104 @@
+package skvstest
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/thesimpledev/skvs/pkg/skvs"
+)
+
+func TestFakeSet(t *testing.T) {
+	tests := []struct {
+		name      string
+		initial   string
+		overwrite bool
+		old       bool
+		wantValue string
+		wantData  string
+	}{
+		{name: "new key", wantValue: "bar", wantData: "bar"},
+		{name: "overwrite returns new", initial: "initial", overwrite: true, wantValue: "bar", wantData: "bar"},
+		{name: "overwrite returns old", initial: "initial", overwrite: true, old: true, wantValue: "initial", wantData: "bar"},
+		{name: "no overwrite keeps old", initial: "initial", old: true, wantValue: "initial", wantData: "initial"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			f := NewFake()
+			if tt.initial != "" {
+				_, _ = f.Set(ctx, "foo", tt.initial, false, false)
+			}
+
+			got, err := f.Set(ctx, "foo", "bar", tt.overwrite, tt.old)
+			if err != nil {
+				t.Fatalf("set: %v", err)
+			}
+			if got.Value != tt.wantValue {
+				t.Errorf("set value: want %q, got %q", tt.wantValue, got.Value)
+			}
+			if data := f.Data()["foo"]; data != tt.wantData {
+				t.Errorf("stored value: want %q, got %q", tt.wantData, data)
+			}
+		})
+	}
+}
+
+func TestFakeNotFound(t *testing.T) {
+	ctx := context.Background()
+	f := NewFake()
+
+	if _, err := f.Get(ctx, "missing"); !errors.Is(err, skvs.ErrNotFound) {
+		t.Errorf("get: want ErrNotFound, got %v", err)
+	}
+	if _, err := f.Delete(ctx, "missing"); !errors.Is(err, skvs.ErrNotFound) {
+		t.Errorf("delete: want ErrNotFound, got %v", err)
+	}
+	if ok, err := f.Exists(ctx, "missing"); ok || err != nil {
+		t.Errorf("exists: want false, nil got %v, %v", ok, err)
+	}
+}
+
+func TestFakeDelete(t *testing.T) {
+	ctx := context.Background()
+	f := NewFake()
+	set, _ := f.Set(ctx, "cat", "jack", false, false)
+
+	got, err := f.Delete(ctx, "cat")
+	if err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+
+	want := skvs.Result{Value: "jack", Found: true, Previous: "jack", Version: set.Version}
+	if got != want {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+	if ok, _ := f.Exists(ctx, "cat"); ok {
+		t.Errorf("key should be gone after delete")
+	}
+}
+
+func TestFakeErrAndCalls(t *testing.T) {
+	ctx := context.Background()
+	f := NewFake()
+	boom := errors.New("boom")
+
+	_, _ = f.Set(ctx, "a", "1", false, false)
+	f.Err = boom
+	if _, err := f.Get(ctx, "a"); !errors.Is(err, boom) {
+		t.Errorf("want injected error, got %v", err)
+	}
+
+	want := []Call{{Method: "Set", Key: "a", Value: "1"}, {Method: "Get", Key: "a"}}
+	if got := f.Calls(); !reflect.DeepEqual(got, want) {
+		t.Errorf("calls: want %+v, got %+v", want, got)
+	}
+
+	f.Err = nil
+	_ = f.Close()
+	if _, err := f.Get(ctx, "a"); !errors.Is(err, skvs.ErrClosed) {
+		t.Errorf("want ErrClosed after Close, got %v", err)
+	}
+}
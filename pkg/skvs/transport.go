@@ -0,0 +1,78 @@
+package skvs
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/thesimpledev/skvs/internal/client"
+	"github.com/thesimpledev/skvs/internal/encryption"
+	"github.com/thesimpledev/skvs/internal/protocol"
+)
+
+var ErrClosed = errors.New("skvs: client closed")
+
+// Request is a single operation as handed to a Transport. Command is one of
+// "set", "get", "delete", "exists" or "info". A get with IfVersion set may be
+// answered with Result.NotModified instead of the value.
+type Request struct {
+	Command   string
+	Key       string
+	Value     string
+	Overwrite bool
+	Old       bool
+	IfVersion uint64
+}
+
+// Transport carries requests to a store. RoundTrip must be safe for
+// concurrent use and should return ErrNotFound for missing keys.
+type Transport interface {
+	RoundTrip(ctx context.Context, req Request) (Result, error)
+	Close() error
+}
+
+type udpTransport struct {
+	pool         *client.Pool
+	closeTimeout time.Duration
+}
+
+func newUDPTransport(addr string, key []byte, o options) (*udpTransport, error) {
+	opts := []client.Option{client.WithRetryPolicy(o.retry)}
+	if o.suite != "" {
+		suite, err := encryption.ParseSuite(o.suite)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, client.WithCipherSuite(suite))
+	}
+	if o.sessions {
+		opts = append(opts, client.WithSessions())
+	}
+
+	pool, err := client.NewPool(addr, key, client.PoolOptions{Size: o.poolSize}, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &udpTransport{pool: pool, closeTimeout: o.timeout}, nil
+}
+
+func (t *udpTransport) RoundTrip(ctx context.Context, req Request) (Result, error) {
+	dto, err := protocol.NewFrameDTO(req.Command, req.Key, req.Value, req.Overwrite, req.Old)
+	if err != nil {
+		return Result{}, err
+	}
+	dto.IfVersion = req.IfVersion
+
+	result, err := t.pool.Send(ctx, dto)
+	if errors.Is(err, client.ErrPoolClosed) {
+		return Result{}, ErrClosed
+	}
+	return Result(result), err
+}
+
+// Close waits up to the client timeout for outstanding requests to finish.
+func (t *udpTransport) Close() error {
+	ctx, cancel := context.WithTimeout(context.Background(), t.closeTimeout)
+	defer cancel()
+	return t.pool.Close(ctx)
+}